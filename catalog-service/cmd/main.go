@@ -2,21 +2,24 @@ package main
 
 import (
 	"bufio"
-	"os"
-	"strings"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"store/catalog-service/internal/handler"
+	"store/catalog-service/internal/lowstock"
 	db "store/catalog-service/internal/repository"
+	"store/catalog-service/internal/reservation"
 	"store/proto"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -31,7 +34,7 @@ func createDatabaseIfNotExists(dbURL, dbName string) error {
 
 	var exists bool
 	err = db.QueryRow(
-		"SELECT EXISTS (SELECT * FROM pg_database WHERE datname = $1)", 
+		"SELECT EXISTS (SELECT * FROM pg_database WHERE datname = $1)",
 		dbName,
 	).Scan(&exists)
 	if err != nil {
@@ -77,6 +80,11 @@ type Config struct {
 	Port     string
 	DBName   string
 	SSLMode  string
+	// StockAlertWebhook адрес, на который отправляются оповещения об остатках
+	StockAlertWebhook string
+	// StockAlertFile файл для оповещений об остатках; если не задан ни он, ни webhook,
+	// оповещения пишутся в лог
+	StockAlertFile string
 }
 
 // loadConfig загружает конфигурацию из текстового файла
@@ -114,6 +122,10 @@ func loadConfig(filePath string) (*Config, error) {
 			config.DBName = value
 		case "DB_SSLMODE":
 			config.SSLMode = value
+		case "STOCK_ALERT_WEBHOOK":
+			config.StockAlertWebhook = value
+		case "STOCK_ALERT_FILE":
+			config.StockAlertFile = value
 		}
 	}
 
@@ -127,24 +139,68 @@ func loadConfig(filePath string) (*Config, error) {
 func generateDBURL(cfg Config, dbname bool) string {
 	if dbname {
 		return fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s?sslmode=%s", 
-			cfg.Username, 
-			cfg.Password, 
-			cfg.Host, 
-			cfg.Port, 
-			cfg.DBName, 
+			"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+			cfg.Username,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.DBName,
 			cfg.SSLMode,
 		)
-	} else{
-		return fmt.Sprintf("postgres://%s:%s@%s:%s?sslmode=%s", 
-			cfg.Username, 
-			cfg.Password, 
-			cfg.Host, 
-			cfg.Port, 
+	} else {
+		return fmt.Sprintf("postgres://%s:%s@%s:%s?sslmode=%s",
+			cfg.Username,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
 			cfg.SSLMode,
 		)
 	}
 }
+
+// runEvery раз в interval выполняет task, пока не отменен ctx.
+// Ошибка задачи только логируется: следующий запуск попробует снова
+func runEvery(ctx context.Context, interval time.Duration, task func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := task(ctx); err != nil {
+				log.Printf("Ошибка фоновой задачи: %v", err)
+			}
+		}
+	}
+}
+
+// reconcileStock сверяет остатки с журналом движений и печатает расхождения.
+// Возвращает код выхода: 0 - расхождений нет, 1 - есть расхождения, 2 - ошибка
+func reconcileStock(catalogDB db.CatalogDB) int {
+	drifts, err := catalogDB.ReconcileStock()
+	if err != nil {
+		log.Printf("Ошибка при сверке остатков: %v", err)
+		return 2
+	}
+	if len(drifts) == 0 {
+		fmt.Println("Остатки совпадают с журналом движений")
+		return 0
+	}
+
+	fmt.Printf("Расхождений с журналом движений: %d\n", len(drifts))
+	for _, drift := range drifts {
+		where := fmt.Sprintf("склад %d", drift.WarehouseID)
+		if drift.WarehouseID == 0 {
+			where = "общий остаток"
+		}
+		fmt.Printf("товар %d, %s: записано %d, по журналу %d, разница %+d\n",
+			drift.ProductID, where, drift.Quantity, drift.Expected, drift.Quantity-drift.Expected)
+	}
+	return 1
+}
+
 func main() {
 	// Загружаем конфигурацию
 	config, err := loadConfig("config.txt") // Укажите путь к вашему текстовому файлу
@@ -162,15 +218,16 @@ func main() {
 
 	// Подключаемся к базе данных
 	dbURLWithDB := generateDBURL(*config, true)
-	conn, err := pgx.Connect(context.Background(), dbURLWithDB)
+	// Пул соединений: к базе одновременно обращаются gRPC-обработчики и фоновые задачи
+	conn, err := pgxpool.Connect(context.Background(), dbURLWithDB)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
-	defer conn.Close(context.Background())
+	defer conn.Close()
 	fmt.Println("Connected to PostgreSQL!")
 
 	// Применяем миграции
-	if err := runMigrations(dbURLWithDB+"&x-migrations-table=catalog_migrations"); err != nil {
+	if err := runMigrations(dbURLWithDB + "&x-migrations-table=catalog_migrations"); err != nil {
 		log.Fatalf("Failed to run migrations: %v\n", err)
 	}
 	fmt.Println("Migrations applied successfully!")
@@ -178,6 +235,64 @@ func main() {
 	// Создаем экземпляр CatalogDB
 	catalogDB := db.NewCatalogDB(conn)
 
+	// catalog-service reconcile: сверить остатки с журналом движений и выйти
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		code := reconcileStock(catalogDB)
+		conn.Close()
+		os.Exit(code)
+	}
+
+	// Запускаем снятие просроченных резервов
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reservation.NewSweeper(catalogDB, time.Minute).Run(ctx)
+	go runEvery(ctx, time.Hour, func(context.Context) error {
+		purged, err := catalogDB.PurgeIdempotencyKeys()
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Удалено устаревших ключей идемпотентности: %d", purged)
+		}
+		return nil
+	})
+	go runEvery(ctx, time.Hour, func(context.Context) error {
+		purged, err := catalogDB.PurgeStockChanges()
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Удалено устаревших изменений остатков: %d", purged)
+		}
+		return nil
+	})
+	// Запланированные цены, которые начали действовать, переносятся в каталог
+	go runEvery(ctx, time.Minute, func(context.Context) error {
+		applied, err := catalogDB.ApplyScheduledPrices()
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			log.Printf("Применено запланированных цен: %d", applied)
+		}
+		return nil
+	})
+
+	// Запускаем оповещения о заканчивающихся товарах
+	var notifier lowstock.Notifier = lowstock.LogNotifier{}
+	switch {
+	case config.StockAlertWebhook != "":
+		notifier = lowstock.NewWebhookNotifier(config.StockAlertWebhook, 5*time.Second)
+	case config.StockAlertFile != "":
+		alertsFile, err := os.OpenFile(config.StockAlertFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open stock alert file: %v\n", err)
+		}
+		defer alertsFile.Close()
+		notifier = lowstock.NewWriterNotifier(alertsFile)
+	}
+	go lowstock.NewChecker(catalogDB, notifier, time.Minute, 100).Run(ctx)
+
 	// Создаем новый gRPC сервер
 	grpcServer := grpc.NewServer()
 
@@ -185,6 +300,9 @@ func main() {
 	catalogHandler := handler.NewCatalogHandler(catalogDB)
 	proto.RegisterProductServiceServer(grpcServer, catalogHandler)
 
+	// Рассылаем подписчикам WatchStock изменения остатков из журнала
+	go catalogHandler.StockFeed().Run(ctx)
+
 	// Включаем Reflection
 	reflection.Register(grpcServer)
 
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"math"
+	db "store/catalog-service/internal/repository"
+	"store/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// maxAttributes наибольшее число характеристик у товара
+	maxAttributes = 50
+	// maxAttributeKeyLength наибольшая длина названия характеристики
+	maxAttributeKeyLength = 64
+	// maxAttributeFilters наибольшее число условий по характеристикам в GetAllProducts
+	maxAttributeFilters = 10
+)
+
+// requestAttributes проверяет характеристики из запроса: плоский набор
+// строк, чисел и bool. nil означает, что характеристики не переданы
+func requestAttributes(attributes *structpb.Struct) (map[string]interface{}, error) {
+	if attributes == nil {
+		return nil, nil
+	}
+	if len(attributes.Fields) > maxAttributes {
+		return nil, status.Errorf(codes.InvalidArgument, "Не больше %d характеристик у товара", maxAttributes)
+	}
+
+	values := make(map[string]interface{}, len(attributes.Fields))
+	for key, value := range attributes.Fields {
+		if err := checkAttributeKey(key); err != nil {
+			return nil, err
+		}
+		v, err := attributeValue(key, value)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+// attributeFilters проверяет условия по характеристикам из GetAllProducts
+func attributeFilters(filters []*proto.AttributeFilter) ([]db.AttributeFilter, error) {
+	if len(filters) > maxAttributeFilters {
+		return nil, status.Errorf(codes.InvalidArgument, "Не больше %d условий по характеристикам", maxAttributeFilters)
+	}
+
+	var result []db.AttributeFilter
+	for _, filter := range filters {
+		if err := checkAttributeKey(filter.Key); err != nil {
+			return nil, err
+		}
+		if filter.Equals == nil && filter.Min == nil && filter.Max == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Для характеристики %q укажите equals, min или max", filter.Key)
+		}
+
+		condition := db.AttributeFilter{Key: filter.Key}
+		if filter.Equals != nil {
+			equals, err := attributeValue(filter.Key, filter.Equals)
+			if err != nil {
+				return nil, err
+			}
+			condition.Equals = equals
+		}
+		if filter.Min != nil {
+			condition.Min = &filter.Min.Value
+		}
+		if filter.Max != nil {
+			condition.Max = &filter.Max.Value
+		}
+		for _, bound := range []*float64{condition.Min, condition.Max} {
+			if bound != nil && (math.IsNaN(*bound) || math.IsInf(*bound, 0)) {
+				return nil, status.Errorf(codes.InvalidArgument, "Некорректная граница для характеристики %q", filter.Key)
+			}
+		}
+		if condition.Min != nil && condition.Max != nil && *condition.Min > *condition.Max {
+			return nil, status.Errorf(codes.InvalidArgument, "Для характеристики %q min больше max", filter.Key)
+		}
+		result = append(result, condition)
+	}
+	return result, nil
+}
+
+// checkAttributeKey проверяет название характеристики
+func checkAttributeKey(key string) error {
+	if key == "" || len(key) > maxAttributeKeyLength {
+		return status.Errorf(codes.InvalidArgument, "Название характеристики должно быть непустым и не длиннее %d символов", maxAttributeKeyLength)
+	}
+	return nil
+}
+
+// attributeValue достает значение характеристики: вложенные объекты, списки и null не поддерживаются
+func attributeValue(key string, value *structpb.Value) (interface{}, error) {
+	switch v := value.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return v.StringValue, nil
+	case *structpb.Value_BoolValue:
+		return v.BoolValue, nil
+	case *structpb.Value_NumberValue:
+		if math.IsNaN(v.NumberValue) || math.IsInf(v.NumberValue, 0) {
+			return nil, status.Errorf(codes.InvalidArgument, "Некорректное число в характеристике %q", key)
+		}
+		return v.NumberValue, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Характеристика %q должна быть строкой, числом или bool", key)
+	}
+}
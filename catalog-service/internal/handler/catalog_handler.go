@@ -2,25 +2,61 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"log"
+	"sort"
 	db "store/catalog-service/internal/repository"
+	"store/catalog-service/internal/stockfeed"
+	"store/idempotency"
+	"store/money"
 	"store/proto"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
 )
 
+// defaultReservationTTL время жизни резерва, если клиент его не указал
+const defaultReservationTTL = 15 * time.Minute
+
 type CatalogHandler struct {
 	proto.UnimplementedProductServiceServer
-	db db.CatalogDB // Добавляем поле db
+	db    db.CatalogDB // Добавляем поле db
+	stock *stockfeed.Feed
 }
 
 func NewCatalogHandler(db db.CatalogDB) *CatalogHandler {
-	return &CatalogHandler{db: db}
+	return &CatalogHandler{
+		db:    db,
+		stock: stockfeed.NewFeed(db, stockFeedInterval, stockBatchSize, stockWatchBuffer),
+	}
+}
+
+// StockFeed возвращает ленту изменений остатков для WatchStock; ее нужно запустить через Run
+func (h *CatalogHandler) StockFeed() *stockfeed.Feed {
+	return h.stock
 }
 
 func (h *CatalogHandler) UpdateProduct(ctx context.Context, req *proto.UpdateProductRequest) (*proto.UpdateProductResponse, error) {
 	log.Printf("Получен запрос UpdateProduct для product_id: %d", req.ProductId)
 
-	// Получаем текущие данные о товаре
-	productName, stockQuantity, pricePerUnit, err := h.db.GetProductByID(req.ProductId)
+	// С маской обновляем ровно перечисленные поля, включая нулевые значения
+	if len(req.GetUpdateMask().GetPaths()) > 0 {
+		return h.updateMaskedProduct(ctx, req)
+	}
+
+	attributes, err := requestAttributes(req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	if req.ReorderThreshold < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Порог дозаказа не может быть отрицательным")
+	}
+
+	// Получаем текущие данные о товаре. Цену из Catalog обратно не пишем: она может
+	// отставать от уже наступившей запланированной цены
+	productName, stockQuantity, _, err := h.db.GetProductByID(req.ProductId)
 	if err != nil {
 		log.Printf("Ошибка при получении товара: %v", err)
 		return nil, err
@@ -33,12 +69,34 @@ func (h *CatalogHandler) UpdateProduct(ctx context.Context, req *proto.UpdatePro
 	if req.StockQuantity != 0 {
 		stockQuantity = int(req.StockQuantity)
 	}
-	if req.PricePerUnit != 0 {
-		pricePerUnit = req.PricePerUnit
+	// nil - цена не меняется
+	var pricePerUnit *proto.Money
+	if req.Price != nil || req.PricePerUnit != 0 {
+		if pricePerUnit, err = requestPrice(req.Price, req.PricePerUnit); err != nil {
+			return nil, err
+		}
 	}
 
-	// Обновляем товар в базе данных
-	err = h.db.UpdateProduct(int(req.ProductId), productName, stockQuantity, pricePerUnit)
+	// Обновляем товар в базе данных; непустые характеристики и порог дозаказа
+	// меняются тем же UPDATE
+	if len(attributes) > 0 || req.ReorderThreshold > 0 {
+		update := db.ProductUpdate{
+			ProductName:   &productName,
+			StockQuantity: &stockQuantity,
+			Price:         pricePerUnit,
+			Attributes:    attributes,
+			Actor:         actorFromContext(ctx),
+		}
+		if req.ReorderThreshold > 0 {
+			update.ReorderThreshold = &req.ReorderThreshold
+		}
+		err = h.db.UpdateProductFields(req.ProductId, update)
+	} else {
+		err = h.db.UpdateProduct(int(req.ProductId), productName, stockQuantity, pricePerUnit, actorFromContext(ctx))
+	}
+	if errors.Is(err, db.ErrStockOnOtherWarehouses) {
+		return nil, stockStatusError(err)
+	}
 	if err != nil {
 		log.Printf("Ошибка при обновлении товара: %v", err)
 		return nil, err
@@ -50,11 +108,98 @@ func (h *CatalogHandler) UpdateProduct(ctx context.Context, req *proto.UpdatePro
 	}, nil
 }
 
+// updateMaskedProduct обновляет поля товара из update_mask одним запросом к базе
+func (h *CatalogHandler) updateMaskedProduct(ctx context.Context, req *proto.UpdateProductRequest) (*proto.UpdateProductResponse, error) {
+	update := db.ProductUpdate{Actor: actorFromContext(ctx)}
+	for _, path := range req.UpdateMask.Paths {
+		switch path {
+		case "product_name":
+			if req.ProductName == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "Название товара не может быть пустым")
+			}
+			update.ProductName = &req.ProductName
+		case "stock_quantity":
+			if req.StockQuantity < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "Остаток не может быть отрицательным")
+			}
+			stockQuantity := int(req.StockQuantity)
+			update.StockQuantity = &stockQuantity
+		case "price", "price_per_unit":
+			price, err := requestPrice(req.Price, req.PricePerUnit)
+			if err != nil {
+				return nil, err
+			}
+			update.Price = price
+		case "attributes":
+			attributes, err := requestAttributes(req.Attributes)
+			if err != nil {
+				return nil, err
+			}
+			// С маской пустые характеристики очищают прежние
+			if attributes == nil {
+				attributes = map[string]interface{}{}
+			}
+			update.Attributes = attributes
+		case "reorder_threshold":
+			if req.ReorderThreshold < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "Порог дозаказа не может быть отрицательным")
+			}
+			update.ReorderThreshold = &req.ReorderThreshold
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "Поле %q нельзя обновить", path)
+		}
+	}
+
+	err := h.db.UpdateProductFields(req.ProductId, update)
+	if errors.Is(err, db.ErrProductNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Товар не найден")
+	}
+	if errors.Is(err, db.ErrStockOnOtherWarehouses) {
+		return nil, stockStatusError(err)
+	}
+	if err != nil {
+		log.Printf("Ошибка при обновлении товара: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	return &proto.UpdateProductResponse{
+		Success: true,
+	}, nil
+}
+
 func (h *CatalogHandler) AddProduct(ctx context.Context, req *proto.AddProductRequest) (*proto.AddProductResponse, error) {
 	log.Printf("Получен запрос AddProduct: %v", req)
 
+	if req.StockQuantity < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Остаток не может быть отрицательным")
+	}
+
+	// Повтор запроса с тем же ключом не создает второй товар
+	key := idempotency.Key(ctx, req.IdempotencyKey)
+	var hash string
+	if key != "" {
+		payload := protobuf.Clone(req).(*proto.AddProductRequest)
+		payload.IdempotencyKey = ""
+		var err error
+		if hash, err = idempotency.RequestHash(payload); err != nil {
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
+	price, err := requestPrice(req.Price, req.PricePerUnit)
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := requestAttributes(req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	// Добавляем продукт в базу данных
-	productID, err := h.db.AddProduct(req.ProductName, int(req.StockQuantity), req.PricePerUnit)
+	productID, err := h.db.AddProduct(req.ProductName, int(req.StockQuantity), price, attributes, key, hash, actorFromContext(ctx))
+	if errors.Is(err, db.ErrIdempotencyKeyMismatch) {
+		return nil, status.Errorf(codes.InvalidArgument, "Ключ идемпотентности уже использован с другими параметрами запроса")
+	}
 	if err != nil {
 		log.Printf("Ошибка при добавлении продукта: %v", err)
 		return nil, err
@@ -69,37 +214,171 @@ func (h *CatalogHandler) AddProduct(ctx context.Context, req *proto.AddProductRe
 func (h *CatalogHandler) GetProductByID(ctx context.Context, req *proto.GetProductByIDRequest) (*proto.GetProductByIDResponse, error) {
 	log.Printf("Получен запрос GetProductByID для product_id: %d", req.ProductId)
 
+	priceAt := time.Now()
+	if req.PriceAt != "" {
+		var err error
+		if priceAt, err = parseTimestamp(req.PriceAt, "price_at"); err != nil {
+			return nil, err
+		}
+	}
+
 	// Используем реальную базу данных
-	productName, stockQuantity, pricePerUnit, err := h.db.GetProductByID(req.ProductId)
+	products, err := h.db.GetProductsByIDs([]int32{req.ProductId})
 	if err != nil {
 		log.Printf("Ошибка при получении продукта: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if len(products) == 0 {
+		return nil, status.Errorf(codes.NotFound, "Товар не найден")
+	}
+
+	product := products[0]
+	if err := h.withCategories(product); err != nil {
+		return nil, err
+	}
+	if err := h.withVariants(product); err != nil {
+		return nil, err
+	}
+	if err := h.withStockLevels(product); err != nil {
+		return nil, err
+	}
+	// Цена из Catalog - копия текущей цены, обновляемая фоновой задачей;
+	// точную цену на нужный момент берем из истории цен
+	if err := h.withEffectivePrices(priceAt, product); err != nil {
 		return nil, err
 	}
+	if product.Price == nil {
+		// Товар есть, но price_at раньше начала его истории цен
+		return nil, status.Errorf(codes.OutOfRange, "На момент price_at у товара еще не было цены")
+	}
 
 	// Возвращаем ответ
-	return &proto.GetProductByIDResponse{
-		Product: &proto.Product{
-			ProductId:     req.ProductId,
-			ProductName:   productName,
-			StockQuantity: int32(stockQuantity),
-			PricePerUnit:  pricePerUnit,
-		},
-	}, nil
+	return &proto.GetProductByIDResponse{Product: product}, nil
+}
+
+// maxProductsByIDs наибольшее число ID и артикулов в одном запросе GetProductsByIDs
+const maxProductsByIDs = 1000
+
+// GetProductsByIDs возвращает несколько товаров по ID и артикулам.
+// Отсутствующие товары не считаются ошибкой и перечисляются в missing_product_ids и missing_skus
+func (h *CatalogHandler) GetProductsByIDs(ctx context.Context, req *proto.GetProductsByIDsRequest) (*proto.GetProductsByIDsResponse, error) {
+	log.Printf("Получен запрос GetProductsByIDs для %d product_id и %d sku", len(req.ProductIds), len(req.Skus))
+
+	// Убираем повторы, сохраняя порядок запроса
+	seen := make(map[int32]bool, len(req.ProductIds))
+	ids := make([]int32, 0, len(req.ProductIds))
+	for _, id := range req.ProductIds {
+		if id <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Некорректный product_id: %d", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	seenSKU := make(map[string]bool, len(req.Skus))
+	skus := make([]string, 0, len(req.Skus))
+	for _, sku := range req.Skus {
+		if sku == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Артикул не может быть пустым")
+		}
+		if !seenSKU[sku] {
+			seenSKU[sku] = true
+			skus = append(skus, sku)
+		}
+	}
+	if len(ids)+len(skus) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Нужен хотя бы один product_id или sku")
+	}
+	if len(ids)+len(skus) > maxProductsByIDs {
+		return nil, status.Errorf(codes.InvalidArgument, "Не больше %d товаров за запрос", maxProductsByIDs)
+	}
+
+	var products []*proto.Product
+	if len(ids) > 0 {
+		byID, err := h.db.GetProductsByIDs(ids)
+		if err != nil {
+			log.Printf("Ошибка при получении продуктов: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		products = byID
+	}
+	foundSKU := make(map[string]bool, len(skus))
+	if len(skus) > 0 {
+		bySKU, err := h.db.GetProductsBySKUs(skus)
+		if err != nil {
+			log.Printf("Ошибка при получении продуктов по артикулам: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		// Вариант, запрошенный и по ID, и по артикулу, возвращается один раз
+		for _, product := range bySKU {
+			foundSKU[product.Sku] = true
+			if !seen[product.ProductId] {
+				products = append(products, product)
+			}
+		}
+		sort.Slice(products, func(i, j int) bool { return products[i].ProductId < products[j].ProductId })
+	}
+	if err := h.withCategories(products...); err != nil {
+		return nil, err
+	}
+	if err := h.withVariants(products...); err != nil {
+		return nil, err
+	}
+	// По этим ценам order-service фиксирует цену заказа, поэтому копия цены
+	// в Catalog, которую фоновая задача обновляет с задержкой, не годится
+	if err := h.withEffectivePrices(time.Now(), products...); err != nil {
+		return nil, err
+	}
+
+	found := make(map[int32]bool, len(products))
+	for _, product := range products {
+		found[product.ProductId] = true
+	}
+	resp := &proto.GetProductsByIDsResponse{Products: products}
+	for _, id := range ids {
+		if !found[id] {
+			resp.MissingProductIds = append(resp.MissingProductIds, id)
+		}
+	}
+	for _, sku := range skus {
+		if !foundSKU[sku] {
+			resp.MissingSkus = append(resp.MissingSkus, sku)
+		}
+	}
+	return resp, nil
 }
 
 func (h *CatalogHandler) GetAllProducts(ctx context.Context, req *proto.GetAllProductsRequest) (*proto.GetAllProductsResponse, error) {
 	log.Println("Получен запрос GetAllProducts")
 
-	// Получаем все продукты из базы данных
-	products, err := h.db.GetAllProducts()
+	filter, err := productFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Получаем страницу продуктов из базы данных
+	products, next, err := h.db.GetAllProducts(filter)
 	if err != nil {
 		log.Printf("Ошибка при получении продуктов: %v", err)
 		return nil, err
 	}
+	if err := h.withCategories(products...); err != nil {
+		return nil, err
+	}
+
+	var nextPageToken string
+	if next != nil {
+		if nextPageToken, err = encodePageToken(req, next); err != nil {
+			log.Printf("Ошибка при формировании токена страницы: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
 
 	// Возвращаем ответ
 	return &proto.GetAllProductsResponse{
-		Products: products,
+		Products:      products,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
@@ -107,7 +386,7 @@ func (h *CatalogHandler) DeleteProduct(ctx context.Context, req *proto.DeletePro
 	log.Printf("Получен запрос DeleteProduct для product_id: %d", req.ProductId)
 
 	// Удаляем продукт из базы данных
-	err := h.db.DeleteProduct(int(req.ProductId))
+	err := h.db.DeleteProduct(int(req.ProductId), actorFromContext(ctx))
 	if err != nil {
 		log.Printf("Ошибка при удалении продукта: %v", err)
 		return nil, err
@@ -118,3 +397,191 @@ func (h *CatalogHandler) DeleteProduct(ctx context.Context, req *proto.DeletePro
 		Success: true,
 	}, nil
 }
+
+// ReserveStock атомарно списывает товар со склада
+func (h *CatalogHandler) ReserveStock(ctx context.Context, req *proto.ReserveStockRequest) (*proto.ReserveStockResponse, error) {
+	log.Printf("Получен запрос ReserveStock для product_id: %d, quantity: %d", req.ProductId, req.Quantity)
+
+	if req.Quantity <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Количество должно быть больше нуля")
+	}
+	if req.OrderId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный order_id")
+	}
+
+	stockQuantity, warehouseID, err := h.db.ReserveStock(req.ProductId, int(req.Quantity), db.StockMovement{
+		Reason:  proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE,
+		OrderID: req.OrderId,
+		Actor:   actorFromContext(ctx),
+	})
+	if err != nil {
+		log.Printf("Ошибка при резервировании товара: %v", err)
+		return nil, stockStatusError(err)
+	}
+
+	return &proto.ReserveStockResponse{
+		StockQuantity: int32(stockQuantity),
+		WarehouseId:   warehouseID,
+	}, nil
+}
+
+// ReleaseStock атомарно возвращает товар на склад
+func (h *CatalogHandler) ReleaseStock(ctx context.Context, req *proto.ReleaseStockRequest) (*proto.ReleaseStockResponse, error) {
+	log.Printf("Получен запрос ReleaseStock для product_id: %d, warehouse_id: %d, quantity: %d", req.ProductId, req.WarehouseId, req.Quantity)
+
+	if req.Quantity <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Количество должно быть больше нуля")
+	}
+	if req.WarehouseId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный warehouse_id")
+	}
+	if req.OrderId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный order_id")
+	}
+
+	stockQuantity, err := h.db.ReleaseStock(req.ProductId, req.WarehouseId, int(req.Quantity), req.OperationId, db.StockMovement{
+		Reason:  proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN,
+		OrderID: req.OrderId,
+		Actor:   actorFromContext(ctx),
+	})
+	if err != nil {
+		log.Printf("Ошибка при возврате товара на склад: %v", err)
+		return nil, stockStatusError(err)
+	}
+
+	return &proto.ReleaseStockResponse{
+		StockQuantity: int32(stockQuantity),
+	}, nil
+}
+
+// CreateReservation резервирует все позиции заказа одной транзакцией
+func (h *CatalogHandler) CreateReservation(ctx context.Context, req *proto.CreateReservationRequest) (*proto.CreateReservationResponse, error) {
+	log.Printf("Получен запрос CreateReservation: %v", req)
+
+	if len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Резерв должен содержать хотя бы одну позицию")
+	}
+	// Позиция одного товара списывается с одного склада
+	warehouses := make(map[int32]int32, len(req.Items))
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Количество должно быть больше нуля")
+		}
+		if item.WarehouseId < 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Некорректный warehouse_id")
+		}
+		if prev := warehouses[item.ProductId]; prev != 0 && item.WarehouseId != 0 && prev != item.WarehouseId {
+			return nil, status.Errorf(codes.InvalidArgument, "Товар %d указан с разными складами", item.ProductId)
+		}
+		if item.WarehouseId != 0 {
+			warehouses[item.ProductId] = item.WarehouseId
+		}
+	}
+	if err := validateAllocation(req.Allocation); err != nil {
+		return nil, err
+	}
+	if req.TtlSeconds < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Время жизни резерва не может быть отрицательным")
+	}
+	if req.OrderId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный order_id")
+	}
+
+	ttl := defaultReservationTTL
+	if req.TtlSeconds > 0 {
+		ttl = time.Duration(req.TtlSeconds) * time.Second
+	}
+
+	reservation, err := h.db.CreateReservation(req.Items, req.Allocation, ttl, db.StockMovement{
+		Reason:  proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE,
+		OrderID: req.OrderId,
+		Actor:   actorFromContext(ctx),
+	})
+	if err != nil {
+		log.Printf("Ошибка при создании резерва: %v", err)
+		return nil, stockStatusError(err)
+	}
+
+	return &proto.CreateReservationResponse{
+		ReservationId: reservation.ReservationID,
+		ExpiresAt:     reservation.ExpiresAt.Format(time.RFC3339),
+		Items:         reservation.Items,
+	}, nil
+}
+
+// CommitReservation подтверждает резерв
+func (h *CatalogHandler) CommitReservation(ctx context.Context, req *proto.CommitReservationRequest) (*proto.CommitReservationResponse, error) {
+	log.Printf("Получен запрос CommitReservation для reservation_id: %d", req.ReservationId)
+
+	err := h.db.CommitReservation(req.ReservationId)
+	if err != nil {
+		log.Printf("Ошибка при подтверждении резерва: %v", err)
+		return nil, stockStatusError(err)
+	}
+
+	return &proto.CommitReservationResponse{
+		Success: true,
+	}, nil
+}
+
+// CancelReservation отменяет резерв и возвращает товар на склад
+func (h *CatalogHandler) CancelReservation(ctx context.Context, req *proto.CancelReservationRequest) (*proto.CancelReservationResponse, error) {
+	log.Printf("Получен запрос CancelReservation для reservation_id: %d", req.ReservationId)
+
+	err := h.db.CancelReservation(req.ReservationId, actorFromContext(ctx))
+	if err != nil {
+		log.Printf("Ошибка при отмене резерва: %v", err)
+		return nil, stockStatusError(err)
+	}
+
+	return &proto.CancelReservationResponse{
+		Success: true,
+	}, nil
+}
+
+// requestPrice возвращает цену из поля price, а для старых клиентов - из price_per_unit.
+// Цена хранится в NUMERIC(10, 2), поэтому точнее копеек ее задать нельзя
+func requestPrice(price *proto.Money, legacy float64) (*proto.Money, error) {
+	if price == nil {
+		price = money.FromFloat(legacy, money.DefaultCurrency)
+	}
+	if money.Validate(price) != nil || money.IsNegative(price) {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректная цена")
+	}
+	if !money.FitsScale(price, 2) {
+		return nil, status.Errorf(codes.InvalidArgument, "Цена указывается с точностью до копеек")
+	}
+	if price.CurrencyCode == "" {
+		return money.New(price.Units, price.Nanos, money.DefaultCurrency), nil
+	}
+	if len(price.CurrencyCode) != 3 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный код валюты %q", price.CurrencyCode)
+	}
+	return price, nil
+}
+
+// stockStatusError переводит ошибки репозитория в gRPC-коды
+func stockStatusError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrProductNotFound):
+		return status.Errorf(codes.NotFound, "Товар не найден")
+	case errors.Is(err, db.ErrInsufficientStock):
+		return status.Errorf(codes.FailedPrecondition, "Недостаточно товара на складе")
+	case errors.Is(err, db.ErrNoSingleWarehouse):
+		return status.Errorf(codes.FailedPrecondition, "Товара хватает только на нескольких складах вместе, а позиция списывается с одного склада")
+	case errors.Is(err, db.ErrWarehouseInactive):
+		return status.Errorf(codes.FailedPrecondition, "Склад не активен")
+	case errors.Is(err, db.ErrProductHasVariants):
+		return status.Errorf(codes.FailedPrecondition, "Товар продается вариантами, укажите вариант")
+	case errors.Is(err, db.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "Склад не найден")
+	case errors.Is(err, db.ErrStockOnOtherWarehouses):
+		return status.Errorf(codes.FailedPrecondition, "На других складах товара больше, чем новый остаток")
+	case errors.Is(err, db.ErrReservationNotFound):
+		return status.Errorf(codes.NotFound, "Резерв не найден")
+	case errors.Is(err, db.ErrReservationNotPending):
+		return status.Errorf(codes.FailedPrecondition, "Резерв уже закрыт")
+	default:
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+}
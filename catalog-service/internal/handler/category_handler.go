@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/proto"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateCategory создает категорию в корне или внутри parent_id
+func (h *CatalogHandler) CreateCategory(ctx context.Context, req *proto.CreateCategoryRequest) (*proto.CreateCategoryResponse, error) {
+	log.Printf("Получен запрос CreateCategory: %v", req)
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Название категории не может быть пустым")
+	}
+	if req.ParentId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный parent_id")
+	}
+
+	category, err := h.db.CreateCategory(name, req.ParentId)
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &proto.CreateCategoryResponse{Category: category}, nil
+}
+
+// ListCategories возвращает дерево категорий или поддерево root_id
+func (h *CatalogHandler) ListCategories(ctx context.Context, req *proto.ListCategoriesRequest) (*proto.ListCategoriesResponse, error) {
+	log.Printf("Получен запрос ListCategories для root_id: %d", req.RootId)
+
+	if req.RootId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный root_id")
+	}
+
+	categories, err := h.db.GetCategories(req.RootId)
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &proto.ListCategoriesResponse{Categories: categories}, nil
+}
+
+// UpdateCategory переименовывает категорию и/или переносит ее вместе с подкатегориями
+func (h *CatalogHandler) UpdateCategory(ctx context.Context, req *proto.UpdateCategoryRequest) (*proto.UpdateCategoryResponse, error) {
+	log.Printf("Получен запрос UpdateCategory для category_id: %d", req.CategoryId)
+
+	name := strings.TrimSpace(req.Name)
+	var update db.CategoryUpdate
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 && name != "" {
+		paths = []string{"name"}
+	}
+	for _, path := range paths {
+		switch path {
+		case "name":
+			if name == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "Название категории не может быть пустым")
+			}
+			update.Name = &name
+		case "parent_id":
+			if req.ParentId < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "Некорректный parent_id")
+			}
+			update.ParentID = &req.ParentId
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "Поле %q нельзя обновить", path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Нечего обновлять")
+	}
+
+	category, err := h.db.UpdateCategory(req.CategoryId, update)
+	if err != nil {
+		return nil, categoryError(err)
+	}
+	return &proto.UpdateCategoryResponse{Category: category}, nil
+}
+
+// DeleteCategory удаляет пустую от подкатегорий категорию
+func (h *CatalogHandler) DeleteCategory(ctx context.Context, req *proto.DeleteCategoryRequest) (*proto.DeleteCategoryResponse, error) {
+	log.Printf("Получен запрос DeleteCategory для category_id: %d", req.CategoryId)
+
+	if err := h.db.DeleteCategory(req.CategoryId); err != nil {
+		return nil, categoryError(err)
+	}
+	return &proto.DeleteCategoryResponse{Success: true}, nil
+}
+
+// SetProductCategories заменяет категории товара и возвращает их с путями
+func (h *CatalogHandler) SetProductCategories(ctx context.Context, req *proto.SetProductCategoriesRequest) (*proto.SetProductCategoriesResponse, error) {
+	log.Printf("Получен запрос SetProductCategories для product_id: %d, category_ids: %v", req.ProductId, req.CategoryIds)
+
+	// Повторы в запросе не считаются ошибкой
+	seen := make(map[int32]bool, len(req.CategoryIds))
+	ids := make([]int32, 0, len(req.CategoryIds))
+	for _, id := range req.CategoryIds {
+		if id <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Некорректный category_id: %d", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	err := h.db.SetProductCategories(req.ProductId, ids)
+	if errors.Is(err, db.ErrProductNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Товар не найден")
+	}
+	if err != nil {
+		return nil, categoryError(err)
+	}
+
+	categories, err := h.db.GetProductCategories([]int32{req.ProductId})
+	if err != nil {
+		log.Printf("Ошибка при получении категорий товара: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	return &proto.SetProductCategoriesResponse{Categories: categories[req.ProductId]}, nil
+}
+
+// withCategories дополняет товары их категориями одним запросом к базе
+func (h *CatalogHandler) withCategories(products ...*proto.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	ids := make([]int32, len(products))
+	for i, product := range products {
+		ids[i] = product.ProductId
+	}
+
+	categories, err := h.db.GetProductCategories(ids)
+	if err != nil {
+		log.Printf("Ошибка при получении категорий товаров: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	for _, product := range products {
+		product.Categories = categories[product.ProductId]
+	}
+	return nil
+}
+
+// categoryError переводит ошибку работы с категориями в статус gRPC
+func categoryError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound):
+		return status.Errorf(codes.NotFound, "Категория не найдена")
+	case errors.Is(err, db.ErrCategoryExists):
+		return status.Errorf(codes.AlreadyExists, "Категория с таким названием уже есть у этого родителя")
+	case errors.Is(err, db.ErrCategoryHasChildren):
+		return status.Errorf(codes.FailedPrecondition, "Сначала удалите или перенесите подкатегории")
+	case errors.Is(err, db.ErrCategoryCycle):
+		return status.Errorf(codes.FailedPrecondition, "Категорию нельзя перенести в ее собственную подкатегорию")
+	default:
+		log.Printf("Ошибка при работе с категориями: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+}
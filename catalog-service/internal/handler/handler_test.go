@@ -2,13 +2,24 @@ package handler
 
 import (
 	"context"
+	"fmt"
 	"store/proto"
+	"strings"
 	"testing"
-	"fmt"
+	"time"
 
 	"github.com/stretchr/testify/assert"
-	"go.uber.org/mock/gomock"                        // Используем go.uber.org/mock/gomock
+	"go.uber.org/mock/gomock" // Используем go.uber.org/mock/gomock
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	db "store/catalog-service/internal/repository"
 	"store/catalog-service/internal/repository/mock" // Импортируем моки
+	"store/money"
 )
 
 func TestAddProduct(t *testing.T) {
@@ -23,7 +34,7 @@ func TestAddProduct(t *testing.T) {
 
 	// Мокируем вызов AddProduct
 	mockDB.EXPECT().
-		AddProduct("Test Product", 10, 19.99).
+		AddProduct("Test Product", 10, money.New(19, 990000000, "RUB"), nil, "", "", "unknown").
 		Return(1, nil)
 
 	// Вызов метода AddProduct
@@ -52,11 +63,11 @@ func TestUpdateProduct(t *testing.T) {
 	// Мокируем вызов GetProductByID для получения текущих данных о товаре
 	mockDB.EXPECT().
 		GetProductByID(int32(1)). // Используем int32
-		Return("Old Product", 10, 19.99, nil)
+		Return("Old Product", 10, money.New(19, 990000000, "RUB"), nil)
 
 	// Мокируем вызов UpdateProduct
 	mockDB.EXPECT().
-		UpdateProduct(1, "Updated Product", 20, 29.99).
+		UpdateProduct(1, "Updated Product", 20, money.New(29, 990000000, "RUB"), "unknown").
 		Return(nil)
 
 	// Вызов метода UpdateProduct
@@ -73,28 +84,236 @@ func TestUpdateProduct(t *testing.T) {
 	assert.True(t, resp.Success)
 }
 
+func TestUpdateProduct_NameOnlyKeepsPrice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Запланированная цена уже наступила, но фоновая задача еще не перенесла ее
+	// в Catalog: устаревшая цена не должна вернуться в историю цен
+	mockDB.EXPECT().
+		GetProductByID(int32(1)).
+		Return("Old Product", 10, money.New(4700, 0, "RUB"), nil)
+	mockDB.EXPECT().
+		UpdateProduct(1, "Updated Product", 10, gomock.Nil(), "unknown").
+		Return(nil)
+
+	resp, err := h.UpdateProduct(context.Background(), &proto.UpdateProductRequest{
+		ProductId:   1,
+		ProductName: "Updated Product",
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestUpdateProduct_FieldMaskZeroValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Товар распродан: остаток 0 записывается, название не трогаем
+	stockQuantity := 0
+	mockDB.EXPECT().
+		UpdateProductFields(int32(1), db.ProductUpdate{StockQuantity: &stockQuantity, Price: money.New(0, 0, "RUB"), Actor: "unknown"}).
+		Return(nil)
+
+	req := &proto.UpdateProductRequest{
+		ProductId:  1,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock_quantity", "price_per_unit"}},
+	}
+	resp, err := h.UpdateProduct(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestUpdateProduct_FieldMaskUnknownPath(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	req := &proto.UpdateProductRequest{
+		ProductId:  1,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"product_id"}},
+	}
+	resp, err := h.UpdateProduct(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateProduct_FieldMaskNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	name := "Новый чайник"
+	mockDB.EXPECT().
+		UpdateProductFields(int32(9), db.ProductUpdate{ProductName: &name, Actor: "unknown"}).
+		Return(db.ErrProductNotFound)
+
+	req := &proto.UpdateProductRequest{
+		ProductId:   9,
+		ProductName: name,
+		UpdateMask:  &fieldmaskpb.FieldMask{Paths: []string{"product_name"}},
+	}
+	resp, err := h.UpdateProduct(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
 func TestAddProduct_Error(t *testing.T) {
-    ctrl := gomock.NewController(t)
-    defer ctrl.Finish()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		AddProduct("Test Product", 10, money.New(19, 990000000, "RUB"), nil, "", "", "unknown").
+		Return(0, fmt.Errorf("failed to add product"))
+
+	req := &proto.AddProductRequest{
+		ProductName:   "Test Product",
+		StockQuantity: 10,
+		PricePerUnit:  19.99,
+	}
+	resp, err := h.AddProduct(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestAddProduct_IdempotencyKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Ключ из поля и из метаданных дает одинаковый отпечаток запроса
+	var hashes []string
+	mockDB.EXPECT().
+		AddProduct("Test Product", 10, money.New(19, 990000000, "RUB"), nil, "key-1", gomock.Any(), "unknown").
+		DoAndReturn(func(_ string, _ int, _ *proto.Money, _ map[string]interface{}, _ string, hash, _ string) (int, error) {
+			hashes = append(hashes, hash)
+			return 7, nil
+		}).
+		Times(2)
+
+	req := &proto.AddProductRequest{
+		ProductName:    "Test Product",
+		StockQuantity:  10,
+		PricePerUnit:   19.99,
+		IdempotencyKey: "key-1",
+	}
+	resp, err := h.AddProduct(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), resp.ProductId)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", "key-1"))
+	req.IdempotencyKey = ""
+	resp, err = h.AddProduct(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), resp.ProductId)
+
+	assert.Len(t, hashes, 2)
+	assert.NotEmpty(t, hashes[0])
+	assert.Equal(t, hashes[0], hashes[1])
+}
+
+func TestAddProduct_IdempotencyKeyMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		AddProduct("Other Product", 1, money.New(5, 0, "RUB"), nil, "key-1", gomock.Any(), "unknown").
+		Return(0, db.ErrIdempotencyKeyMismatch)
+
+	req := &proto.AddProductRequest{
+		ProductName:    "Other Product",
+		StockQuantity:  1,
+		PricePerUnit:   5.0,
+		IdempotencyKey: "key-1",
+	}
+	resp, err := h.AddProduct(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAddProduct_MoneyPrice(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Цена без валюты считается в рублях, устаревшее поле игнорируется
+	mockDB.EXPECT().
+		AddProduct("Чайник", 100, money.New(5700, 500000000, "RUB"), nil, "", "", "unknown").
+		Return(2, nil)
+
+	req := &proto.AddProductRequest{
+		ProductName:   "Чайник",
+		StockQuantity: 100,
+		PricePerUnit:  1,
+		Price:         &proto.Money{Units: 5700, Nanos: 500000000},
+	}
+	resp, err := h.AddProduct(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), resp.ProductId)
+}
 
-    mockDB := mock.NewMockCatalogDB(ctrl)
-    h := NewCatalogHandler(mockDB)
+func TestAddProduct_PriceTooPrecise(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-    mockDB.EXPECT().
-        AddProduct("Test Product", 10, 19.99).
-        Return(0, fmt.Errorf("failed to add product"))
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
 
-    req := &proto.AddProductRequest{
-        ProductName:   "Test Product",
-        StockQuantity: 10,
-        PricePerUnit:  19.99,
-    }
-    resp, err := h.AddProduct(context.Background(), req)
+	req := &proto.AddProductRequest{
+		ProductName:   "Чайник",
+		StockQuantity: 100,
+		Price:         money.New(5700, 1, "RUB"),
+	}
+	resp, err := h.AddProduct(context.Background(), req)
 
-    assert.Error(t, err)
-    assert.Nil(t, resp)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
+func TestAddProduct_NegativeStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	req := &proto.AddProductRequest{
+		ProductName:   "Чайник",
+		StockQuantity: -1,
+		Price:         money.New(5700, 0, "RUB"),
+	}
+	resp, err := h.AddProduct(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
 
 func TestGetProductByID(t *testing.T) {
 	ctrl := gomock.NewController(t)
@@ -106,10 +325,38 @@ func TestGetProductByID(t *testing.T) {
 	// Создаем экземпляр CatalogHandler с моком
 	h := NewCatalogHandler(mockDB)
 
-	// Мокируем вызов GetProductByID
+	// Мокируем вызов GetProductsByIDs
 	mockDB.EXPECT().
-		GetProductByID(int32(1)). // Используем int32
-		Return("Test Product", 10, 19.99, nil)
+		GetProductsByIDs([]int32{1}).
+		Return([]*proto.Product{{
+			ProductId:     1,
+			ProductName:   "Test Product",
+			StockQuantity: 10,
+			PricePerUnit:  19.99,
+			Price:         money.New(19, 990000000, "RUB"),
+		}}, nil)
+	kitchen := []*proto.Category{{CategoryId: 3, Name: "Кухня", ParentId: 1, Path: "Дом / Кухня"}}
+	mockDB.EXPECT().
+		GetProductCategories([]int32{1}).
+		Return(map[int32][]*proto.Category{1: kitchen}, nil)
+	red := &proto.Product{ProductId: 8, ProductName: "Test Product (красный)", ParentProductId: 1, Sku: "TP-RED"}
+	mockDB.EXPECT().
+		GetProductVariants([]int32{1}).
+		Return(map[int32][]*proto.Product{1: {red}}, nil)
+	levels := []*proto.StockLevel{
+		{WarehouseId: 1, WarehouseName: "Москва", Quantity: 6},
+		{WarehouseId: 2, WarehouseName: "Казань", Quantity: 4},
+	}
+	mockDB.EXPECT().
+		GetStockLevels([]int32{1}).
+		Return(map[int32][]*proto.StockLevel{1: levels}, nil)
+	// Цены товара и варианта берутся из истории цен на текущий момент
+	mockDB.EXPECT().
+		GetEffectivePrices([]int32{1, 8}, gomock.Any()).
+		Return(map[int32]*proto.Money{
+			1: money.New(19, 990000000, "RUB"),
+			8: money.New(21, 500000000, "RUB"),
+		}, nil)
 
 	// Вызов метода GetProductByID
 	req := &proto.GetProductByIDRequest{
@@ -124,7 +371,12 @@ func TestGetProductByID(t *testing.T) {
 		ProductName:   "Test Product",
 		StockQuantity: 10,
 		PricePerUnit:  19.99,
+		Price:         money.New(19, 990000000, "RUB"),
+		Categories:    kitchen,
+		Variants:      []*proto.Product{red},
+		StockLevels:   levels,
 	}, resp.Product)
+	assert.Equal(t, money.New(21, 500000000, "RUB"), red.Price)
 }
 
 func TestGetAllProducts(t *testing.T) {
@@ -153,8 +405,11 @@ func TestGetAllProducts(t *testing.T) {
 		},
 	}
 	mockDB.EXPECT().
-		GetAllProducts().
-		Return(expectedProducts, nil)
+		GetAllProducts(db.ProductFilter{PageSize: 50}).
+		Return(expectedProducts, nil, nil)
+	mockDB.EXPECT().
+		GetProductCategories([]int32{1, 2}).
+		Return(map[int32][]*proto.Category{}, nil)
 
 	// Вызов метода GetAllProducts
 	req := &proto.GetAllProductsRequest{}
@@ -163,6 +418,67 @@ func TestGetAllProducts(t *testing.T) {
 	// Проверяем результат
 	assert.NoError(t, err)
 	assert.Equal(t, expectedProducts, resp.Products)
+	assert.Empty(t, resp.NextPageToken)
+}
+
+func TestGetAllProducts_Pagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	price := money.New(600, 0, "RUB")
+	filter := db.ProductFilter{
+		NameContains: "круж",
+		InStockOnly:  true,
+		Sort:         proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_ASC,
+		PageSize:     2,
+	}
+	firstPage := []*proto.Product{{ProductId: 4, Price: price}, {ProductId: 7, Price: price}}
+	cursor := &db.ProductCursor{ProductID: 7, Price: price}
+
+	mockDB.EXPECT().GetAllProducts(filter).Return(firstPage, cursor, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{4, 7}).Return(map[int32][]*proto.Category{}, nil)
+
+	req := &proto.GetAllProductsRequest{
+		PageSize:     2,
+		NameContains: "круж",
+		InStockOnly:  true,
+		SortOrder:    proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_ASC,
+	}
+	resp, err := h.GetAllProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, firstPage, resp.Products)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	// Вторая страница продолжается после последнего товара первой
+	filter.After = cursor
+	mockDB.EXPECT().GetAllProducts(filter).Return(nil, nil, nil)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = h.GetAllProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен нельзя применить к другой сортировке
+	req.SortOrder = proto.ProductSortOrder_PRODUCT_SORT_ORDER_NAME
+	resp, err = h.GetAllProducts(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetAllProducts_InvalidPageToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	resp, err := h.GetAllProducts(context.Background(), &proto.GetAllProductsRequest{PageToken: "not-a-token"})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 }
 
 func TestDeleteProduct(t *testing.T) {
@@ -177,7 +493,7 @@ func TestDeleteProduct(t *testing.T) {
 
 	// Мокируем вызов DeleteProduct
 	mockDB.EXPECT().
-		DeleteProduct(1).
+		DeleteProduct(1, "unknown").
 		Return(nil)
 
 	// Вызов метода DeleteProduct
@@ -199,100 +515,1515 @@ func TestGetProductByID_Error(t *testing.T) {
 	h := NewCatalogHandler(mockDB)
 
 	mockDB.EXPECT().
-		GetProductByID(int32(1)).
-		Return("", 0, 0.0, fmt.Errorf("product not found"))
+		GetProductsByIDs([]int32{1}).
+		Return(nil, nil)
 
 	req := &proto.GetProductByIDRequest{ProductId: 1}
 	resp, err := h.GetProductByID(context.Background(), req)
 
 	assert.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 	assert.Nil(t, resp)
 }
 
 func TestUpdateProduct_GetProductByID_Error(t *testing.T) {
-    ctrl := gomock.NewController(t)
-    defer ctrl.Finish()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-    mockDB := mock.NewMockCatalogDB(ctrl)
-    h := NewCatalogHandler(mockDB)
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
 
-    mockDB.EXPECT().
-        GetProductByID(int32(1)).
-        Return("", 0, 0.0, fmt.Errorf("product not found"))
+	mockDB.EXPECT().
+		GetProductByID(int32(1)).
+		Return("", 0, nil, fmt.Errorf("product not found"))
 
-    req := &proto.UpdateProductRequest{
-        ProductId:     1,
-        ProductName:   "Updated Product",
-        StockQuantity: 20,
-        PricePerUnit:  29.99,
-    }
-    resp, err := h.UpdateProduct(context.Background(), req)
+	req := &proto.UpdateProductRequest{
+		ProductId:     1,
+		ProductName:   "Updated Product",
+		StockQuantity: 20,
+		PricePerUnit:  29.99,
+	}
+	resp, err := h.UpdateProduct(context.Background(), req)
 
-    assert.Error(t, err)
-    assert.Nil(t, resp)
+	assert.Error(t, err)
+	assert.Nil(t, resp)
 }
 
 func TestUpdateProduct_UpdateProduct_Error(t *testing.T) {
-    ctrl := gomock.NewController(t)
-    defer ctrl.Finish()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-    mockDB := mock.NewMockCatalogDB(ctrl)
-    h := NewCatalogHandler(mockDB)
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
 
-    mockDB.EXPECT().
-        GetProductByID(int32(1)).
-        Return("Old Product", 10, 19.99, nil)
+	mockDB.EXPECT().
+		GetProductByID(int32(1)).
+		Return("Old Product", 10, money.New(19, 990000000, "RUB"), nil)
 
-    mockDB.EXPECT().
-        UpdateProduct(1, "Updated Product", 20, 29.99).
-        Return(fmt.Errorf("failed to update product"))
+	mockDB.EXPECT().
+		UpdateProduct(1, "Updated Product", 20, money.New(29, 990000000, "RUB"), "unknown").
+		Return(fmt.Errorf("failed to update product"))
 
-    req := &proto.UpdateProductRequest{
-        ProductId:     1,
-        ProductName:   "Updated Product",
-        StockQuantity: 20,
-        PricePerUnit:  29.99,
-    }
-    resp, err := h.UpdateProduct(context.Background(), req)
+	req := &proto.UpdateProductRequest{
+		ProductId:     1,
+		ProductName:   "Updated Product",
+		StockQuantity: 20,
+		PricePerUnit:  29.99,
+	}
+	resp, err := h.UpdateProduct(context.Background(), req)
 
-    assert.Error(t, err)
-    assert.Nil(t, resp)
+	assert.Error(t, err)
+	assert.Nil(t, resp)
 }
 
 func TestGetAllProducts_Error(t *testing.T) {
-    ctrl := gomock.NewController(t)
-    defer ctrl.Finish()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-    mockDB := mock.NewMockCatalogDB(ctrl)
-    h := NewCatalogHandler(mockDB)
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
 
-    mockDB.EXPECT().
-        GetAllProducts().
-        Return(nil, fmt.Errorf("failed to retrieve products"))
+	mockDB.EXPECT().
+		GetAllProducts(gomock.Any()).
+		Return(nil, nil, fmt.Errorf("failed to retrieve products"))
 
-    req := &proto.GetAllProductsRequest{}
-    resp, err := h.GetAllProducts(context.Background(), req)
+	req := &proto.GetAllProductsRequest{}
+	resp, err := h.GetAllProducts(context.Background(), req)
 
-    assert.Error(t, err)
-    assert.Nil(t, resp)
+	assert.Error(t, err)
+	assert.Nil(t, resp)
 }
 
 func TestDeleteProduct_Error(t *testing.T) {
-    ctrl := gomock.NewController(t)
-    defer ctrl.Finish()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		DeleteProduct(1, "unknown").
+		Return(fmt.Errorf("failed to delete product"))
+
+	req := &proto.DeleteProductRequest{
+		ProductId: 1,
+	}
+	resp, err := h.DeleteProduct(context.Background(), req)
 
-    mockDB := mock.NewMockCatalogDB(ctrl)
-    h := NewCatalogHandler(mockDB)
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+}
+
+// saleMovement движение продажи, которое обработчик передает в базу без метаданных x-actor
+func saleMovement(orderID int32) db.StockMovement {
+	return db.StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE, OrderID: orderID, Actor: "unknown"}
+}
+
+// returnMovement движение возврата, которое обработчик передает в базу без метаданных x-actor
+func returnMovement(orderID int32) db.StockMovement {
+	return db.StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN, OrderID: orderID, Actor: "unknown"}
+}
+
+func TestReserveStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
 
-    mockDB.EXPECT().
-        DeleteProduct(1).
-        Return(fmt.Errorf("failed to delete product"))
+	mockDB.EXPECT().
+		ReserveStock(int32(1), 3, saleMovement(0)).
+		Return(7, int32(2), nil)
 
-    req := &proto.DeleteProductRequest{
-        ProductId: 1,
-    }
-    resp, err := h.DeleteProduct(context.Background(), req)
+	req := &proto.ReserveStockRequest{ProductId: 1, Quantity: 3}
+	resp, err := h.ReserveStock(context.Background(), req)
 
-    assert.Error(t, err)
-    assert.Nil(t, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), resp.StockQuantity)
+	assert.Equal(t, int32(2), resp.WarehouseId)
+}
+
+func TestReserveStock_InsufficientStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		ReserveStock(int32(1), 30, saleMovement(0)).
+		Return(0, int32(0), db.ErrInsufficientStock)
+
+	req := &proto.ReserveStockRequest{ProductId: 1, Quantity: 30}
+	resp, err := h.ReserveStock(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestReserveStock_InvalidQuantity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	req := &proto.ReserveStockRequest{ProductId: 1, Quantity: 0}
+	resp, err := h.ReserveStock(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestReleaseStock_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		ReleaseStock(int32(5), int32(0), 2, "", returnMovement(0)).
+		Return(0, db.ErrProductNotFound)
+
+	req := &proto.ReleaseStockRequest{ProductId: 5, Quantity: 2}
+	resp, err := h.ReleaseStock(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCreateReservation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	items := []*proto.ReservationItem{
+		{ProductId: 1, Quantity: 2},
+		{ProductId: 2, Quantity: 1},
+	}
+	expiresAt := time.Date(2025, 1, 10, 12, 15, 0, 0, time.UTC)
+
+	allocated := []*proto.ReservationItem{
+		{ProductId: 1, Quantity: 2, WarehouseId: 1},
+		{ProductId: 2, Quantity: 1, WarehouseId: 3},
+	}
+
+	mockDB.EXPECT().
+		CreateReservation(items, gomock.Nil(), defaultReservationTTL, saleMovement(0)).
+		Return(&db.Reservation{ReservationID: 7, ExpiresAt: expiresAt, Items: allocated}, nil)
+
+	req := &proto.CreateReservationRequest{Items: items}
+	resp, err := h.CreateReservation(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), resp.ReservationId)
+	assert.Equal(t, "2025-01-10T12:15:00Z", resp.ExpiresAt)
+	assert.Equal(t, allocated, resp.Items)
+}
+
+func TestCreateReservation_InsufficientStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	items := []*proto.ReservationItem{{ProductId: 1, Quantity: 200}}
+
+	mockDB.EXPECT().
+		CreateReservation(items, gomock.Nil(), 30*time.Second, saleMovement(0)).
+		Return(nil, fmt.Errorf("product 1: %w", db.ErrInsufficientStock))
+
+	req := &proto.CreateReservationRequest{Items: items, TtlSeconds: 30}
+	resp, err := h.CreateReservation(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCreateReservation_AllocationErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Остаток разбросан по складам и явно указан выключенный склад: оба случая
+	// отличаются от нехватки товара текстом ошибки
+	for dbErr, message := range map[error]string{
+		db.ErrNoSingleWarehouse: "Товара хватает только на нескольких складах вместе, а позиция списывается с одного склада",
+		db.ErrWarehouseInactive: "Склад не активен",
+	} {
+		items := []*proto.ReservationItem{{ProductId: 1, Quantity: 20, WarehouseId: 2}}
+		mockDB.EXPECT().
+			CreateReservation(items, gomock.Nil(), 30*time.Second, saleMovement(0)).
+			Return(nil, fmt.Errorf("product 1: %w", dbErr))
+
+		resp, err := h.CreateReservation(context.Background(), &proto.CreateReservationRequest{Items: items, TtlSeconds: 30})
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err), dbErr.Error())
+		assert.Equal(t, message, status.Convert(err).Message())
+	}
+}
+
+func TestCreateReservation_NoItems(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	resp, err := h.CreateReservation(context.Background(), &proto.CreateReservationRequest{})
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCommitReservation_NotPending(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		CommitReservation(int32(7)).
+		Return(fmt.Errorf("reservation 7 is expired: %w", db.ErrReservationNotPending))
+
+	req := &proto.CommitReservationRequest{ReservationId: 7}
+	resp, err := h.CommitReservation(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCancelReservation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		CancelReservation(int32(7), "unknown").
+		Return(nil)
+
+	req := &proto.CancelReservationRequest{ReservationId: 7}
+	resp, err := h.CancelReservation(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestReleaseStock_OperationID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Заказ и инициатор из метаданных попадают в журнал движений
+	movement := db.StockMovement{
+		Reason:  proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN,
+		OrderID: 3,
+		Actor:   "order-service",
+	}
+	mockDB.EXPECT().
+		ReleaseStock(int32(5), int32(3), 2, "order-3-cancel-5", movement).
+		Return(12, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-actor", "order-service"))
+	req := &proto.ReleaseStockRequest{ProductId: 5, Quantity: 2, OperationId: "order-3-cancel-5", WarehouseId: 3, OrderId: 3}
+	resp, err := h.ReleaseStock(ctx, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(12), resp.StockQuantity)
+}
+
+// stockStream тестовый поток WatchStock, передающий отправленные изменения в канал
+type stockStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *proto.StockChange
+}
+
+func (s *stockStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stockStream) Send(resp *proto.WatchStockResponse) error {
+	s.sent <- resp.Change
+	return nil
+}
+
+func TestWatchStock_SnapshotThenLiveChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	ids := []int32{2}
+	mockDB.EXPECT().GetStockSnapshot(ids).
+		Return([]*proto.StockChange{{Sequence: 40, ProductId: 2, StockQuantity: 100}}, int64(40), nil)
+	// Журнал читается после подписки на ленту: дальше изменения идут из ленты
+	subscribed := make(chan struct{})
+	mockDB.EXPECT().GetStockChanges(int64(40), ids, stockBatchSize).
+		DoAndReturn(func(int64, []int32, int) ([]*proto.StockChange, error) {
+			close(subscribed)
+			return nil, nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &stockStream{ctx: ctx, sent: make(chan *proto.StockChange, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.WatchStock(&proto.WatchStockRequest{ProductIds: ids}, stream)
+	}()
+
+	assert.Equal(t, int32(100), (<-stream.sent).StockQuantity)
+
+	<-subscribed
+
+	// Уже отправленные и чужие изменения пропускаются
+	h.StockFeed().Publish(&proto.StockChange{Sequence: 39, ProductId: 2})
+	h.StockFeed().Publish(&proto.StockChange{Sequence: 41, ProductId: 4, StockQuantity: 94})
+	h.StockFeed().Publish(&proto.StockChange{Sequence: 42, ProductId: 2, StockQuantity: 97})
+
+	assert.Equal(t, int64(42), (<-stream.sent).Sequence)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, stream.sent)
+}
+
+func TestWatchStock_ResumeReplaysJournal(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	missed := []*proto.StockChange{
+		{Sequence: 13, ProductId: 1, StockQuantity: 5},
+		{Sequence: 15, ProductId: 3, Deleted: true},
+	}
+	mockDB.EXPECT().StockSequenceRange().Return(int64(3), int64(15), nil)
+	mockDB.EXPECT().GetStockChanges(int64(12), nil, stockBatchSize).Return(missed, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &stockStream{ctx: ctx, sent: make(chan *proto.StockChange, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.WatchStock(&proto.WatchStockRequest{AfterSequence: 12}, stream)
+	}()
+
+	assert.Equal(t, missed[0], <-stream.sent)
+	assert.Equal(t, missed[1], <-stream.sent)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestWatchStock_ResumeOutOfRange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().StockSequenceRange().Return(int64(100), int64(150), nil).Times(2)
+
+	stream := &stockStream{ctx: context.Background(), sent: make(chan *proto.StockChange, 10)}
+
+	err := h.WatchStock(&proto.WatchStockRequest{AfterSequence: 50}, stream)
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	err = h.WatchStock(&proto.WatchStockRequest{AfterSequence: 151}, stream)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetProductsByIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	products := []*proto.Product{
+		{ProductId: 2, ProductName: "Чайник", StockQuantity: 100, Price: money.New(4700, 0, "RUB")},
+		{ProductId: 4, ProductName: "Кружка", StockQuantity: 94, Price: money.New(600, 0, "RUB")},
+	}
+	// Повторы убираются до запроса к базе, порядок запроса сохраняется
+	mockDB.EXPECT().GetProductsByIDs([]int32{4, 9, 2, 7}).Return(products, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{2, 4}).Return(map[int32][]*proto.Category{}, nil)
+	mockDB.EXPECT().GetProductVariants([]int32{2, 4}).Return(map[int32][]*proto.Product{}, nil)
+	mockDB.EXPECT().
+		GetEffectivePrices([]int32{2, 4}, gomock.Any()).
+		Return(map[int32]*proto.Money{2: money.New(4700, 0, "RUB"), 4: money.New(600, 0, "RUB")}, nil)
+
+	resp, err := h.GetProductsByIDs(context.Background(), &proto.GetProductsByIDsRequest{ProductIds: []int32{4, 9, 4, 2, 7}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, products, resp.Products)
+	assert.Equal(t, []int32{9, 7}, resp.MissingProductIds)
+}
+
+func TestGetProductsByIDs_ScheduledPriceDue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Распродажа уже началась, но фоновая задача еще не перенесла цену в Catalog
+	products := []*proto.Product{{ProductId: 2, ProductName: "Чайник", PricePerUnit: 4700, Price: money.New(4700, 0, "RUB")}}
+	mockDB.EXPECT().GetProductsByIDs([]int32{2}).Return(products, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{2}).Return(map[int32][]*proto.Category{}, nil)
+	mockDB.EXPECT().GetProductVariants([]int32{2}).Return(map[int32][]*proto.Product{}, nil)
+	mockDB.EXPECT().
+		GetEffectivePrices([]int32{2}, gomock.Any()).
+		DoAndReturn(func(ids []int32, at time.Time) (map[int32]*proto.Money, error) {
+			assert.WithinDuration(t, time.Now(), at, time.Minute)
+			return map[int32]*proto.Money{2: money.New(3990, 0, "RUB")}, nil
+		})
+
+	resp, err := h.GetProductsByIDs(context.Background(), &proto.GetProductsByIDsRequest{ProductIds: []int32{2}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "3990", money.String(resp.Products[0].Price))
+	assert.Equal(t, float64(3990), resp.Products[0].PricePerUnit)
+}
+
+func TestGetProductsByIDs_InvalidArgument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	tooMany := make([]int32, maxProductsByIDs+1)
+	for i := range tooMany {
+		tooMany[i] = int32(i + 1)
+	}
+
+	for _, ids := range [][]int32{nil, {1, 0}, tooMany} {
+		resp, err := h.GetProductsByIDs(context.Background(), &proto.GetProductsByIDsRequest{ProductIds: ids})
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestCreateCategory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	kitchen := &proto.Category{CategoryId: 3, Name: "Кухня", ParentId: 1, Path: "Дом / Кухня"}
+	mockDB.EXPECT().CreateCategory("Кухня", int32(1)).Return(kitchen, nil)
+
+	resp, err := h.CreateCategory(context.Background(), &proto.CreateCategoryRequest{Name: " Кухня ", ParentId: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, kitchen, resp.Category)
+
+	// Пустое название отклоняется без запроса к базе
+	resp, err = h.CreateCategory(context.Background(), &proto.CreateCategoryRequest{Name: "  "})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	mockDB.EXPECT().CreateCategory("Кухня", int32(1)).Return(nil, db.ErrCategoryExists)
+	resp, err = h.CreateCategory(context.Background(), &proto.CreateCategoryRequest{Name: "Кухня", ParentId: 1})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestUpdateCategory_Cycle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	parentID := int32(3)
+	mockDB.EXPECT().
+		UpdateCategory(int32(1), db.CategoryUpdate{ParentID: &parentID}).
+		Return(nil, db.ErrCategoryCycle)
+
+	resp, err := h.UpdateCategory(context.Background(), &proto.UpdateCategoryRequest{
+		CategoryId: 1,
+		ParentId:   3,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"parent_id"}},
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestDeleteCategory_HasChildren(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().DeleteCategory(int32(1)).Return(db.ErrCategoryHasChildren)
+
+	resp, err := h.DeleteCategory(context.Background(), &proto.DeleteCategoryRequest{CategoryId: 1})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestSetProductCategories(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	categories := []*proto.Category{
+		{CategoryId: 3, Name: "Кухня", ParentId: 1, Path: "Дом / Кухня"},
+		{CategoryId: 5, Name: "Подарки", Path: "Подарки"},
+	}
+	mockDB.EXPECT().SetProductCategories(int32(4), []int32{3, 5}).Return(nil)
+	mockDB.EXPECT().GetProductCategories([]int32{4}).Return(map[int32][]*proto.Category{4: categories}, nil)
+
+	resp, err := h.SetProductCategories(context.Background(), &proto.SetProductCategoriesRequest{ProductId: 4, CategoryIds: []int32{3, 5, 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, categories, resp.Categories)
+
+	mockDB.EXPECT().SetProductCategories(int32(4), []int32{8}).Return(db.ErrCategoryNotFound)
+	resp, err = h.SetProductCategories(context.Background(), &proto.SetProductCategoriesRequest{ProductId: 4, CategoryIds: []int32{8}})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGetAllProducts_CategoryFilter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().
+		GetAllProducts(db.ProductFilter{CategoryID: 1, PageSize: 50}).
+		Return(nil, nil, nil)
+
+	resp, err := h.GetAllProducts(context.Background(), &proto.GetAllProductsRequest{CategoryId: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Products)
+
+	resp, err = h.GetAllProducts(context.Background(), &proto.GetAllProductsRequest{CategoryId: -1})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetProductsByIDs_SKUs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	red := &proto.Product{ProductId: 8, ProductName: "Чайник (красный)", ParentProductId: 2, Sku: "KT-RED"}
+	kettle := &proto.Product{ProductId: 2, ProductName: "Чайник"}
+	mockDB.EXPECT().GetProductsByIDs([]int32{8, 2}).Return([]*proto.Product{kettle, red}, nil)
+	// Вариант 8 запрошен и по ID, и по артикулу, но возвращается один раз
+	mockDB.EXPECT().GetProductsBySKUs([]string{"KT-RED", "KT-BLUE"}).Return([]*proto.Product{red}, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{2, 8}).Return(map[int32][]*proto.Category{}, nil)
+	// Варианты запрашиваются только для товаров, которые сами не варианты
+	mockDB.EXPECT().GetProductVariants([]int32{2}).Return(map[int32][]*proto.Product{2: {red}}, nil)
+	mockDB.EXPECT().
+		GetEffectivePrices([]int32{2, 8, 8}, gomock.Any()).
+		Return(map[int32]*proto.Money{2: money.New(4700, 0, "RUB"), 8: money.New(4900, 0, "RUB")}, nil)
+
+	resp, err := h.GetProductsByIDs(context.Background(), &proto.GetProductsByIDsRequest{
+		ProductIds: []int32{8, 2},
+		Skus:       []string{"KT-RED", "KT-BLUE", "KT-RED"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []*proto.Product{kettle, red}, resp.Products)
+	assert.Equal(t, []*proto.Product{red}, kettle.Variants)
+	assert.Empty(t, resp.MissingProductIds)
+	assert.Equal(t, []string{"KT-BLUE"}, resp.MissingSkus)
+}
+
+func TestAddProductVariant(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().AddProductVariant(gomock.Any()).DoAndReturn(func(variant db.ProductVariant) (int32, error) {
+		// Артикул и атрибуты приходят в базу без лишних пробелов
+		assert.Equal(t, int32(2), variant.ParentProductID)
+		assert.Equal(t, "KT-RED-17", variant.SKU)
+		assert.Equal(t, map[string]string{"color": "красный", "volume": "1.7 л"}, variant.Attributes)
+		assert.Empty(t, variant.ProductName)
+		assert.Equal(t, 10, variant.StockQuantity)
+		assert.Equal(t, "5900", money.String(variant.Price))
+		return 8, nil
+	})
+
+	resp, err := h.AddProductVariant(context.Background(), &proto.AddProductVariantRequest{
+		ParentProductId:   2,
+		Sku:               " KT-RED-17 ",
+		VariantAttributes: map[string]string{"color": "красный", " volume ": "1.7 л"},
+		StockQuantity:     10,
+		Price:             money.New(5900, 0, "RUB"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8), resp.ProductId)
+}
+
+func TestAddProductVariant_Errors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	valid := func() *proto.AddProductVariantRequest {
+		return &proto.AddProductVariantRequest{
+			ParentProductId:   2,
+			Sku:               "KT-RED",
+			VariantAttributes: map[string]string{"color": "красный"},
+			Price:             money.New(5900, 0, "RUB"),
+		}
+	}
+
+	// Некорректные запросы отклоняются без обращения к базе
+	noSKU := valid()
+	noSKU.Sku = "KT RED"
+	noAttributes := valid()
+	noAttributes.VariantAttributes = nil
+	noPrice := valid()
+	noPrice.Price = nil
+	for _, req := range []*proto.AddProductVariantRequest{noSKU, noAttributes, noPrice} {
+		resp, err := h.AddProductVariant(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	for dbErr, code := range map[error]codes.Code{
+		db.ErrProductNotFound:  codes.NotFound,
+		db.ErrProductIsVariant: codes.FailedPrecondition,
+		db.ErrParentHasStock:   codes.FailedPrecondition,
+		db.ErrSKUExists:        codes.AlreadyExists,
+		db.ErrVariantExists:    codes.AlreadyExists,
+	} {
+		mockDB.EXPECT().AddProductVariant(gomock.Any()).Return(int32(0), dbErr)
+		resp, err := h.AddProductVariant(context.Background(), valid())
+		assert.Nil(t, resp)
+		assert.Equal(t, code, status.Code(err), dbErr.Error())
+	}
+}
+
+func TestReserveStock_ProductHasVariants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	mockDB.EXPECT().ReserveStock(int32(2), 1, saleMovement(0)).Return(0, int32(0), db.ErrProductHasVariants)
+
+	resp, err := h.ReserveStock(context.Background(), &proto.ReserveStockRequest{ProductId: 2, Quantity: 1})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestAddProduct_Attributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	attributes, err := structpb.NewStruct(map[string]interface{}{"wattage": 2200, "material": "сталь", "auto_off": true})
+	assert.NoError(t, err)
+	mockDB.EXPECT().
+		AddProduct("Чайник", 100, gomock.Any(), map[string]interface{}{"wattage": 2200.0, "material": "сталь", "auto_off": true}, "", "", "unknown").
+		Return(2, nil)
+
+	resp, err := h.AddProduct(context.Background(), &proto.AddProductRequest{
+		ProductName:   "Чайник",
+		StockQuantity: 100,
+		Price:         money.New(5700, 0, "RUB"),
+		Attributes:    attributes,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), resp.ProductId)
+
+	// Вложенные объекты и списки не поддерживаются
+	nested, err := structpb.NewStruct(map[string]interface{}{"size": map[string]interface{}{"h": 20}})
+	assert.NoError(t, err)
+	resp, err = h.AddProduct(context.Background(), &proto.AddProductRequest{
+		ProductName: "Чайник",
+		Price:       money.New(5700, 0, "RUB"),
+		Attributes:  nested,
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateProduct_FieldMaskAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Маска без характеристик в запросе очищает их
+	mockDB.EXPECT().
+		UpdateProductFields(int32(2), db.ProductUpdate{Attributes: map[string]interface{}{}, Actor: "unknown"}).
+		Return(nil)
+
+	resp, err := h.UpdateProduct(context.Background(), &proto.UpdateProductRequest{
+		ProductId:  2,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"attributes"}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestGetAllProducts_AttributeFilters(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	minWattage, maxWattage := 1500.0, 2500.0
+	mockDB.EXPECT().
+		GetAllProducts(db.ProductFilter{
+			Attributes: []db.AttributeFilter{
+				{Key: "material", Equals: "сталь"},
+				{Key: "wattage", Min: &minWattage, Max: &maxWattage},
+			},
+			PageSize: 50,
+		}).
+		Return(nil, nil, nil)
+
+	resp, err := h.GetAllProducts(context.Background(), &proto.GetAllProductsRequest{
+		AttributeFilters: []*proto.AttributeFilter{
+			{Key: "material", Equals: structpb.NewStringValue("сталь")},
+			{Key: "wattage", Min: wrapperspb.Double(1500), Max: wrapperspb.Double(2500)},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Products)
+
+	// Условие без значения и перевернутый диапазон отклоняются
+	for _, filter := range []*proto.AttributeFilter{
+		{Key: "wattage"},
+		{Key: "wattage", Min: wrapperspb.Double(2500), Max: wrapperspb.Double(1500)},
+		{Key: "", Equals: structpb.NewBoolValue(true)},
+	} {
+		resp, err = h.GetAllProducts(context.Background(), &proto.GetAllProductsRequest{
+			AttributeFilters: []*proto.AttributeFilter{filter},
+		})
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestSearchProducts_Pagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	glass := &proto.ProductSearchResult{
+		Product: &proto.Product{ProductId: 7, ProductName: "Чайник стеклянный"},
+		Rank:    0.6,
+		Snippet: "<b>Чайник</b> <b>стеклянный</b>",
+	}
+	cursor := &db.SearchCursor{Rank: 0.6, ProductID: 7}
+	filter := db.SearchFilter{Query: "чайник стеклянный", InStockOnly: true, PageSize: 1}
+	mockDB.EXPECT().SearchProducts(filter).Return([]*proto.ProductSearchResult{glass}, cursor, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{7}).Return(map[int32][]*proto.Category{}, nil)
+
+	req := &proto.SearchProductsRequest{Query: "  чайник стеклянный ", PageSize: 1, InStockOnly: true}
+	resp, err := h.SearchProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, []*proto.ProductSearchResult{glass}, resp.Results)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	// Следующая страница продолжается после последнего результата
+	filter.After = cursor
+	mockDB.EXPECT().SearchProducts(filter).Return(nil, nil, nil)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = h.SearchProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Results)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен нельзя применить к другой фразе
+	req.Query = "кружка"
+	resp, err = h.SearchProducts(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSearchProducts_InvalidArgument(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	for _, req := range []*proto.SearchProductsRequest{
+		{Query: "   "},
+		{Query: strings.Repeat("я", maxSearchQueryLength+1)},
+		{Query: "чайник", PageSize: -1},
+		{Query: "чайник", PageToken: "не-токен"},
+	} {
+		resp, err := h.SearchProducts(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestCreateReservation_NearestAllocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	items := []*proto.ReservationItem{{ProductId: 1, Quantity: 2}}
+	allocation := &proto.Allocation{
+		Strategy:    proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST,
+		Destination: &proto.GeoPoint{Latitude: 55.75, Longitude: 37.62},
+	}
+	mockDB.EXPECT().
+		CreateReservation(items, allocation, defaultReservationTTL, saleMovement(0)).
+		Return(&db.Reservation{
+			ReservationID: 7,
+			Items:         []*proto.ReservationItem{{ProductId: 1, Quantity: 2, WarehouseId: 2}},
+		}, nil)
+
+	req := &proto.CreateReservationRequest{Items: items, Allocation: allocation}
+	resp, err := h.CreateReservation(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), resp.Items[0].WarehouseId)
+}
+
+func TestCreateReservation_InvalidAllocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	items := []*proto.ReservationItem{{ProductId: 1, Quantity: 2}}
+	for _, req := range []*proto.CreateReservationRequest{
+		// Для NEAREST нужна точка доставки
+		{Items: items, Allocation: &proto.Allocation{Strategy: proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST}},
+		{Items: items, Allocation: &proto.Allocation{
+			Strategy:    proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST,
+			Destination: &proto.GeoPoint{Latitude: 91},
+		}},
+		{Items: items, Allocation: &proto.Allocation{Strategy: 42}},
+		// Один товар нельзя списать с двух складов
+		{Items: []*proto.ReservationItem{
+			{ProductId: 1, Quantity: 1, WarehouseId: 1},
+			{ProductId: 1, Quantity: 1, WarehouseId: 2},
+		}},
+	} {
+		resp, err := h.CreateReservation(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+func TestCreateWarehouse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	location := &proto.GeoPoint{Latitude: 55.79, Longitude: 49.12}
+	kazan := &proto.Warehouse{WarehouseId: 2, Name: "Казань", Priority: 10, Location: location, Active: true}
+	mockDB.EXPECT().
+		CreateWarehouse("Казань", int32(10), location, true).
+		Return(kazan, nil)
+	mockDB.EXPECT().
+		CreateWarehouse("Казань", int32(0), nil, true).
+		Return(nil, db.ErrWarehouseExists)
+
+	resp, err := h.CreateWarehouse(context.Background(), &proto.CreateWarehouseRequest{
+		Name: " Казань ", Priority: 10, Location: location,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, kazan, resp.Warehouse)
+
+	resp, err = h.CreateWarehouse(context.Background(), &proto.CreateWarehouseRequest{Name: "Казань"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	resp, err = h.CreateWarehouse(context.Background(), &proto.CreateWarehouseRequest{Name: "  "})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateWarehouse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	inactive := false
+	mockDB.EXPECT().
+		UpdateWarehouse(int32(2), db.WarehouseUpdate{Active: &inactive, MakeDefault: true, UpdateLocation: true}).
+		Return(&proto.Warehouse{WarehouseId: 2, Name: "Казань", IsDefault: true}, nil)
+
+	resp, err := h.UpdateWarehouse(context.Background(), &proto.UpdateWarehouseRequest{
+		WarehouseId: 2,
+		IsDefault:   true,
+		UpdateMask:  &fieldmaskpb.FieldMask{Paths: []string{"active", "is_default", "location"}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Warehouse.IsDefault)
+
+	// Склад по умолчанию нельзя просто снять - только передать другому складу
+	resp, err = h.UpdateWarehouse(context.Background(), &proto.UpdateWarehouseRequest{
+		WarehouseId: 1,
+		UpdateMask:  &fieldmaskpb.FieldMask{Paths: []string{"is_default"}},
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAdjustWarehouseStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	restock := db.StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK, Actor: "unknown"}
+	adjustment := db.StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT, Actor: "unknown"}
+	mockDB.EXPECT().AdjustWarehouseStock(int32(1), int32(2), 5, restock).Return(8, 20, nil)
+	mockDB.EXPECT().AdjustWarehouseStock(int32(1), int32(2), -30, adjustment).Return(0, 0, db.ErrInsufficientStock)
+	mockDB.EXPECT().AdjustWarehouseStock(int32(1), int32(9), 1, restock).Return(0, 0, db.ErrWarehouseNotFound)
+
+	resp, err := h.AdjustWarehouseStock(context.Background(), &proto.AdjustWarehouseStockRequest{ProductId: 1, WarehouseId: 2, Delta: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(8), resp.WarehouseQuantity)
+	assert.Equal(t, int32(20), resp.StockQuantity)
+
+	resp, err = h.AdjustWarehouseStock(context.Background(), &proto.AdjustWarehouseStockRequest{ProductId: 1, WarehouseId: 2, Delta: -30})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	resp, err = h.AdjustWarehouseStock(context.Background(), &proto.AdjustWarehouseStockRequest{ProductId: 1, WarehouseId: 9, Delta: 1})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = h.AdjustWarehouseStock(context.Background(), &proto.AdjustWarehouseStockRequest{ProductId: 1, WarehouseId: 2})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAdjustWarehouseStock_Reason(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Возврат покупателя оприходуется с причиной RETURN и инициатором из метаданных
+	mockDB.EXPECT().
+		AdjustWarehouseStock(int32(1), int32(2), 3, db.StockMovement{
+			Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN,
+			Actor:  "manager:7",
+		}).
+		Return(3, 13, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-actor", "manager:7"))
+	resp, err := h.AdjustWarehouseStock(ctx, &proto.AdjustWarehouseStockRequest{
+		ProductId: 1, WarehouseId: 2, Delta: 3, Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(13), resp.StockQuantity)
+
+	invalid := []*proto.AdjustWarehouseStockRequest{
+		// Поступление не может уменьшать остаток
+		{ProductId: 1, WarehouseId: 2, Delta: -1, Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK},
+		// Продажа проводится только через резерв
+		{ProductId: 1, WarehouseId: 2, Delta: -1, Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE},
+		{ProductId: 1, WarehouseId: 2, Delta: 1, Reason: proto.StockMovementReason(42)},
+	}
+	for _, req := range invalid {
+		resp, err := h.AdjustWarehouseStock(ctx, req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "reason %v", req.Reason)
+	}
+}
+
+func TestListStockMovements(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	sale := proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE
+	first := []*proto.StockMovement{
+		{MovementId: 40, ProductId: 1, WarehouseId: 2, Delta: -2, Reason: sale, OrderId: 5, Actor: "order-service"},
+		{MovementId: 31, ProductId: 1, WarehouseId: 2, Delta: -1, Reason: sale, OrderId: 4, Actor: "order-service"},
+	}
+	mockDB.EXPECT().
+		ListStockMovements(db.StockMovementFilter{ProductID: 1, Reasons: []proto.StockMovementReason{sale}, PageSize: 2}).
+		Return(first, int64(31), nil)
+	mockDB.EXPECT().
+		ListStockMovements(db.StockMovementFilter{ProductID: 1, Reasons: []proto.StockMovementReason{sale}, PageSize: 2, Before: 31}).
+		Return(nil, int64(0), nil)
+
+	req := &proto.ListStockMovementsRequest{ProductId: 1, Reasons: []proto.StockMovementReason{sale}, PageSize: 2}
+	resp, err := h.ListStockMovements(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, first, resp.Movements)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = h.ListStockMovements(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Movements)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен, выданный для одного товара, нельзя применить к другому
+	req.ProductId = 2
+	resp, err = h.ListStockMovements(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListStockMovements_InvalidRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	invalid := []*proto.ListStockMovementsRequest{
+		{ProductId: -1},
+		{OrderId: -1},
+		{PurchaseOrderId: -1},
+		{PageSize: -1},
+		{Reasons: []proto.StockMovementReason{proto.StockMovementReason_STOCK_MOVEMENT_REASON_UNSPECIFIED}},
+		{PageToken: "не токен"},
+	}
+	for _, req := range invalid {
+		resp, err := h.ListStockMovements(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestUpdateProduct_FieldMaskReorderThreshold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	// Нулевой порог по маске: оповещать, только когда товар закончится
+	threshold := int32(0)
+	mockDB.EXPECT().
+		UpdateProductFields(int32(3), db.ProductUpdate{ReorderThreshold: &threshold, Actor: "unknown"}).
+		Return(nil)
+
+	resp, err := h.UpdateProduct(context.Background(), &proto.UpdateProductRequest{
+		ProductId:  3,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"reorder_threshold"}},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	resp, err = h.UpdateProduct(context.Background(), &proto.UpdateProductRequest{
+		ProductId:        3,
+		ReorderThreshold: -1,
+		UpdateMask:       &fieldmaskpb.FieldMask{Paths: []string{"reorder_threshold"}},
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListLowStockProducts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	kettle := &proto.Product{ProductId: 4, ProductName: "Чайник", StockQuantity: 0, ReorderThreshold: 5}
+	cursor := &db.LowStockCursor{StockQuantity: 0, ProductID: 4}
+	filter := db.LowStockFilter{OutOfStockOnly: true, PageSize: 1}
+	mockDB.EXPECT().GetLowStockProducts(filter).Return([]*proto.Product{kettle}, cursor, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{4}).Return(map[int32][]*proto.Category{}, nil)
+
+	req := &proto.ListLowStockProductsRequest{OutOfStockOnly: true, PageSize: 1}
+	resp, err := h.ListLowStockProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, []*proto.Product{kettle}, resp.Products)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	// Следующая страница продолжается после последнего товара
+	filter.After = cursor
+	mockDB.EXPECT().GetLowStockProducts(filter).Return(nil, nil, nil)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = h.ListLowStockProducts(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Products)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен нельзя применить к выборке без фильтра по нулевому остатку
+	req.OutOfStockOnly = false
+	resp, err = h.ListLowStockProducts(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListLowStockProducts_InvalidRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	invalid := []*proto.ListLowStockProductsRequest{
+		{PageSize: -1},
+		{PageToken: "не токен"},
+	}
+	for _, req := range invalid {
+		resp, err := h.ListLowStockProducts(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestCreateSupplier(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	supplier := &proto.Supplier{SupplierId: 1, Name: "ООО Посуда", Email: "sales@posuda.ru"}
+	mockDB.EXPECT().CreateSupplier("ООО Посуда", "sales@posuda.ru", "").Return(supplier, nil)
+	mockDB.EXPECT().CreateSupplier("ООО Посуда", "", "").Return(nil, db.ErrSupplierExists)
+
+	resp, err := h.CreateSupplier(context.Background(), &proto.CreateSupplierRequest{Name: " ООО Посуда ", Email: "sales@posuda.ru"})
+	assert.NoError(t, err)
+	assert.Equal(t, supplier, resp.Supplier)
+
+	resp, err = h.CreateSupplier(context.Background(), &proto.CreateSupplierRequest{Name: "ООО Посуда"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	for _, req := range []*proto.CreateSupplierRequest{{Name: "  "}, {Name: "ООО Посуда", Email: "posuda.ru"}} {
+		resp, err = h.CreateSupplier(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestCreatePurchaseOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	items := []*proto.PurchaseOrderLine{{ProductId: 4, Quantity: 30}}
+	order := &proto.PurchaseOrder{
+		PurchaseOrderId: 7,
+		SupplierId:      1,
+		WarehouseId:     1,
+		Status:          proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_OPEN,
+		Items:           []*proto.PurchaseOrderItem{{ProductId: 4, Quantity: 30}},
+	}
+	mockDB.EXPECT().CreatePurchaseOrder(int32(1), int32(0), items).Return(order, nil)
+	mockDB.EXPECT().CreatePurchaseOrder(int32(2), int32(0), items).Return(nil, db.ErrSupplierNotFound)
+
+	resp, err := h.CreatePurchaseOrder(context.Background(), &proto.CreatePurchaseOrderRequest{SupplierId: 1, Items: items})
+	assert.NoError(t, err)
+	assert.Equal(t, order, resp.PurchaseOrder)
+
+	resp, err = h.CreatePurchaseOrder(context.Background(), &proto.CreatePurchaseOrderRequest{SupplierId: 2, Items: items})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	invalid := []*proto.CreatePurchaseOrderRequest{
+		{Items: items},
+		{SupplierId: 1},
+		{SupplierId: 1, WarehouseId: -1, Items: items},
+		{SupplierId: 1, Items: []*proto.PurchaseOrderLine{{ProductId: 4}}},
+		{SupplierId: 1, Items: []*proto.PurchaseOrderLine{{Quantity: 1}}},
+	}
+	for _, req := range invalid {
+		resp, err := h.CreatePurchaseOrder(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestReceivePurchaseOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-actor", "warehouse:3"))
+
+	// Частичная приемка: пришло 10 из 30
+	items := []*proto.PurchaseOrderLine{{ProductId: 4, Quantity: 10}}
+	order := &proto.PurchaseOrder{
+		PurchaseOrderId: 7,
+		Status:          proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_PARTIALLY_RECEIVED,
+		Items:           []*proto.PurchaseOrderItem{{ProductId: 4, Quantity: 30, ReceivedQuantity: 10}},
+	}
+	mockDB.EXPECT().ReceivePurchaseOrder(int32(7), items, "po-7-1", "warehouse:3").Return(order, nil)
+
+	resp, err := h.ReceivePurchaseOrder(ctx, &proto.ReceivePurchaseOrderRequest{PurchaseOrderId: 7, Items: items, OperationId: "po-7-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, order, resp.PurchaseOrder)
+
+	// Больше заказанного принять нельзя
+	over := []*proto.PurchaseOrderLine{{ProductId: 4, Quantity: 25}}
+	mockDB.EXPECT().
+		ReceivePurchaseOrder(int32(7), over, "", "warehouse:3").
+		Return(nil, fmt.Errorf("product 4: %w", db.ErrReceiptExceedsOrdered))
+
+	resp, err = h.ReceivePurchaseOrder(ctx, &proto.ReceivePurchaseOrderRequest{PurchaseOrderId: 7, Items: over})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Пустой список позиций принимает весь остаток заказа
+	mockDB.EXPECT().
+		ReceivePurchaseOrder(int32(8), nil, "", "unknown").
+		Return(nil, db.ErrPurchaseOrderClosed)
+
+	resp, err = h.ReceivePurchaseOrder(context.Background(), &proto.ReceivePurchaseOrderRequest{PurchaseOrderId: 8})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// Товар удален из каталога после оформления заказа
+	deleted := []*proto.PurchaseOrderLine{{ProductId: 5, Quantity: 3}}
+	mockDB.EXPECT().
+		ReceivePurchaseOrder(int32(7), deleted, "", "warehouse:3").
+		Return(nil, fmt.Errorf("product 5: %w", db.ErrPurchaseOrderProductDeleted))
+
+	resp, err = h.ReceivePurchaseOrder(ctx, &proto.ReceivePurchaseOrderRequest{PurchaseOrderId: 7, Items: deleted})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "удален из каталога")
+
+	resp, err = h.ReceivePurchaseOrder(ctx, &proto.ReceivePurchaseOrderRequest{
+		PurchaseOrderId: 7,
+		Items:           []*proto.PurchaseOrderLine{{ProductId: 4, Quantity: -1}},
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestListPurchaseOrders(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	open := proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_OPEN
+	first := []*proto.PurchaseOrder{{PurchaseOrderId: 9, SupplierId: 1, Status: open}}
+	statuses := []proto.PurchaseOrderStatus{open}
+	mockDB.EXPECT().
+		ListPurchaseOrders(db.PurchaseOrderFilter{SupplierID: 1, Statuses: statuses, PageSize: 1}).
+		Return(first, int32(9), nil)
+	mockDB.EXPECT().
+		ListPurchaseOrders(db.PurchaseOrderFilter{SupplierID: 1, Statuses: statuses, PageSize: 1, Before: 9}).
+		Return(nil, int32(0), nil)
+
+	req := &proto.ListPurchaseOrdersRequest{SupplierId: 1, Statuses: statuses, PageSize: 1}
+	resp, err := h.ListPurchaseOrders(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, first, resp.PurchaseOrders)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = h.ListPurchaseOrders(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.PurchaseOrders)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен нельзя применить к другому поставщику
+	req.SupplierId = 2
+	resp, err = h.ListPurchaseOrders(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	invalid := []*proto.ListPurchaseOrdersRequest{
+		{SupplierId: -1},
+		{PageSize: -1},
+		{Statuses: []proto.PurchaseOrderStatus{proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_UNSPECIFIED}},
+	}
+	for _, req := range invalid {
+		resp, err := h.ListPurchaseOrders(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestGetProductByID_PriceAt(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	at, _ := time.Parse(time.RFC3339, "2025-01-01T00:00:00Z")
+	mockDB.EXPECT().GetProductsByIDs([]int32{1}).Return([]*proto.Product{{ProductId: 1, Price: money.New(10, 0, "RUB")}}, nil)
+	mockDB.EXPECT().GetProductCategories([]int32{1}).Return(map[int32][]*proto.Category{}, nil)
+	mockDB.EXPECT().GetProductVariants([]int32{1}).Return(map[int32][]*proto.Product{}, nil)
+	mockDB.EXPECT().GetStockLevels([]int32{1}).Return(map[int32][]*proto.StockLevel{}, nil)
+	mockDB.EXPECT().GetEffectivePrices([]int32{1}, at).Return(map[int32]*proto.Money{}, nil)
+
+	// До начала истории цен цена товара неизвестна, но сам товар есть
+	resp, err := h.GetProductByID(context.Background(), &proto.GetProductByIDRequest{ProductId: 1, PriceAt: "2025-01-01T00:00:00Z"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.OutOfRange, status.Code(err))
+
+	resp, err = h.GetProductByID(context.Background(), &proto.GetProductByIDRequest{ProductId: 1, PriceAt: "вчера"})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSchedulePriceChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-actor", "marketing"))
+
+	// Распродажа на неделю с завтрашнего дня
+	start := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	end := start.Add(7 * 24 * time.Hour)
+	price := money.New(1499, 0, "RUB")
+	record := &proto.ProductPrice{
+		PriceId:       12,
+		ProductId:     4,
+		Price:         price,
+		EffectiveFrom: start.Format(time.RFC3339),
+		EffectiveTo:   end.Format(time.RFC3339),
+		Actor:         "marketing",
+	}
+	mockDB.EXPECT().SchedulePriceChange(int32(4), price, &start, &end, "marketing").Return(record, nil)
+
+	resp, err := h.SchedulePriceChange(ctx, &proto.SchedulePriceChangeRequest{
+		ProductId:     4,
+		Price:         price,
+		EffectiveFrom: start.Format(time.RFC3339),
+		EffectiveTo:   end.Format(time.RFC3339),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, record, resp.Price)
+
+	// Без effective_from цена меняется сейчас и бессрочно
+	mockDB.EXPECT().
+		SchedulePriceChange(int32(5), price, nil, nil, "unknown").
+		Return(nil, db.ErrProductNotFound)
+
+	resp, err = h.SchedulePriceChange(context.Background(), &proto.SchedulePriceChangeRequest{ProductId: 5, Price: price})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// effective_from чуть в прошлом из-за отстающих часов клиента принимается,
+	// база сдвинет его на текущий момент; effective_to сравнивается с текущим моментом
+	skewed := time.Now().Add(-30 * time.Second).UTC().Truncate(time.Second)
+	mockDB.EXPECT().
+		SchedulePriceChange(int32(4), price, &skewed, nil, "unknown").
+		Return(record, nil)
+
+	resp, err = h.SchedulePriceChange(context.Background(), &proto.SchedulePriceChangeRequest{
+		ProductId:     4,
+		Price:         price,
+		EffectiveFrom: skewed.Format(time.RFC3339),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, record, resp.Price)
+
+	mockDB.EXPECT().
+		SchedulePriceChange(int32(4), price, nil, gomock.Any(), "unknown").
+		Return(nil, db.ErrEmptyPriceInterval)
+
+	resp, err = h.SchedulePriceChange(context.Background(), &proto.SchedulePriceChangeRequest{
+		ProductId:   4,
+		Price:       price,
+		EffectiveTo: time.Now().Add(time.Minute).UTC().Format(time.RFC3339),
+	})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	invalid := []*proto.SchedulePriceChangeRequest{
+		{ProductId: 4},
+		{ProductId: 4, Price: money.New(-1, 0, "RUB")},
+		{ProductId: 4, Price: price, EffectiveFrom: past},
+		{ProductId: 4, Price: price, EffectiveFrom: "завтра"},
+		{ProductId: 4, Price: price, EffectiveFrom: end.Format(time.RFC3339), EffectiveTo: start.Format(time.RFC3339)},
+		{ProductId: 4, Price: price, EffectiveTo: past},
+		{ProductId: 4, Price: price, EffectiveFrom: skewed.Format(time.RFC3339), EffectiveTo: skewed.Add(10 * time.Second).Format(time.RFC3339)},
+	}
+	for _, req := range invalid {
+		resp, err := h.SchedulePriceChange(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "request %v", req)
+	}
+}
+
+func TestGetPriceHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	h := NewCatalogHandler(mockDB)
+
+	history := []*proto.ProductPrice{
+		{PriceId: 1, ProductId: 4, Price: money.New(1999, 0, "RUB"), EffectiveFrom: "2025-01-29T12:00:00Z", EffectiveTo: "2025-02-01T00:00:00Z"},
+		{PriceId: 12, ProductId: 4, Price: money.New(1499, 0, "RUB"), EffectiveFrom: "2025-02-01T00:00:00Z", EffectiveTo: "2025-02-08T00:00:00Z"},
+		{PriceId: 13, ProductId: 4, Price: money.New(1999, 0, "RUB"), EffectiveFrom: "2025-02-08T00:00:00Z"},
+	}
+	mockDB.EXPECT().GetPriceHistory(int32(4)).Return(history, nil)
+	mockDB.EXPECT().GetPriceHistory(int32(9)).Return(nil, db.ErrProductNotFound)
+
+	resp, err := h.GetPriceHistory(context.Background(), &proto.GetPriceHistoryRequest{ProductId: 4})
+	assert.NoError(t, err)
+	assert.Equal(t, history, resp.Prices)
+
+	resp, err = h.GetPriceHistory(context.Background(), &proto.GetPriceHistoryRequest{ProductId: 9})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
 }
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/idempotency"
+	"store/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// lowStockToken содержимое page_token заканчивающихся товаров: ключ последнего товара
+// и отпечаток фильтров, чтобы токен нельзя было применить к другой выборке
+type lowStockToken struct {
+	Filter        string `json:"f"`
+	StockQuantity int32  `json:"stock"`
+	ProductID     int32  `json:"id"`
+}
+
+// ListLowStockProducts возвращает товары с остатком не выше порога дозаказа
+func (h *CatalogHandler) ListLowStockProducts(ctx context.Context, req *proto.ListLowStockProductsRequest) (*proto.ListLowStockProductsResponse, error) {
+	log.Printf("Получен запрос ListLowStockProducts: %v", req)
+
+	filter, err := lowStockFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	products, next, err := h.db.GetLowStockProducts(filter)
+	if err != nil {
+		log.Printf("Ошибка при получении заканчивающихся товаров: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if err := h.withCategories(products...); err != nil {
+		return nil, err
+	}
+
+	var nextPageToken string
+	if next != nil {
+		if nextPageToken, err = encodeLowStockToken(req, next); err != nil {
+			log.Printf("Ошибка при формировании page_token: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
+	return &proto.ListLowStockProductsResponse{
+		Products:      products,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// lowStockFilter проверяет параметры ListLowStockProducts и собирает фильтр для базы
+func lowStockFilter(req *proto.ListLowStockProductsRequest) (db.LowStockFilter, error) {
+	filter := db.LowStockFilter{
+		OutOfStockOnly: req.OutOfStockOnly,
+		PageSize:       int(req.PageSize),
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.PageToken != "" {
+		var err error
+		if filter.After, err = decodeLowStockToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// encodeLowStockToken кодирует курсор следующей страницы
+func encodeLowStockToken(req *proto.ListLowStockProductsRequest, cursor *db.LowStockCursor) (string, error) {
+	fingerprint, err := lowStockFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(lowStockToken{
+		Filter:        fingerprint,
+		StockQuantity: cursor.StockQuantity,
+		ProductID:     cursor.ProductID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeLowStockToken разбирает page_token и проверяет, что он выдан для тех же фильтров
+func decodeLowStockToken(req *proto.ListLowStockProductsRequest) (*db.LowStockCursor, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return nil, invalid
+	}
+	var token lowStockToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, invalid
+	}
+
+	fingerprint, err := lowStockFingerprint(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return nil, status.Errorf(codes.InvalidArgument, "page_token выдан для других фильтров")
+	}
+	return &db.LowStockCursor{StockQuantity: token.StockQuantity, ProductID: token.ProductID}, nil
+}
+
+// lowStockFingerprint отпечаток фильтров без параметров страницы
+func lowStockFingerprint(req *proto.ListLowStockProductsRequest) (string, error) {
+	filter := protobuf.Clone(req).(*proto.ListLowStockProductsRequest)
+	filter.PageSize = 0
+	filter.PageToken = ""
+	return idempotency.RequestHash(filter)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/idempotency"
+	"store/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// movementToken содержимое page_token журнала движений: ID последней записи
+// и отпечаток фильтров, чтобы токен нельзя было применить к другой выборке
+type movementToken struct {
+	Filter     string `json:"f"`
+	MovementID int64  `json:"id"`
+}
+
+// ListStockMovements возвращает журнал движений товара от новых записей к старым
+func (h *CatalogHandler) ListStockMovements(ctx context.Context, req *proto.ListStockMovementsRequest) (*proto.ListStockMovementsResponse, error) {
+	log.Printf("Получен запрос ListStockMovements: %v", req)
+
+	filter, err := movementFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	movements, last, err := h.db.ListStockMovements(filter)
+	if err != nil {
+		log.Printf("Ошибка при получении журнала движений: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	var nextPageToken string
+	if last != 0 {
+		if nextPageToken, err = encodeMovementToken(req, last); err != nil {
+			log.Printf("Ошибка при формировании page_token: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
+	return &proto.ListStockMovementsResponse{
+		Movements:     movements,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// movementFilter проверяет параметры ListStockMovements и собирает фильтр для базы
+func movementFilter(req *proto.ListStockMovementsRequest) (db.StockMovementFilter, error) {
+	filter := db.StockMovementFilter{
+		ProductID:       req.ProductId,
+		WarehouseID:     req.WarehouseId,
+		OrderID:         req.OrderId,
+		PurchaseOrderID: req.PurchaseOrderId,
+		Reasons:         req.Reasons,
+		PageSize:        int(req.PageSize),
+	}
+
+	if req.ProductId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный product_id")
+	}
+	if req.WarehouseId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный warehouse_id")
+	}
+	if req.OrderId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный order_id")
+	}
+	if req.PurchaseOrderId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный purchase_order_id")
+	}
+	for _, reason := range req.Reasons {
+		if _, ok := proto.StockMovementReason_name[int32(reason)]; !ok || reason == proto.StockMovementReason_STOCK_MOVEMENT_REASON_UNSPECIFIED {
+			return filter, status.Errorf(codes.InvalidArgument, "Неизвестная причина движения: %d", reason)
+		}
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.PageToken != "" {
+		var err error
+		if filter.Before, err = decodeMovementToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// encodeMovementToken кодирует ID последней записи страницы в page_token
+func encodeMovementToken(req *proto.ListStockMovementsRequest, movementID int64) (string, error) {
+	fingerprint, err := movementFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(movementToken{Filter: fingerprint, MovementID: movementID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeMovementToken разбирает page_token и проверяет, что он выдан для тех же фильтров
+func decodeMovementToken(req *proto.ListStockMovementsRequest) (int64, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return 0, invalid
+	}
+	var token movementToken
+	if err := json.Unmarshal(data, &token); err != nil || token.MovementID <= 0 {
+		return 0, invalid
+	}
+
+	fingerprint, err := movementFingerprint(req)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return 0, status.Errorf(codes.InvalidArgument, "page_token выдан для других фильтров")
+	}
+	return token.MovementID, nil
+}
+
+// movementFingerprint отпечаток фильтров журнала без параметров страницы
+func movementFingerprint(req *proto.ListStockMovementsRequest) (string, error) {
+	filter := protobuf.Clone(req).(*proto.ListStockMovementsRequest)
+	filter.PageSize = 0
+	filter.PageToken = ""
+	return idempotency.RequestHash(filter)
+}
+
+// actorFromContext возвращает инициатора изменения остатка из метаданных x-actor.
+// Без метаданных инициатор неизвестен
+func actorFromContext(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-actor"); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	db "store/catalog-service/internal/repository"
+	"store/idempotency"
+	"store/money"
+	"store/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultPageSize размер страницы GetAllProducts, если клиент его не указал
+	defaultPageSize = 50
+	// maxPageSize наибольший размер страницы GetAllProducts
+	maxPageSize = 500
+)
+
+// pageToken содержимое page_token. Вместе с ключом последнего товара
+// хранится отпечаток фильтров, чтобы токен нельзя было применить к другой выборке
+type pageToken struct {
+	Filter      string `json:"f"`
+	ProductID   int32  `json:"id"`
+	ProductName string `json:"name,omitempty"`
+	Price       string `json:"price,omitempty"`
+	Currency    string `json:"cur,omitempty"`
+}
+
+// productFilter проверяет параметры GetAllProducts и собирает фильтр для базы
+func productFilter(req *proto.GetAllProductsRequest) (db.ProductFilter, error) {
+	filter := db.ProductFilter{
+		NameContains: req.NameContains,
+		InStockOnly:  req.InStockOnly,
+		CategoryID:   req.CategoryId,
+		Sort:         req.SortOrder,
+		PageSize:     int(req.PageSize),
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.CategoryId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный category_id")
+	}
+	if _, ok := proto.ProductSortOrder_name[int32(req.SortOrder)]; !ok {
+		return filter, status.Errorf(codes.InvalidArgument, "Неизвестный порядок сортировки")
+	}
+
+	var err error
+	if filter.Attributes, err = attributeFilters(req.AttributeFilters); err != nil {
+		return filter, err
+	}
+	if filter.MinPrice, err = filterPrice(req.MinPrice); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = filterPrice(req.MaxPrice); err != nil {
+		return filter, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && filter.MinPrice.CurrencyCode != filter.MaxPrice.CurrencyCode {
+		return filter, status.Errorf(codes.InvalidArgument, "Границы цены должны быть в одной валюте")
+	}
+
+	if req.PageToken != "" {
+		if filter.After, err = decodePageToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// filterPrice проверяет границу цены; валюта по умолчанию - RUB
+func filterPrice(price *proto.Money) (*proto.Money, error) {
+	if price == nil {
+		return nil, nil
+	}
+	if money.Validate(price) != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректная граница цены")
+	}
+	if price.CurrencyCode == "" {
+		return money.New(price.Units, price.Nanos, money.DefaultCurrency), nil
+	}
+	return price, nil
+}
+
+// encodePageToken кодирует курсор следующей страницы
+func encodePageToken(req *proto.GetAllProductsRequest, cursor *db.ProductCursor) (string, error) {
+	fingerprint, err := filterFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	token := pageToken{
+		Filter:      fingerprint,
+		ProductID:   cursor.ProductID,
+		ProductName: cursor.ProductName,
+	}
+	if cursor.Price != nil {
+		token.Price = money.String(cursor.Price)
+		token.Currency = cursor.Price.CurrencyCode
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken разбирает page_token и проверяет, что он выдан для тех же фильтров
+func decodePageToken(req *proto.GetAllProductsRequest) (*db.ProductCursor, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return nil, invalid
+	}
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, invalid
+	}
+
+	fingerprint, err := filterFingerprint(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return nil, status.Errorf(codes.InvalidArgument, "page_token выдан для других фильтров или сортировки")
+	}
+
+	cursor := &db.ProductCursor{
+		ProductID:   token.ProductID,
+		ProductName: token.ProductName,
+	}
+	if token.Price != "" {
+		if cursor.Price, err = money.Parse(token.Price, token.Currency); err != nil {
+			return nil, invalid
+		}
+	}
+	switch req.SortOrder {
+	case proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_ASC, proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_DESC:
+		if cursor.Price == nil {
+			return nil, invalid
+		}
+	}
+	return cursor, nil
+}
+
+// filterFingerprint отпечаток фильтров и сортировки запроса без параметров страницы
+func filterFingerprint(req *proto.GetAllProductsRequest) (string, error) {
+	filters := protobuf.Clone(req).(*proto.GetAllProductsRequest)
+	filters.PageSize = 0
+	filters.PageToken = ""
+	return idempotency.RequestHash(filters)
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/money"
+	"store/proto"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// priceClockSkew насколько effective_from может отставать от часов сервиса:
+// "сейчас" клиента с чуть отстающими часами не считается прошлым, а цена
+// начинает действовать с текущего момента по часам базы
+const priceClockSkew = time.Minute
+
+// SchedulePriceChange назначает цену товара с effective_from до effective_to
+func (h *CatalogHandler) SchedulePriceChange(ctx context.Context, req *proto.SchedulePriceChangeRequest) (*proto.SchedulePriceChangeResponse, error) {
+	log.Printf("Получен запрос SchedulePriceChange: %v", req)
+
+	if req.Price == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Укажите цену")
+	}
+	price, err := requestPrice(req.Price, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var from, to *time.Time
+	if req.EffectiveFrom != "" {
+		t, err := parseTimestamp(req.EffectiveFrom, "effective_from")
+		if err != nil {
+			return nil, err
+		}
+		if t.Before(time.Now().Add(-priceClockSkew)) {
+			return nil, status.Errorf(codes.InvalidArgument, "Цену нельзя изменить в прошлом")
+		}
+		from = &t
+	}
+	if req.EffectiveTo != "" {
+		t, err := parseTimestamp(req.EffectiveTo, "effective_to")
+		if err != nil {
+			return nil, err
+		}
+		// effective_from в прошлом заменяется текущим моментом
+		start := time.Now()
+		if from != nil && from.After(start) {
+			start = *from
+		}
+		if !t.After(start) {
+			return nil, status.Errorf(codes.InvalidArgument, "effective_to должен быть позже effective_from")
+		}
+		to = &t
+	}
+
+	record, err := h.db.SchedulePriceChange(req.ProductId, price, from, to, actorFromContext(ctx))
+	if err != nil {
+		return nil, priceError(err)
+	}
+	return &proto.SchedulePriceChangeResponse{Price: record}, nil
+}
+
+// GetPriceHistory возвращает историю цен товара вместе с запланированными ценами
+func (h *CatalogHandler) GetPriceHistory(ctx context.Context, req *proto.GetPriceHistoryRequest) (*proto.GetPriceHistoryResponse, error) {
+	log.Printf("Получен запрос GetPriceHistory для product_id: %d", req.ProductId)
+
+	prices, err := h.db.GetPriceHistory(req.ProductId)
+	if err != nil {
+		return nil, priceError(err)
+	}
+	return &proto.GetPriceHistoryResponse{Prices: prices}, nil
+}
+
+// withEffectivePrices заменяет цены товаров и их вариантов ценами, действующими в момент at.
+// Товар без цены на этот момент остается без price
+func (h *CatalogHandler) withEffectivePrices(at time.Time, products ...*proto.Product) error {
+	var all []*proto.Product
+	for _, product := range products {
+		all = append(all, product)
+		all = append(all, product.Variants...)
+	}
+	ids := make([]int32, len(all))
+	for i, product := range all {
+		ids[i] = product.ProductId
+	}
+
+	prices, err := h.db.GetEffectivePrices(ids, at)
+	if err != nil {
+		log.Printf("Ошибка при получении цен товаров: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	for _, product := range all {
+		product.Price = prices[product.ProductId]
+		product.PricePerUnit = 0
+		if product.Price != nil {
+			product.PricePerUnit = money.ToFloat(product.Price)
+		}
+	}
+	return nil
+}
+
+// parseTimestamp разбирает момент времени в формате RFC 3339 из поля field
+func parseTimestamp(value, field string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, status.Errorf(codes.InvalidArgument, "Некорректный %s: ожидается RFC 3339", field)
+	}
+	return t, nil
+}
+
+// priceError переводит ошибку работы с ценами в статус gRPC
+func priceError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrProductNotFound):
+		return status.Errorf(codes.NotFound, "Товар не найден")
+	case errors.Is(err, db.ErrEmptyPriceInterval):
+		return status.Errorf(codes.InvalidArgument, "effective_to должен быть позже effective_from")
+	default:
+		log.Printf("Ошибка при работе с ценами: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+}
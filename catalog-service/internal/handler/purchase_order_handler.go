@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/idempotency"
+	"store/proto"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// purchaseOrderToken содержимое page_token заказов поставщикам: ID последнего заказа
+// и отпечаток фильтров, чтобы токен нельзя было применить к другой выборке
+type purchaseOrderToken struct {
+	Filter          string `json:"f"`
+	PurchaseOrderID int32  `json:"id"`
+}
+
+// CreateSupplier добавляет поставщика
+func (h *CatalogHandler) CreateSupplier(ctx context.Context, req *proto.CreateSupplierRequest) (*proto.CreateSupplierResponse, error) {
+	log.Printf("Получен запрос CreateSupplier: %v", req)
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Название поставщика не может быть пустым")
+	}
+	email := strings.TrimSpace(req.Email)
+	if email != "" && !strings.Contains(email, "@") {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный email поставщика")
+	}
+
+	supplier, err := h.db.CreateSupplier(name, email, strings.TrimSpace(req.Phone))
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.CreateSupplierResponse{Supplier: supplier}, nil
+}
+
+// ListSuppliers возвращает поставщиков по названию
+func (h *CatalogHandler) ListSuppliers(ctx context.Context, req *proto.ListSuppliersRequest) (*proto.ListSuppliersResponse, error) {
+	log.Printf("Получен запрос ListSuppliers")
+
+	suppliers, err := h.db.GetSuppliers()
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.ListSuppliersResponse{Suppliers: suppliers}, nil
+}
+
+// CreatePurchaseOrder создает заказ поставщику
+func (h *CatalogHandler) CreatePurchaseOrder(ctx context.Context, req *proto.CreatePurchaseOrderRequest) (*proto.CreatePurchaseOrderResponse, error) {
+	log.Printf("Получен запрос CreatePurchaseOrder: %v", req)
+
+	if req.SupplierId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный supplier_id")
+	}
+	if req.WarehouseId < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный warehouse_id")
+	}
+	if len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Заказ должен содержать хотя бы одну позицию")
+	}
+	if err := validatePurchaseOrderLines(req.Items); err != nil {
+		return nil, err
+	}
+
+	order, err := h.db.CreatePurchaseOrder(req.SupplierId, req.WarehouseId, req.Items)
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.CreatePurchaseOrderResponse{PurchaseOrder: order}, nil
+}
+
+// GetPurchaseOrder возвращает заказ поставщику с позициями
+func (h *CatalogHandler) GetPurchaseOrder(ctx context.Context, req *proto.GetPurchaseOrderRequest) (*proto.GetPurchaseOrderResponse, error) {
+	log.Printf("Получен запрос GetPurchaseOrder для purchase_order_id: %d", req.PurchaseOrderId)
+
+	order, err := h.db.GetPurchaseOrder(req.PurchaseOrderId)
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.GetPurchaseOrderResponse{PurchaseOrder: order}, nil
+}
+
+// ListPurchaseOrders возвращает заказы поставщикам от новых к старым
+func (h *CatalogHandler) ListPurchaseOrders(ctx context.Context, req *proto.ListPurchaseOrdersRequest) (*proto.ListPurchaseOrdersResponse, error) {
+	log.Printf("Получен запрос ListPurchaseOrders: %v", req)
+
+	filter, err := purchaseOrderFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, last, err := h.db.ListPurchaseOrders(filter)
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+
+	var nextPageToken string
+	if last != 0 {
+		if nextPageToken, err = encodePurchaseOrderToken(req, last); err != nil {
+			log.Printf("Ошибка при формировании page_token: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
+	return &proto.ListPurchaseOrdersResponse{
+		PurchaseOrders: orders,
+		NextPageToken:  nextPageToken,
+	}, nil
+}
+
+// ReceivePurchaseOrder принимает товар по заказу поставщику на склад заказа
+func (h *CatalogHandler) ReceivePurchaseOrder(ctx context.Context, req *proto.ReceivePurchaseOrderRequest) (*proto.ReceivePurchaseOrderResponse, error) {
+	log.Printf("Получен запрос ReceivePurchaseOrder: %v", req)
+
+	if err := validatePurchaseOrderLines(req.Items); err != nil {
+		return nil, err
+	}
+
+	order, err := h.db.ReceivePurchaseOrder(req.PurchaseOrderId, req.Items, req.OperationId, actorFromContext(ctx))
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.ReceivePurchaseOrderResponse{PurchaseOrder: order}, nil
+}
+
+// CancelPurchaseOrder отменяет заказ поставщику
+func (h *CatalogHandler) CancelPurchaseOrder(ctx context.Context, req *proto.CancelPurchaseOrderRequest) (*proto.CancelPurchaseOrderResponse, error) {
+	log.Printf("Получен запрос CancelPurchaseOrder для purchase_order_id: %d", req.PurchaseOrderId)
+
+	order, err := h.db.CancelPurchaseOrder(req.PurchaseOrderId)
+	if err != nil {
+		return nil, purchaseOrderError(err)
+	}
+	return &proto.CancelPurchaseOrderResponse{PurchaseOrder: order}, nil
+}
+
+// validatePurchaseOrderLines проверяет позиции заказа или приемки
+func validatePurchaseOrderLines(items []*proto.PurchaseOrderLine) error {
+	for _, item := range items {
+		if item.ProductId <= 0 {
+			return status.Errorf(codes.InvalidArgument, "Некорректный product_id")
+		}
+		if item.Quantity <= 0 {
+			return status.Errorf(codes.InvalidArgument, "Количество должно быть больше нуля")
+		}
+	}
+	return nil
+}
+
+// purchaseOrderFilter проверяет параметры ListPurchaseOrders и собирает фильтр для базы
+func purchaseOrderFilter(req *proto.ListPurchaseOrdersRequest) (db.PurchaseOrderFilter, error) {
+	filter := db.PurchaseOrderFilter{
+		SupplierID: req.SupplierId,
+		Statuses:   req.Statuses,
+		PageSize:   int(req.PageSize),
+	}
+
+	if req.SupplierId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный supplier_id")
+	}
+	for _, s := range req.Statuses {
+		if _, ok := proto.PurchaseOrderStatus_name[int32(s)]; !ok || s == proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_UNSPECIFIED {
+			return filter, status.Errorf(codes.InvalidArgument, "Неизвестный статус заказа поставщику: %d", s)
+		}
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.PageToken != "" {
+		var err error
+		if filter.Before, err = decodePurchaseOrderToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// encodePurchaseOrderToken кодирует ID последнего заказа страницы в page_token
+func encodePurchaseOrderToken(req *proto.ListPurchaseOrdersRequest, purchaseOrderID int32) (string, error) {
+	fingerprint, err := purchaseOrderFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(purchaseOrderToken{Filter: fingerprint, PurchaseOrderID: purchaseOrderID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePurchaseOrderToken разбирает page_token и проверяет, что он выдан для тех же фильтров
+func decodePurchaseOrderToken(req *proto.ListPurchaseOrdersRequest) (int32, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return 0, invalid
+	}
+	var token purchaseOrderToken
+	if err := json.Unmarshal(data, &token); err != nil || token.PurchaseOrderID <= 0 {
+		return 0, invalid
+	}
+
+	fingerprint, err := purchaseOrderFingerprint(req)
+	if err != nil {
+		return 0, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return 0, status.Errorf(codes.InvalidArgument, "page_token выдан для других фильтров")
+	}
+	return token.PurchaseOrderID, nil
+}
+
+// purchaseOrderFingerprint отпечаток фильтров заказов поставщикам без параметров страницы
+func purchaseOrderFingerprint(req *proto.ListPurchaseOrdersRequest) (string, error) {
+	filter := protobuf.Clone(req).(*proto.ListPurchaseOrdersRequest)
+	filter.PageSize = 0
+	filter.PageToken = ""
+	return idempotency.RequestHash(filter)
+}
+
+// purchaseOrderError переводит ошибку работы с поставщиками и их заказами в статус gRPC
+func purchaseOrderError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrSupplierNotFound):
+		return status.Errorf(codes.NotFound, "Поставщик не найден")
+	case errors.Is(err, db.ErrSupplierExists):
+		return status.Errorf(codes.AlreadyExists, "Поставщик с таким названием уже есть")
+	case errors.Is(err, db.ErrPurchaseOrderNotFound):
+		return status.Errorf(codes.NotFound, "Заказ поставщику не найден")
+	case errors.Is(err, db.ErrPurchaseOrderClosed):
+		return status.Errorf(codes.FailedPrecondition, "Заказ поставщику уже принят полностью или отменен")
+	case errors.Is(err, db.ErrProductNotInPurchaseOrder):
+		return status.Errorf(codes.InvalidArgument, "Товара нет в заказе поставщику")
+	case errors.Is(err, db.ErrReceiptExceedsOrdered):
+		return status.Errorf(codes.FailedPrecondition, "Принимается больше, чем осталось принять по заказу")
+	case errors.Is(err, db.ErrPurchaseOrderProductDeleted):
+		return status.Errorf(codes.FailedPrecondition, "Товар из заказа удален из каталога и не может быть принят: примите остальные позиции или отмените заказ")
+	case errors.Is(err, db.ErrIdempotencyKeyMismatch):
+		return status.Errorf(codes.InvalidArgument, "Ключ приемки уже использован для другого заказа")
+	case errors.Is(err, db.ErrProductNotFound):
+		return status.Errorf(codes.NotFound, "Товар не найден")
+	case errors.Is(err, db.ErrProductHasVariants):
+		return status.Errorf(codes.FailedPrecondition, "Товар продается вариантами, укажите вариант")
+	case errors.Is(err, db.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "Склад не найден")
+	default:
+		log.Printf("Ошибка при работе с заказами поставщикам: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+}
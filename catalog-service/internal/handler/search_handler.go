@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/idempotency"
+	"store/proto"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// maxSearchQueryLength наибольшая длина поисковой фразы в символах
+const maxSearchQueryLength = 200
+
+// searchToken содержимое page_token поиска: ключ последнего результата
+// и отпечаток запроса, чтобы токен нельзя было применить к другому поиску
+type searchToken struct {
+	Filter    string  `json:"f"`
+	Rank      float32 `json:"rank"`
+	ProductID int32   `json:"id"`
+}
+
+// SearchProducts ищет товары по словам из названия, артикула и характеристик
+func (h *CatalogHandler) SearchProducts(ctx context.Context, req *proto.SearchProductsRequest) (*proto.SearchProductsResponse, error) {
+	log.Printf("Получен запрос SearchProducts: %q", req.Query)
+
+	filter, err := searchFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	results, cursor, err := h.db.SearchProducts(filter)
+	if err != nil {
+		log.Printf("Ошибка при поиске товаров: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	products := make([]*proto.Product, len(results))
+	for i, result := range results {
+		products[i] = result.Product
+	}
+	if err := h.withCategories(products...); err != nil {
+		return nil, err
+	}
+
+	var nextPageToken string
+	if cursor != nil {
+		if nextPageToken, err = encodeSearchToken(req, cursor); err != nil {
+			log.Printf("Ошибка при формировании page_token: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
+	return &proto.SearchProductsResponse{
+		Results:       results,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// searchFilter проверяет параметры SearchProducts и собирает фильтр для базы
+func searchFilter(req *proto.SearchProductsRequest) (db.SearchFilter, error) {
+	filter := db.SearchFilter{
+		Query:       strings.TrimSpace(req.Query),
+		InStockOnly: req.InStockOnly,
+		PageSize:    int(req.PageSize),
+	}
+
+	if filter.Query == "" {
+		return filter, status.Errorf(codes.InvalidArgument, "Поисковая фраза не может быть пустой")
+	}
+	if utf8.RuneCountInString(filter.Query) > maxSearchQueryLength {
+		return filter, status.Errorf(codes.InvalidArgument, "Поисковая фраза не длиннее %d символов", maxSearchQueryLength)
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.PageToken != "" {
+		var err error
+		if filter.After, err = decodeSearchToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// encodeSearchToken кодирует курсор следующей страницы поиска
+func encodeSearchToken(req *proto.SearchProductsRequest, cursor *db.SearchCursor) (string, error) {
+	fingerprint, err := searchFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(searchToken{
+		Filter:    fingerprint,
+		Rank:      cursor.Rank,
+		ProductID: cursor.ProductID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeSearchToken разбирает page_token и проверяет, что он выдан для того же поиска
+func decodeSearchToken(req *proto.SearchProductsRequest) (*db.SearchCursor, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return nil, invalid
+	}
+	var token searchToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, invalid
+	}
+
+	fingerprint, err := searchFingerprint(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return nil, status.Errorf(codes.InvalidArgument, "page_token выдан для другого поискового запроса")
+	}
+	return &db.SearchCursor{Rank: token.Rank, ProductID: token.ProductID}, nil
+}
+
+// searchFingerprint отпечаток поискового запроса без параметров страницы
+func searchFingerprint(req *proto.SearchProductsRequest) (string, error) {
+	search := protobuf.Clone(req).(*proto.SearchProductsRequest)
+	search.Query = strings.TrimSpace(search.Query)
+	search.PageSize = 0
+	search.PageToken = ""
+	return idempotency.RequestHash(search)
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"log"
+	"store/proto"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// stockFeedInterval как часто лента WatchStock проверяет журнал изменений остатков
+	stockFeedInterval = 500 * time.Millisecond
+	// stockBatchSize сколько изменений читается из журнала за один запрос
+	stockBatchSize = 500
+	// stockWatchBuffer сколько изменений может ждать одного подписчика WatchStock
+	stockWatchBuffer = 256
+)
+
+// WatchStock передает изменения остатков. Без after_sequence сначала отправляются
+// текущие остатки, с after_sequence - все изменения после этой позиции журнала.
+// Дальше поток получает новые изменения, пока клиент не отключится
+func (h *CatalogHandler) WatchStock(req *proto.WatchStockRequest, stream proto.ProductService_WatchStockServer) error {
+	log.Printf("Получен запрос WatchStock для product_ids: %v, after_sequence: %d", req.ProductIds, req.AfterSequence)
+
+	for _, id := range req.ProductIds {
+		if id <= 0 {
+			return status.Errorf(codes.InvalidArgument, "Некорректный product_id: %d", id)
+		}
+	}
+
+	last := req.AfterSequence
+	switch {
+	case last < 0:
+		return status.Errorf(codes.InvalidArgument, "after_sequence не может быть отрицательным")
+	case last == 0:
+		snapshot, sequence, err := h.db.GetStockSnapshot(req.ProductIds)
+		if err != nil {
+			log.Printf("Ошибка при получении остатков: %v", err)
+			return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		for _, change := range snapshot {
+			if err := stream.Send(&proto.WatchStockResponse{Change: change}); err != nil {
+				return err
+			}
+		}
+		last = sequence
+	default:
+		oldest, latest, err := h.db.StockSequenceRange()
+		if err != nil {
+			log.Printf("Ошибка при чтении журнала изменений остатков: %v", err)
+			return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		if last > latest {
+			return status.Errorf(codes.InvalidArgument, "Позиция %d еще не существует", last)
+		}
+		if last < oldest-1 {
+			return status.Errorf(codes.OutOfRange, "Изменения после позиции %d уже удалены, перечитайте остатки без after_sequence", last)
+		}
+	}
+
+	for {
+		// Подписываемся до чтения журнала, чтобы не пропустить изменения между ними
+		updates, unsubscribe := h.stock.Subscribe(req.ProductIds)
+		var err error
+		last, err = h.replayStock(req.ProductIds, last, stream)
+		if err != nil {
+			unsubscribe()
+			return err
+		}
+
+		last, err = forwardStock(updates, last, stream)
+		unsubscribe()
+		if err != nil {
+			return err
+		}
+		// Канал закрыт, потому что клиент отстал: дочитываем пропущенное из журнала
+		log.Printf("Подписчик WatchStock отстал на позиции %d, дочитываем журнал", last)
+	}
+}
+
+// replayStock отправляет изменения из журнала после позиции last и возвращает последнюю отправленную
+func (h *CatalogHandler) replayStock(productIDs []int32, last int64, stream proto.ProductService_WatchStockServer) (int64, error) {
+	for {
+		changes, err := h.db.GetStockChanges(last, productIDs, stockBatchSize)
+		if err != nil {
+			log.Printf("Ошибка при чтении журнала изменений остатков: %v", err)
+			return last, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		for _, change := range changes {
+			if err := stream.Send(&proto.WatchStockResponse{Change: change}); err != nil {
+				return last, err
+			}
+			last = change.Sequence
+		}
+		if len(changes) < stockBatchSize {
+			return last, nil
+		}
+	}
+}
+
+// forwardStock отправляет изменения из ленты, пропуская уже отправленные из журнала.
+// Возвращает nil, когда лента закрыла канал, и ошибку, когда клиент отключился
+func forwardStock(updates <-chan *proto.StockChange, last int64, stream proto.ProductService_WatchStockServer) (int64, error) {
+	for {
+		select {
+		case <-stream.Context().Done():
+			return last, stream.Context().Err()
+		case change, ok := <-updates:
+			if !ok {
+				return last, nil
+			}
+			if change.Sequence <= last {
+				continue
+			}
+			if err := stream.Send(&proto.WatchStockResponse{Change: change}); err != nil {
+				return last, err
+			}
+			last = change.Sequence
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/proto"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxSKULength наибольшая длина артикула (VARCHAR(64) в Catalog)
+const maxSKULength = 64
+
+// AddProductVariant добавляет вариант товара со своим артикулом, остатком и ценой
+func (h *CatalogHandler) AddProductVariant(ctx context.Context, req *proto.AddProductVariantRequest) (*proto.AddProductVariantResponse, error) {
+	log.Printf("Получен запрос AddProductVariant: %v", req)
+
+	if req.ParentProductId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный parent_product_id")
+	}
+	sku := strings.TrimSpace(req.Sku)
+	if sku == "" || len(sku) > maxSKULength || strings.ContainsAny(sku, " \t\n") {
+		return nil, status.Errorf(codes.InvalidArgument, "Артикул должен быть непустым, без пробелов и не длиннее %d символов", maxSKULength)
+	}
+	if len(req.VariantAttributes) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Вариант должен отличаться хотя бы одним атрибутом")
+	}
+	attributes := make(map[string]string, len(req.VariantAttributes))
+	for key, value := range req.VariantAttributes {
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "" || value == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Название и значение атрибута не могут быть пустыми")
+		}
+		attributes[key] = value
+	}
+	if req.StockQuantity < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Остаток не может быть отрицательным")
+	}
+	if req.Price == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Укажите цену варианта")
+	}
+	price, err := requestPrice(req.Price, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	productID, err := h.db.AddProductVariant(db.ProductVariant{
+		ParentProductID: req.ParentProductId,
+		SKU:             sku,
+		Attributes:      attributes,
+		ProductName:     strings.TrimSpace(req.ProductName),
+		StockQuantity:   int(req.StockQuantity),
+		Price:           price,
+		Actor:           actorFromContext(ctx),
+	})
+	switch {
+	case errors.Is(err, db.ErrProductNotFound):
+		return nil, status.Errorf(codes.NotFound, "Товар не найден")
+	case errors.Is(err, db.ErrProductIsVariant):
+		return nil, status.Errorf(codes.FailedPrecondition, "Вариант можно добавить только к товару, а не к другому варианту")
+	case errors.Is(err, db.ErrParentHasStock):
+		return nil, status.Errorf(codes.FailedPrecondition, "У товара есть остаток или неподтвержденные резервы: спишите остаток и дождитесь резервов, прежде чем добавлять варианты")
+	case errors.Is(err, db.ErrSKUExists):
+		return nil, status.Errorf(codes.AlreadyExists, "Артикул %s уже занят", sku)
+	case errors.Is(err, db.ErrVariantExists):
+		return nil, status.Errorf(codes.AlreadyExists, "У товара уже есть вариант с такими атрибутами")
+	case err != nil:
+		log.Printf("Ошибка при добавлении варианта товара: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	return &proto.AddProductVariantResponse{ProductId: productID}, nil
+}
+
+// withVariants дополняет товары их вариантами одним запросом к базе.
+// Сами варианты вариантов не имеют, для них запрос не нужен
+func (h *CatalogHandler) withVariants(products ...*proto.Product) error {
+	var ids []int32
+	for _, product := range products {
+		if product.ParentProductId == 0 {
+			ids = append(ids, product.ProductId)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	variants, err := h.db.GetProductVariants(ids)
+	if err != nil {
+		log.Printf("Ошибка при получении вариантов товаров: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	for _, product := range products {
+		product.Variants = variants[product.ProductId]
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	db "store/catalog-service/internal/repository"
+	"store/proto"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CreateWarehouse создает склад
+func (h *CatalogHandler) CreateWarehouse(ctx context.Context, req *proto.CreateWarehouseRequest) (*proto.CreateWarehouseResponse, error) {
+	log.Printf("Получен запрос CreateWarehouse: %v", req)
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "Название склада не может быть пустым")
+	}
+	if err := validateLocation(req.Location); err != nil {
+		return nil, err
+	}
+
+	warehouse, err := h.db.CreateWarehouse(name, req.Priority, req.Location, !req.Inactive)
+	if err != nil {
+		return nil, warehouseError(err)
+	}
+	return &proto.CreateWarehouseResponse{Warehouse: warehouse}, nil
+}
+
+// ListWarehouses возвращает склады в порядке приоритета
+func (h *CatalogHandler) ListWarehouses(ctx context.Context, req *proto.ListWarehousesRequest) (*proto.ListWarehousesResponse, error) {
+	log.Printf("Получен запрос ListWarehouses, active_only: %t", req.ActiveOnly)
+
+	warehouses, err := h.db.GetWarehouses(req.ActiveOnly)
+	if err != nil {
+		return nil, warehouseError(err)
+	}
+	return &proto.ListWarehousesResponse{Warehouses: warehouses}, nil
+}
+
+// UpdateWarehouse изменяет поля склада из update_mask
+func (h *CatalogHandler) UpdateWarehouse(ctx context.Context, req *proto.UpdateWarehouseRequest) (*proto.UpdateWarehouseResponse, error) {
+	log.Printf("Получен запрос UpdateWarehouse для warehouse_id: %d", req.WarehouseId)
+
+	paths := req.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Нечего обновлять")
+	}
+
+	var update db.WarehouseUpdate
+	for _, path := range paths {
+		switch path {
+		case "name":
+			name := strings.TrimSpace(req.Name)
+			if name == "" {
+				return nil, status.Errorf(codes.InvalidArgument, "Название склада не может быть пустым")
+			}
+			update.Name = &name
+		case "priority":
+			update.Priority = &req.Priority
+		case "location":
+			if err := validateLocation(req.Location); err != nil {
+				return nil, err
+			}
+			update.UpdateLocation = true
+			update.Location = req.Location
+		case "active":
+			update.Active = &req.Active
+		case "is_default":
+			if !req.IsDefault {
+				return nil, status.Errorf(codes.InvalidArgument, "Признак склада по умолчанию можно только передать другому складу")
+			}
+			update.MakeDefault = true
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "Поле %q нельзя обновить", path)
+		}
+	}
+
+	warehouse, err := h.db.UpdateWarehouse(req.WarehouseId, update)
+	if err != nil {
+		return nil, warehouseError(err)
+	}
+	return &proto.UpdateWarehouseResponse{Warehouse: warehouse}, nil
+}
+
+// AdjustWarehouseStock оприходует или списывает товар на конкретном складе
+func (h *CatalogHandler) AdjustWarehouseStock(ctx context.Context, req *proto.AdjustWarehouseStockRequest) (*proto.AdjustWarehouseStockResponse, error) {
+	log.Printf("Получен запрос AdjustWarehouseStock для product_id: %d, warehouse_id: %d, delta: %d", req.ProductId, req.WarehouseId, req.Delta)
+
+	if req.Delta == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Изменение остатка не может быть нулевым")
+	}
+	if req.WarehouseId <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Некорректный warehouse_id")
+	}
+
+	reason, err := adjustmentReason(req.Reason, req.Delta)
+	if err != nil {
+		return nil, err
+	}
+
+	warehouseQuantity, stockQuantity, err := h.db.AdjustWarehouseStock(req.ProductId, req.WarehouseId, int(req.Delta), db.StockMovement{
+		Reason: reason,
+		Actor:  actorFromContext(ctx),
+	})
+	if err != nil {
+		log.Printf("Ошибка при изменении остатка на складе: %v", err)
+		return nil, stockStatusError(err)
+	}
+	return &proto.AdjustWarehouseStockResponse{
+		WarehouseQuantity: int32(warehouseQuantity),
+		StockQuantity:     int32(stockQuantity),
+	}, nil
+}
+
+// adjustmentReason возвращает причину ручного изменения остатка для журнала.
+// Поступление и возврат только увеличивают остаток; продажа проводится резервом
+func adjustmentReason(reason proto.StockMovementReason, delta int32) (proto.StockMovementReason, error) {
+	switch reason {
+	case proto.StockMovementReason_STOCK_MOVEMENT_REASON_UNSPECIFIED:
+		if delta > 0 {
+			return proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK, nil
+		}
+		return proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT, nil
+	case proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK,
+		proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN:
+		if delta < 0 {
+			return reason, status.Errorf(codes.InvalidArgument, "Причина %s допустима только для прихода", reason)
+		}
+		return reason, nil
+	case proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT:
+		return reason, nil
+	case proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE:
+		return reason, status.Errorf(codes.InvalidArgument, "Продажа проводится через резерв, а не изменением остатка")
+	default:
+		return reason, status.Errorf(codes.InvalidArgument, "Неизвестная причина движения: %d", reason)
+	}
+}
+
+// withStockLevels дополняет товары остатками по складам одним запросом к базе
+func (h *CatalogHandler) withStockLevels(products ...*proto.Product) error {
+	ids := make([]int32, len(products))
+	for i, product := range products {
+		ids[i] = product.ProductId
+	}
+
+	levels, err := h.db.GetStockLevels(ids)
+	if err != nil {
+		log.Printf("Ошибка при получении остатков по складам: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	for _, product := range products {
+		product.StockLevels = levels[product.ProductId]
+	}
+	return nil
+}
+
+// validateAllocation проверяет стратегию выбора склада; для NEAREST нужна точка доставки
+func validateAllocation(allocation *proto.Allocation) error {
+	switch allocation.GetStrategy() {
+	case proto.AllocationStrategy_ALLOCATION_STRATEGY_UNSPECIFIED,
+		proto.AllocationStrategy_ALLOCATION_STRATEGY_PRIORITY,
+		proto.AllocationStrategy_ALLOCATION_STRATEGY_MOST_STOCK:
+	case proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST:
+		if allocation.Destination == nil {
+			return status.Errorf(codes.InvalidArgument, "Для стратегии NEAREST укажите destination")
+		}
+	default:
+		return status.Errorf(codes.InvalidArgument, "Неизвестная стратегия выбора склада: %d", allocation.GetStrategy())
+	}
+	return validateLocation(allocation.GetDestination())
+}
+
+// validateLocation проверяет координаты; nil - координаты не заданы
+func validateLocation(location *proto.GeoPoint) error {
+	if location == nil {
+		return nil
+	}
+	if math.IsNaN(location.Latitude) || math.Abs(location.Latitude) > 90 ||
+		math.IsNaN(location.Longitude) || math.Abs(location.Longitude) > 180 {
+		return status.Errorf(codes.InvalidArgument, "Некорректные координаты")
+	}
+	return nil
+}
+
+// warehouseError переводит ошибку работы со складами в статус gRPC
+func warehouseError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "Склад не найден")
+	case errors.Is(err, db.ErrWarehouseExists):
+		return status.Errorf(codes.AlreadyExists, "Склад с таким названием уже есть")
+	default:
+		log.Printf("Ошибка при работе со складами: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+}
@@ -0,0 +1,104 @@
+package lowstock
+
+import (
+	"context"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"time"
+)
+
+// Checker периодически ищет товары, которые заканчиваются или закончились,
+// и оповещает о них. Уровень остатка, о котором уже оповестили, хранится
+// в базе, поэтому об одном и том же уровне оповещение приходит один раз,
+// а после пополнения остатка - снова, когда товар опять начнет заканчиваться
+type Checker struct {
+	db        db.CatalogDB
+	notifier  Notifier
+	interval  time.Duration
+	batchSize int
+	// afterID - последний обработанный товар: каждая проверка продолжает с места
+	// предыдущей, поэтому товары, оповещение о которых не уходит, не занимают всю пачку
+	afterID int32
+}
+
+// NewChecker создает проверку, которая раз в interval обрабатывает до batchSize товаров
+func NewChecker(db db.CatalogDB, notifier Notifier, interval time.Duration, batchSize int) *Checker {
+	return &Checker{
+		db:        db,
+		notifier:  notifier,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run выполняет проверку до отмены ctx
+func (c *Checker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Check(ctx); err != nil {
+				log.Printf("Ошибка при проверке остатков: %v", err)
+			}
+		}
+	}
+}
+
+// Check обрабатывает следующую пачку товаров с изменившимся уровнем остатка и возвращает
+// число отправленных оповещений. Пачки идут по возрастанию ID, а после последней проверка
+// начинается сначала. Уровень запоминается только после успешной отправки: товар,
+// оповещение о котором не ушло, будет обработан при следующем проходе по каталогу.
+// Check не предназначен для параллельного вызова
+func (c *Checker) Check(ctx context.Context) (int, error) {
+	alerts, err := c.db.GetStockAlerts(c.afterID, c.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, alert := range alerts {
+		if event := alertEvent(alert); event != nil {
+			if err := c.notifier.Notify(ctx, event); err != nil {
+				log.Printf("Ошибка при оповещении об остатке товара %d: %v", alert.ProductID, err)
+				continue
+			}
+			sent++
+		}
+		if err := c.db.SetStockAlertLevel(alert.ProductID, alert.NotifiedLevel, alert.Level); err != nil {
+			return sent, err
+		}
+	}
+
+	if len(alerts) < c.batchSize {
+		// Пачка последняя: следующая проверка пойдет с начала каталога
+		c.afterID = 0
+	} else {
+		c.afterID = alerts[len(alerts)-1].ProductID
+	}
+	return sent, nil
+}
+
+// alertEvent возвращает оповещение для нового уровня остатка;
+// nil - остаток восстановлен и оповещать не о чем
+func alertEvent(alert db.StockAlert) *Event {
+	event := &Event{
+		ProductID:        alert.ProductID,
+		ProductName:      alert.ProductName,
+		StockQuantity:    alert.StockQuantity,
+		ReorderThreshold: alert.ReorderThreshold,
+		DetectedAt:       time.Now().UTC(),
+	}
+	switch alert.Level {
+	case db.StockLevelLow:
+		event.Type = EventLowStock
+	case db.StockLevelOut:
+		event.Type = EventOutOfStock
+	default:
+		return nil
+	}
+	return event
+}
@@ -0,0 +1,145 @@
+package lowstock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	db "store/catalog-service/internal/repository"
+	mock "store/catalog-service/internal/repository/mock"
+)
+
+// recordingNotifier запоминает оповещения; на товарах из fail возвращает ошибку
+type recordingNotifier struct {
+	events []*Event
+	fail   map[int32]bool
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event *Event) error {
+	if n.fail[event.ProductID] {
+		return errors.New("webhook unavailable")
+	}
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestCheck_NotifiesLevelChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	notifier := &recordingNotifier{}
+	checker := NewChecker(mockDB, notifier, time.Minute, 10)
+
+	mockDB.EXPECT().GetStockAlerts(int32(0), 10).Return([]db.StockAlert{
+		{ProductID: 1, ProductName: "Чайник", StockQuantity: 3, ReorderThreshold: 5, Level: db.StockLevelLow, NotifiedLevel: db.StockLevelOK},
+		{ProductID: 2, ProductName: "Кружка", StockQuantity: 0, ReorderThreshold: 5, Level: db.StockLevelOut, NotifiedLevel: db.StockLevelLow},
+		// Остаток пополнен: оповещения нет, уровень просто запоминается
+		{ProductID: 3, ProductName: "Ложка", StockQuantity: 40, ReorderThreshold: 5, Level: db.StockLevelOK, NotifiedLevel: db.StockLevelOut},
+	}, nil)
+	mockDB.EXPECT().SetStockAlertLevel(int32(1), db.StockLevelOK, db.StockLevelLow).Return(nil)
+	mockDB.EXPECT().SetStockAlertLevel(int32(2), db.StockLevelLow, db.StockLevelOut).Return(nil)
+	mockDB.EXPECT().SetStockAlertLevel(int32(3), db.StockLevelOut, db.StockLevelOK).Return(nil)
+
+	sent, err := checker.Check(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	if assert.Len(t, notifier.events, 2) {
+		assert.Equal(t, EventLowStock, notifier.events[0].Type)
+		assert.Equal(t, int32(1), notifier.events[0].ProductID)
+		assert.Equal(t, EventOutOfStock, notifier.events[1].Type)
+		assert.Equal(t, int32(2), notifier.events[1].ProductID)
+	}
+}
+
+func TestCheck_KeepsLevelOnNotifyError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	notifier := &recordingNotifier{fail: map[int32]bool{1: true}}
+	checker := NewChecker(mockDB, notifier, time.Minute, 10)
+
+	mockDB.EXPECT().GetStockAlerts(int32(0), 10).Return([]db.StockAlert{
+		{ProductID: 1, Level: db.StockLevelOut, NotifiedLevel: db.StockLevelOK},
+		{ProductID: 2, Level: db.StockLevelLow, NotifiedLevel: db.StockLevelOK},
+	}, nil)
+	// Уровень товара 1 не сохраняется: оповещение повторится при следующей проверке
+	mockDB.EXPECT().SetStockAlertLevel(int32(2), db.StockLevelOK, db.StockLevelLow).Return(nil)
+
+	sent, err := checker.Check(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+}
+
+func TestCheck_PagesPastFailedNotifications(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	notifier := &recordingNotifier{fail: map[int32]bool{1: true, 2: true}}
+	checker := NewChecker(mockDB, notifier, time.Minute, 2)
+
+	// Оповещения о товарах 1 и 2 не уходят, но следующая проверка берет товары после них
+	gomock.InOrder(
+		mockDB.EXPECT().GetStockAlerts(int32(0), 2).Return([]db.StockAlert{
+			{ProductID: 1, Level: db.StockLevelOut, NotifiedLevel: db.StockLevelOK},
+			{ProductID: 2, Level: db.StockLevelOut, NotifiedLevel: db.StockLevelOK},
+		}, nil),
+		mockDB.EXPECT().GetStockAlerts(int32(2), 2).Return([]db.StockAlert{
+			{ProductID: 3, Level: db.StockLevelLow, NotifiedLevel: db.StockLevelOK},
+		}, nil),
+		mockDB.EXPECT().SetStockAlertLevel(int32(3), db.StockLevelOK, db.StockLevelLow).Return(nil),
+		// Каталог пройден до конца: товары 1 и 2 пробуются снова
+		mockDB.EXPECT().GetStockAlerts(int32(0), 2).Return(nil, nil),
+	)
+
+	for _, want := range []int{0, 1, 0} {
+		sent, err := checker.Check(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, want, sent)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		if received.ProductID == 13 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(server.URL, time.Second)
+
+	err := notifier.Notify(context.Background(), &Event{Type: EventOutOfStock, ProductID: 7, ProductName: "Чайник"})
+	assert.NoError(t, err)
+	assert.Equal(t, EventOutOfStock, received.Type)
+	assert.Equal(t, int32(7), received.ProductID)
+
+	err = notifier.Notify(context.Background(), &Event{Type: EventLowStock, ProductID: 13})
+	assert.Error(t, err)
+}
+
+func TestWriterNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	notifier := NewWriterNotifier(&buf)
+
+	err := notifier.Notify(context.Background(), &Event{Type: EventLowStock, ProductID: 4, StockQuantity: 2, ReorderThreshold: 10})
+
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"event_type":"stock.low"`)
+	assert.Contains(t, buf.String(), `"reorder_threshold":10`)
+}
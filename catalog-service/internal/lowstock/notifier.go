@@ -0,0 +1,108 @@
+package lowstock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Типы событий об остатках
+const (
+	EventLowStock   = "stock.low"
+	EventOutOfStock = "stock.out"
+)
+
+// Event оповещение о том, что товар заканчивается или закончился
+type Event struct {
+	Type             string    `json:"event_type"`
+	ProductID        int32     `json:"product_id"`
+	ProductName      string    `json:"product_name"`
+	StockQuantity    int32     `json:"stock_quantity"`
+	ReorderThreshold int32     `json:"reorder_threshold"`
+	DetectedAt       time.Time `json:"detected_at"`
+}
+
+// Notifier доставляет оповещения об остатках. Доставка «хотя бы один раз»:
+// если уровень не удалось сохранить после отправки, оповещение придет повторно
+type Notifier interface {
+	Notify(ctx context.Context, event *Event) error
+}
+
+// LogNotifier пишет оповещения в стандартный лог
+type LogNotifier struct{}
+
+// Notify выводит оповещение в лог
+func (LogNotifier) Notify(ctx context.Context, event *Event) error {
+	log.Printf("Оповещение %s: товар %d %q, остаток %d, порог дозаказа %d",
+		event.Type, event.ProductID, event.ProductName, event.StockQuantity, event.ReorderThreshold)
+	return nil
+}
+
+// WriterNotifier пишет оповещения построчно в формате JSON в файл
+type WriterNotifier struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterNotifier создает оповещатель, пишущий в w
+func NewWriterNotifier(w io.Writer) *WriterNotifier {
+	return &WriterNotifier{w: w}
+}
+
+// Notify записывает оповещение одной строкой
+func (n *WriterNotifier) Notify(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode stock event for product %d: %w", event.ProductID, err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, err := n.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write stock event for product %d: %w", event.ProductID, err)
+	}
+	return nil
+}
+
+// WebhookNotifier отправляет оповещения POST-запросом с JSON на url
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier создает оповещатель, который ждет ответа не дольше timeout
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// Notify отправляет оповещение; ответ не из диапазона 2xx считается ошибкой
+func (n *WebhookNotifier) Notify(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode stock event for product %d: %w", event.ProductID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send stock event for product %d: %w", event.ProductID, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s for product %d", resp.Status, event.ProductID)
+	}
+	return nil
+}
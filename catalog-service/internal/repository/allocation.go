@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/proto"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrNoSingleWarehouse возвращается, если товара хватает только на нескольких складах
+	// вместе: позиция резерва всегда списывается с одного склада и не делится
+	ErrNoSingleWarehouse = errors.New("no single warehouse has enough stock")
+	// ErrWarehouseInactive возвращается, если для списания явно указан неактивный склад
+	ErrWarehouseInactive = errors.New("warehouse is inactive")
+)
+
+// nearest сортирует склады по расстоянию до точки ($3, $4) по формуле гаверсинусов.
+// Склады без координат идут последними
+const nearest = `2 * asin(sqrt(
+            power(sin(radians(w.Latitude - $3) / 2), 2) +
+            cos(radians($3)) * cos(radians(w.Latitude)) * power(sin(radians(w.Longitude - $4) / 2), 2)
+        )) NULLS LAST`
+
+// allocationOrder возвращает порядок перебора складов для стратегии и аргументы
+// для него (начиная с $3)
+func allocationOrder(allocation *proto.Allocation) (string, []interface{}) {
+	switch allocation.GetStrategy() {
+	case proto.AllocationStrategy_ALLOCATION_STRATEGY_MOST_STOCK:
+		return "s.Quantity DESC, w.Priority, w.WarehouseID", nil
+	case proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST:
+		destination := allocation.GetDestination()
+		return nearest + ", w.Priority, w.WarehouseID",
+			[]interface{}{destination.GetLatitude(), destination.GetLongitude()}
+	default:
+		return "w.Priority, w.WarehouseID", nil
+	}
+}
+
+// allocateStock списывает quantity единиц товара с одного склада и возвращает его ID.
+// warehouseID 0 - склад выбирается по стратегии среди активных складов, где товара
+// хватает на всю позицию. Кандидаты перебираются по порядку: если параллельный
+// резерв успел забрать остаток, берется следующий склад. Позиция между складами
+// не делится: если товара хватает только на нескольких складах вместе, возвращается
+// ErrNoSingleWarehouse. Явно указанный склад должен быть активным
+func allocateStock(ctx context.Context, tx pgx.Tx, productID int32, quantity int, warehouseID int32, allocation *proto.Allocation, movement StockMovement) (int32, error) {
+	candidates := []int32{warehouseID}
+	if warehouseID == 0 {
+		order, extra := allocationOrder(allocation)
+		rows, err := tx.Query(ctx, `
+            SELECT s.WarehouseID
+            FROM WarehouseStock s
+            JOIN Warehouses w ON w.WarehouseID = s.WarehouseID
+            JOIN Catalog ON Catalog.ProductID = s.ProductID
+            WHERE s.ProductID = $1 AND s.Quantity >= $2 AND w.Active AND `+sellable+`
+            ORDER BY `+order,
+			append([]interface{}{productID, quantity}, extra...)...,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to select warehouses: %w", err)
+		}
+		candidates = candidates[:0]
+		for rows.Next() {
+			var id int32
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			candidates = append(candidates, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	} else {
+		if err := checkSellable(ctx, tx, productID); err != nil {
+			return 0, err
+		}
+		if err := checkWarehouseActive(ctx, tx, warehouseID); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, id := range candidates {
+		_, err := changeWarehouseStock(ctx, tx, productID, id, -quantity, movement)
+		if errors.Is(err, ErrInsufficientStock) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+	if warehouseID != 0 {
+		// Склад указан явно: различаем отсутствие товара и нехватку остатка
+		if err := checkStockTarget(ctx, tx, productID, warehouseID); err != nil {
+			return 0, err
+		}
+		return 0, ErrInsufficientStock
+	}
+
+	// Ни один склад не подошел: различаем нехватку товара и остаток, разбросанный по складам
+	var total int
+	err := tx.QueryRow(ctx, `
+        SELECT COALESCE(SUM(s.Quantity), 0)
+        FROM WarehouseStock s
+        JOIN Warehouses w ON w.WarehouseID = s.WarehouseID
+        JOIN Catalog ON Catalog.ProductID = s.ProductID
+        WHERE s.ProductID = $1 AND w.Active AND `+sellable,
+		productID,
+	).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum warehouse stock: %w", err)
+	}
+	if total >= quantity {
+		return 0, ErrNoSingleWarehouse
+	}
+	return 0, ErrInsufficientStock
+}
+
+// checkWarehouseActive возвращает ErrWarehouseNotFound для несуществующего склада
+// и ErrWarehouseInactive для выключенного
+func checkWarehouseActive(ctx context.Context, tx pgx.Tx, warehouseID int32) error {
+	var active bool
+	err := tx.QueryRow(ctx,
+		"SELECT Active FROM Warehouses WHERE WarehouseID = $1",
+		warehouseID,
+	).Scan(&active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWarehouseNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrWarehouseInactive
+	}
+	return nil
+}
+
+// checkSellable возвращает ErrProductHasVariants для товара, который продается вариантами
+func checkSellable(ctx context.Context, tx pgx.Tx, productID int32) error {
+	var hasVariants bool
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM Catalog WHERE ParentProductID = $1)",
+		productID,
+	).Scan(&hasVariants)
+	if err != nil {
+		return err
+	}
+	if hasVariants {
+		return ErrProductHasVariants
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AttributeFilter условие на характеристику товара; все заданные части должны выполняться
+type AttributeFilter struct {
+	Key    string
+	Equals interface{} // Строка, float64 или bool; nil - без условия на равенство
+	Min    *float64    // nil - без нижней границы
+	Max    *float64    // nil - без верхней границы
+}
+
+// encodeAttributes переводит характеристики в JSON для столбца Attributes
+func encodeAttributes(attributes map[string]interface{}) (string, error) {
+	if attributes == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode attributes: %w", err)
+	}
+	return string(data), nil
+}
+
+// attributeConditions строит условия WHERE для фильтров по характеристикам.
+// Оба вида условий поддерживаются GIN-индексом idx_catalog_attributes:
+// равенство - через @>, диапазон - через @? с jsonpath
+func attributeConditions(filters []AttributeFilter, args *queryArgs) ([]string, error) {
+	var where []string
+	for _, filter := range filters {
+		if filter.Equals != nil {
+			contains, err := encodeAttributes(map[string]interface{}{filter.Key: filter.Equals})
+			if err != nil {
+				return nil, err
+			}
+			where = append(where, "Attributes @> "+args.add(contains)+"::jsonb")
+		}
+
+		var bounds []string
+		if filter.Min != nil {
+			bounds = append(bounds, "@ >= "+strconv.FormatFloat(*filter.Min, 'f', -1, 64))
+		}
+		if filter.Max != nil {
+			bounds = append(bounds, "@ <= "+strconv.FormatFloat(*filter.Max, 'f', -1, 64))
+		}
+		if len(bounds) > 0 {
+			// Ключ в jsonpath записывается строкой в кавычках: экранирование JSON подходит
+			key, err := json.Marshal(filter.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode attribute key: %w", err)
+			}
+			path := "$." + string(key) + " ? (" + strings.Join(bounds, " && ") + ")"
+			where = append(where, "Attributes @? "+args.add(path)+"::jsonpath")
+		}
+	}
+	return where, nil
+}
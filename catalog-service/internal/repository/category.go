@@ -0,0 +1,358 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/proto"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrCategoryNotFound возвращается, если категории с указанным ID нет
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrCategoryExists возвращается, если у родителя уже есть категория с таким именем
+	ErrCategoryExists = errors.New("category with this name already exists")
+	// ErrCategoryHasChildren возвращается при удалении категории с подкатегориями
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+	// ErrCategoryCycle возвращается при переносе категории в саму себя или в свою подкатегорию
+	ErrCategoryCycle = errors.New("category cannot be moved into its own subtree")
+)
+
+// CategoryUpdate изменяемые поля категории; nil означает, что поле не меняется
+type CategoryUpdate struct {
+	Name     *string
+	ParentID *int32 // 0 - сделать корневой
+}
+
+// categoryPaths рекурсивно строит путь каждой категории от корня.
+// Дерево категорий небольшое, поэтому путь вычисляется при чтении, а не хранится
+const categoryPaths = `
+        WITH RECURSIVE paths AS (
+            SELECT CategoryID, Name, ParentID, Name::text AS Path
+            FROM Categories
+            WHERE ParentID IS NULL
+            UNION ALL
+            SELECT c.CategoryID, c.Name, c.ParentID, p.Path || ' / ' || c.Name
+            FROM Categories c
+            JOIN paths p ON c.ParentID = p.CategoryID
+        )`
+
+// lockCategories сериализует изменения дерева до конца транзакции:
+// проверки имени и циклов не должны гоняться с параллельными изменениями
+func lockCategories(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('categories'))")
+	if err != nil {
+		return fmt.Errorf("failed to lock categories: %w", err)
+	}
+	return nil
+}
+
+// CreateCategory создает категорию; parentID 0 - корневая
+func (db *catalogDB) CreateCategory(name string, parentID int32) (*proto.Category, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockCategories(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := checkCategoryName(ctx, tx, 0, name, parentID); err != nil {
+		return nil, err
+	}
+
+	var categoryID int32
+	err = tx.QueryRow(ctx,
+		"INSERT INTO Categories (Name, ParentID) VALUES ($1, NULLIF($2, 0)) RETURNING CategoryID",
+		name, parentID,
+	).Scan(&categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+
+	category, err := getCategory(ctx, tx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return category, nil
+}
+
+// checkCategoryName проверяет, что родитель существует и у него нет другой
+// категории (кроме categoryID) с тем же именем
+func checkCategoryName(ctx context.Context, tx pgx.Tx, categoryID int32, name string, parentID int32) error {
+	if parentID != 0 {
+		var exists bool
+		err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM Categories WHERE CategoryID = $1)", parentID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check parent category: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("parent %d: %w", parentID, ErrCategoryNotFound)
+		}
+	}
+
+	var taken bool
+	err := tx.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM Categories
+            WHERE COALESCE(ParentID, 0) = $1 AND lower(Name) = lower($2) AND CategoryID <> $3
+        )`, parentID, name, categoryID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check category name: %w", err)
+	}
+	if taken {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+// getCategory читает категорию вместе с путем
+func getCategory(ctx context.Context, tx pgx.Tx, categoryID int32) (*proto.Category, error) {
+	var category proto.Category
+	var parentID *int32
+	err := tx.QueryRow(ctx, categoryPaths+`
+        SELECT CategoryID, Name, ParentID, Path FROM paths WHERE CategoryID = $1`, categoryID,
+	).Scan(&category.CategoryId, &category.Name, &parentID, &category.Path)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read category: %w", err)
+	}
+	if parentID != nil {
+		category.ParentId = *parentID
+	}
+	return &category, nil
+}
+
+// GetCategories возвращает категорию rootID со всеми подкатегориями (0 - все дерево),
+// упорядоченные по пути: родитель всегда раньше потомков
+func (db *catalogDB) GetCategories(rootID int32) ([]*proto.Category, error) {
+	rows, err := db.conn.Query(context.Background(), categoryPaths+`,
+        subtree AS (
+            SELECT CategoryID FROM Categories WHERE $1 = 0 OR CategoryID = $1
+            UNION
+            SELECT c.CategoryID FROM Categories c JOIN subtree s ON c.ParentID = s.CategoryID
+        )
+        SELECT p.CategoryID, p.Name, p.ParentID, p.Path
+        FROM paths p
+        JOIN subtree USING (CategoryID)
+        ORDER BY p.Path`, rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []*proto.Category
+	for rows.Next() {
+		var category proto.Category
+		var parentID *int32
+		if err := rows.Scan(&category.CategoryId, &category.Name, &parentID, &category.Path); err != nil {
+			return nil, err
+		}
+		if parentID != nil {
+			category.ParentId = *parentID
+		}
+		categories = append(categories, &category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if rootID != 0 && len(categories) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	return categories, nil
+}
+
+// UpdateCategory переименовывает и/или переносит категорию вместе с поддеревом
+func (db *catalogDB) UpdateCategory(categoryID int32, update CategoryUpdate) (*proto.Category, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockCategories(ctx, tx); err != nil {
+		return nil, err
+	}
+	current, err := getCategory(ctx, tx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, parentID := current.Name, current.ParentId
+	if update.Name != nil {
+		name = *update.Name
+	}
+	if update.ParentID != nil {
+		parentID = *update.ParentID
+	}
+
+	if parentID != 0 && parentID != current.ParentId {
+		// Новый родитель не может лежать в поддереве переносимой категории
+		var cycle bool
+		err := tx.QueryRow(ctx, `
+            WITH RECURSIVE subtree AS (
+                SELECT CategoryID FROM Categories WHERE CategoryID = $1
+                UNION ALL
+                SELECT c.CategoryID FROM Categories c JOIN subtree s ON c.ParentID = s.CategoryID
+            )
+            SELECT EXISTS (SELECT 1 FROM subtree WHERE CategoryID = $2)`, categoryID, parentID,
+		).Scan(&cycle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check category tree: %w", err)
+		}
+		if cycle {
+			return nil, ErrCategoryCycle
+		}
+	}
+	if err := checkCategoryName(ctx, tx, categoryID, name, parentID); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE Categories SET Name = $2, ParentID = NULLIF($3, 0) WHERE CategoryID = $1",
+		categoryID, name, parentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update category: %w", err)
+	}
+
+	category, err := getCategory(ctx, tx, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return category, nil
+}
+
+// DeleteCategory удаляет категорию без подкатегорий; товары из нее исключаются
+func (db *catalogDB) DeleteCategory(categoryID int32) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockCategories(ctx, tx); err != nil {
+		return err
+	}
+
+	var hasChildren bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM Categories WHERE ParentID = $1)", categoryID).Scan(&hasChildren)
+	if err != nil {
+		return fmt.Errorf("failed to check subcategories: %w", err)
+	}
+	if hasChildren {
+		return ErrCategoryHasChildren
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM Categories WHERE CategoryID = $1", categoryID)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// SetProductCategories заменяет набор категорий товара
+func (db *catalogDB) SetProductCategories(productID int32, categoryIDs []int32) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM Catalog WHERE ProductID = $1)", productID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check product: %w", err)
+	}
+	if !exists {
+		return ErrProductNotFound
+	}
+
+	if categoryIDs == nil {
+		categoryIDs = []int32{}
+	}
+	var missing []int32
+	err = tx.QueryRow(ctx, `
+        SELECT COALESCE(array_agg(id), '{}')
+        FROM unnest($1::int[]) AS id
+        WHERE NOT EXISTS (SELECT 1 FROM Categories WHERE CategoryID = id)`, categoryIDs,
+	).Scan(&missing)
+	if err != nil {
+		return fmt.Errorf("failed to check categories: %w", err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %v", ErrCategoryNotFound, missing)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM ProductCategories WHERE ProductID = $1", productID)
+	if err != nil {
+		return fmt.Errorf("failed to clear product categories: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO ProductCategories (ProductID, CategoryID)
+        SELECT $1, id FROM unnest($2::int[]) AS id
+        ON CONFLICT DO NOTHING`, productID, categoryIDs)
+	if err != nil {
+		return fmt.Errorf("failed to assign product categories: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetProductCategories возвращает категории товаров с путями, по ID товара
+func (db *catalogDB) GetProductCategories(productIDs []int32) (map[int32][]*proto.Category, error) {
+	rows, err := db.conn.Query(context.Background(), categoryPaths+`
+        SELECT pc.ProductID, p.CategoryID, p.Name, p.ParentID, p.Path
+        FROM ProductCategories pc
+        JOIN paths p ON p.CategoryID = pc.CategoryID
+        WHERE pc.ProductID = ANY($1)
+        ORDER BY pc.ProductID, p.Path`, productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read product categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := make(map[int32][]*proto.Category)
+	for rows.Next() {
+		var productID int32
+		var category proto.Category
+		var parentID *int32
+		if err := rows.Scan(&productID, &category.CategoryId, &category.Name, &parentID, &category.Path); err != nil {
+			return nil, err
+		}
+		if parentID != nil {
+			category.ParentId = *parentID
+		}
+		categories[productID] = append(categories[productID], &category)
+	}
+	return categories, rows.Err()
+}
@@ -2,93 +2,684 @@ package db
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"store/money"
 	"store/proto"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-//go:generate mockgen -source=db.go -destination=mock/mock.go
+//go:generate mockgen -source=db.go -destination=mock/mock.go -package mock
+
+var (
+	// ErrProductNotFound возвращается, если товара с указанным ID нет в каталоге
+	ErrProductNotFound = errors.New("product not found")
+	// ErrInsufficientStock возвращается, если остатка не хватает для резервирования
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReservationNotFound возвращается, если резерва с указанным ID нет
+	ErrReservationNotFound = errors.New("reservation not found")
+	// ErrReservationNotPending возвращается при попытке изменить уже закрытый резерв
+	ErrReservationNotPending = errors.New("reservation is not pending")
+	// ErrIdempotencyKeyMismatch возвращается, если ключ идемпотентности уже использован с другим запросом
+	ErrIdempotencyKeyMismatch = errors.New("idempotency key reused with different request")
+)
 
 type CatalogDB interface {
-	AddProduct(productName string, stockQuantity int, pricePerUnit float64) (int, error)
-	GetProductByID(productID int32) (string, int, float64, error) // Используем int32
-	GetAllProducts() ([]*proto.Product, error)
-	UpdateProduct(productID int, productName string, stockQuantity int, pricePerUnit float64) error
-	DeleteProduct(productID int) error
+	// AddProduct добавляет товар и возвращает его ID. Если idempotencyKey не пустой,
+	// повтор с тем же ключом в течение IdempotencyRetention вернет исходный ID.
+	// actor попадает в журнал движений вместе с начальным остатком
+	AddProduct(productName string, stockQuantity int, price *proto.Money, attributes map[string]interface{}, idempotencyKey, requestHash, actor string) (int, error)
+	GetProductByID(productID int32) (string, int, *proto.Money, error) // Используем int32
+	// GetProductsByIDs возвращает найденные товары из productIDs одним запросом
+	GetProductsByIDs(productIDs []int32) ([]*proto.Product, error)
+	// GetProductsBySKUs возвращает найденные товары по артикулам одним запросом
+	GetProductsBySKUs(skus []string) ([]*proto.Product, error)
+	// AddProductVariant добавляет вариант товара и возвращает его ProductID
+	AddProductVariant(variant ProductVariant) (int32, error)
+	// GetProductVariants возвращает варианты товаров productIDs, по ID родительского товара
+	GetProductVariants(productIDs []int32) (map[int32][]*proto.Product, error)
+	// GetAllProducts возвращает страницу товаров по фильтру и курсор следующей страницы
+	// (nil, если страница последняя)
+	GetAllProducts(filter ProductFilter) ([]*proto.Product, *ProductCursor, error)
+	// SearchProducts возвращает страницу результатов полнотекстового поиска по убыванию
+	// релевантности и курсор следующей страницы (nil, если страница последняя)
+	SearchProducts(filter SearchFilter) ([]*proto.ProductSearchResult, *SearchCursor, error)
+	// UpdateProduct задает название, остаток и цену товара; price nil - цена не меняется
+	UpdateProduct(productID int, productName string, stockQuantity int, price *proto.Money, actor string) error
+	// UpdateProductFields обновляет только заданные поля товара в одной транзакции
+	UpdateProductFields(productID int32, update ProductUpdate) error
+	// DeleteProduct удаляет товар, его остатки списываются в журнале движений
+	DeleteProduct(productID int, actor string) error
+	// ReserveStock уменьшает остаток на quantity и возвращает новый общий остаток
+	// и склад, с которого списан товар
+	ReserveStock(productID int32, quantity int, movement StockMovement) (int, int32, error)
+	// ReleaseStock увеличивает остаток на складе на quantity и возвращает новый общий остаток.
+	// Если operationID не пустой, операция применяется не более одного раза
+	ReleaseStock(productID, warehouseID int32, quantity int, operationID string, movement StockMovement) (int, error)
+	// CreateReservation атомарно списывает все позиции со складов, выбранных по allocation,
+	// и создает резерв со сроком жизни ttl. Заказ и инициатор из movement сохраняются
+	// в резерве и попадают в журнал и при списании, и при возврате товара
+	CreateReservation(items []*proto.ReservationItem, allocation *proto.Allocation, ttl time.Duration, movement StockMovement) (*Reservation, error)
+	// CommitReservation подтверждает резерв, списанный товар остается списанным
+	CommitReservation(reservationID int32) error
+	// CancelReservation отменяет резерв и возвращает товар на склад
+	CancelReservation(reservationID int32, actor string) error
+	// ExpireReservations снимает просроченные резервы и возвращает их количество
+	ExpireReservations() (int, error)
+	// PurgeIdempotencyKeys удаляет ключи идемпотентности старше IdempotencyRetention
+	PurgeIdempotencyKeys() (int, error)
+	// GetStockChanges возвращает изменения остатков после позиции afterSequence
+	GetStockChanges(afterSequence int64, productIDs []int32, limit int) ([]*proto.StockChange, error)
+	// GetStockSnapshot возвращает текущие остатки и позицию журнала, на которой они сняты
+	GetStockSnapshot(productIDs []int32) ([]*proto.StockChange, int64, error)
+	// SequenceStockChanges назначает позиции журнала изменениям завершившихся транзакций
+	SequenceStockChanges() (int, error)
+	// StockSequenceRange возвращает первую и последнюю позиции журнала изменений остатков
+	StockSequenceRange() (oldest int64, latest int64, err error)
+	// PurgeStockChanges удаляет записи журнала изменений старше StockChangeRetention
+	PurgeStockChanges() (int, error)
+	// CreateCategory создает категорию; parentID 0 - корневая
+	CreateCategory(name string, parentID int32) (*proto.Category, error)
+	// GetCategories возвращает категорию rootID со всеми подкатегориями (0 - все дерево)
+	GetCategories(rootID int32) ([]*proto.Category, error)
+	// UpdateCategory переименовывает и/или переносит категорию
+	UpdateCategory(categoryID int32, update CategoryUpdate) (*proto.Category, error)
+	// DeleteCategory удаляет категорию без подкатегорий
+	DeleteCategory(categoryID int32) error
+	// SetProductCategories заменяет набор категорий товара
+	SetProductCategories(productID int32, categoryIDs []int32) error
+	// GetProductCategories возвращает категории товаров с путями, по ID товара
+	GetProductCategories(productIDs []int32) (map[int32][]*proto.Category, error)
+	// CreateWarehouse создает склад
+	CreateWarehouse(name string, priority int32, location *proto.GeoPoint, active bool) (*proto.Warehouse, error)
+	// GetWarehouses возвращает склады по приоритету
+	GetWarehouses(activeOnly bool) ([]*proto.Warehouse, error)
+	// UpdateWarehouse изменяет склад и возвращает его новое состояние
+	UpdateWarehouse(warehouseID int32, update WarehouseUpdate) (*proto.Warehouse, error)
+	// AdjustWarehouseStock меняет остаток товара на складе и возвращает остаток
+	// на складе и общий остаток товара
+	AdjustWarehouseStock(productID, warehouseID int32, delta int, movement StockMovement) (int, int, error)
+	// GetLowStockProducts возвращает страницу товаров с остатком не выше порога дозаказа
+	// и курсор следующей страницы (nil, если страница последняя)
+	GetLowStockProducts(filter LowStockFilter) ([]*proto.Product, *LowStockCursor, error)
+	// GetStockAlerts возвращает до limit товаров с ID больше afterID, уровень остатка
+	// которых изменился с последнего оповещения
+	GetStockAlerts(afterID int32, limit int) ([]StockAlert, error)
+	// SetStockAlertLevel запоминает уровень остатка, о котором отправлено оповещение
+	SetStockAlertLevel(productID int32, from, to string) error
+	// GetStockLevels возвращает остатки товаров по складам, по ID товара
+	GetStockLevels(productIDs []int32) (map[int32][]*proto.StockLevel, error)
+	// ListStockMovements возвращает страницу журнала движений от новых к старым и
+	// MovementID для следующей страницы (0, если страница последняя)
+	ListStockMovements(filter StockMovementFilter) ([]*proto.StockMovement, int64, error)
+	// ReconcileStock пересчитывает остатки по журналу движений и возвращает расхождения
+	ReconcileStock() ([]StockDrift, error)
+	// SchedulePriceChange назначает цену товара на интервал [from, to);
+	// from nil или в прошлом - с текущего момента, to nil - бессрочно
+	SchedulePriceChange(productID int32, price *proto.Money, from, to *time.Time, actor string) (*proto.ProductPrice, error)
+	// GetEffectivePrices возвращает цены товаров, действующие в момент at, по ID товара
+	GetEffectivePrices(productIDs []int32, at time.Time) (map[int32]*proto.Money, error)
+	// GetPriceHistory возвращает цены товара, включая запланированные, по началу действия
+	GetPriceHistory(productID int32) ([]*proto.ProductPrice, error)
+	// ApplyScheduledPrices переносит в Catalog цены, которые начали действовать
+	ApplyScheduledPrices() (int, error)
+	// CreateSupplier добавляет поставщика
+	CreateSupplier(name, email, phone string) (*proto.Supplier, error)
+	// GetSuppliers возвращает поставщиков по названию
+	GetSuppliers() ([]*proto.Supplier, error)
+	// CreatePurchaseOrder создает заказ поставщику на склад warehouseID (0 - склад по умолчанию)
+	CreatePurchaseOrder(supplierID, warehouseID int32, items []*proto.PurchaseOrderLine) (*proto.PurchaseOrder, error)
+	// GetPurchaseOrder возвращает заказ поставщику с позициями
+	GetPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error)
+	// ListPurchaseOrders возвращает страницу заказов поставщикам от новых к старым и
+	// PurchaseOrderID для следующей страницы (0, если страница последняя)
+	ListPurchaseOrders(filter PurchaseOrderFilter) ([]*proto.PurchaseOrder, int32, error)
+	// ReceivePurchaseOrder принимает товар по заказу поставщику и увеличивает остаток
+	// склада заказа движением RESTOCK. Пустой items принимает все, что еще не пришло.
+	// Если operationID не пустой, приемка применяется не более одного раза
+	ReceivePurchaseOrder(purchaseOrderID int32, items []*proto.PurchaseOrderLine, operationID, actor string) (*proto.PurchaseOrder, error)
+	// CancelPurchaseOrder отменяет заказ поставщику; принятый товар остается на складе
+	CancelPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error)
+}
+
+// ProductUpdate изменяемые поля товара; nil означает, что поле не меняется
+type ProductUpdate struct {
+	ProductName      *string
+	StockQuantity    *int
+	Price            *proto.Money
+	Attributes       map[string]interface{} // Заменяет характеристики целиком; пустая карта очищает их
+	ReorderThreshold *int32
+	Actor            string // Инициатор изменения остатка и цены для журналов
+}
+
+// ProductFilter параметры выборки товаров
+type ProductFilter struct {
+	NameContains string       // Подстрока названия без учета регистра
+	MinPrice     *proto.Money // nil - без ограничения
+	MaxPrice     *proto.Money // nil - без ограничения
+	InStockOnly  bool
+	CategoryID   int32 // Категория вместе с подкатегориями; 0 - любая
+	Attributes   []AttributeFilter
+	Sort         proto.ProductSortOrder
+	PageSize     int
+	After        *ProductCursor // nil - первая страница
+}
+
+// ProductCursor ключ последнего товара страницы для keyset-пагинации.
+// Заполняются поля, по которым идет сортировка, и ProductID
+type ProductCursor struct {
+	ProductID   int32
+	ProductName string
+	Price       *proto.Money
 }
 
 // catalogDB реализует интерфейс CatalogDB
 type catalogDB struct {
-	conn *pgx.Conn
+	conn *pgxpool.Pool
 }
 
 // NewCatalogDB создает новый экземпляр catalogDB
-func NewCatalogDB(conn *pgx.Conn) CatalogDB {
+func NewCatalogDB(conn *pgxpool.Pool) CatalogDB {
 	return &catalogDB{conn: conn}
 }
 
-func (db *catalogDB) AddProduct(productName string, stockQuantity int, pricePerUnit float64) (int, error) {
+func (db *catalogDB) AddProduct(productName string, stockQuantity int, price *proto.Money, attributes map[string]interface{}, idempotencyKey, requestHash, actor string) (int, error) {
+	ctx := context.Background()
+
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if idempotencyKey != "" {
+		// Ключ записывается в той же транзакции, что и товар: параллельный
+		// повтор дождется ее завершения и получит уже сохраненный ProductID
+		productID, claimed, err := claimIdempotencyKey(ctx, tx, idempotencyKey, requestHash)
+		if err != nil || !claimed {
+			return productID, err
+		}
+	}
+
 	var productID int
-	err := db.conn.QueryRow(context.Background(),
-		"INSERT INTO Catalog (ProductName, StockQuantity, PricePerUnit) VALUES ($1, $2, $3) RETURNING ProductID",
-		productName, stockQuantity, pricePerUnit).Scan(&productID)
+	err = tx.QueryRow(ctx,
+		"INSERT INTO Catalog (ProductName, StockQuantity, PricePerUnit, Currency, Attributes) VALUES ($1, 0, $2, $3, $4::jsonb) RETURNING ProductID",
+		productName, money.String(price), price.CurrencyCode, encoded).Scan(&productID)
 	if err != nil {
 		return 0, err
 	}
+	if err := insertInitialPrice(ctx, tx, int32(productID), price, actor); err != nil {
+		return 0, err
+	}
+	// Начальный остаток приходит на склад по умолчанию, общий остаток обновит триггер
+	restock := StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK, Actor: actor}
+	if err := setStockQuantity(ctx, tx, int32(productID), stockQuantity, restock); err != nil {
+		return 0, err
+	}
+
+	if idempotencyKey != "" {
+		_, err = tx.Exec(ctx,
+			"UPDATE IdempotencyKeys SET ProductID = $2 WHERE IdempotencyKey = $1",
+			idempotencyKey, productID,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save idempotency key: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return productID, nil
 }
 
-func (db *catalogDB) GetAllProducts() ([]*proto.Product, error) {
-	rows, err := db.conn.Query(context.Background(), "SELECT ProductID, ProductName, StockQuantity, PricePerUnit FROM Catalog")
+// GetAllProducts читает на одну строку больше страницы: по ней видно, есть ли следующая.
+// Страницы выбираются по ключу сортировки (keyset), а не через OFFSET
+func (db *catalogDB) GetAllProducts(filter ProductFilter) ([]*proto.Product, *ProductCursor, error) {
+	var where []string
+	var args queryArgs
+
+	if filter.NameContains != "" {
+		where = append(where, "ProductName ILIKE '%' || "+args.add(escapeLike(filter.NameContains))+" || '%'")
+	}
+	if filter.MinPrice != nil {
+		where = append(where, "PricePerUnit >= "+args.add(money.String(filter.MinPrice))+"::numeric")
+		where = append(where, "Currency = "+args.add(filter.MinPrice.CurrencyCode))
+	}
+	if filter.MaxPrice != nil {
+		where = append(where, "PricePerUnit <= "+args.add(money.String(filter.MaxPrice))+"::numeric")
+		where = append(where, "Currency = "+args.add(filter.MaxPrice.CurrencyCode))
+	}
+	if filter.InStockOnly {
+		where = append(where, "StockQuantity > 0")
+	}
+	if filter.CategoryID != 0 {
+		where = append(where, `ProductID IN (
+            WITH RECURSIVE subtree AS (
+                SELECT CategoryID FROM Categories WHERE CategoryID = `+args.add(filter.CategoryID)+`
+                UNION ALL
+                SELECT c.CategoryID FROM Categories c JOIN subtree s ON c.ParentID = s.CategoryID
+            )
+            SELECT pc.ProductID FROM ProductCategories pc JOIN subtree USING (CategoryID))`)
+	}
+	attributes, err := attributeConditions(filter.Attributes, &args)
+	if err != nil {
+		return nil, nil, err
+	}
+	where = append(where, attributes...)
+
+	var orderBy string
+	switch filter.Sort {
+	case proto.ProductSortOrder_PRODUCT_SORT_ORDER_NAME:
+		orderBy = "ProductName, ProductID"
+		if c := filter.After; c != nil {
+			where = append(where, "(ProductName, ProductID) > ("+args.add(c.ProductName)+", "+args.add(c.ProductID)+")")
+		}
+	case proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_ASC:
+		orderBy = "PricePerUnit, ProductID"
+		if c := filter.After; c != nil {
+			where = append(where, "(PricePerUnit, ProductID) > ("+args.add(money.String(c.Price))+"::numeric, "+args.add(c.ProductID)+")")
+		}
+	case proto.ProductSortOrder_PRODUCT_SORT_ORDER_PRICE_DESC:
+		// Цена по убыванию, при равной цене - по возрастанию ID
+		orderBy = "PricePerUnit DESC, ProductID"
+		if c := filter.After; c != nil {
+			price := args.add(money.String(c.Price))
+			where = append(where, "(PricePerUnit < "+price+"::numeric OR (PricePerUnit = "+price+"::numeric AND ProductID > "+args.add(c.ProductID)+"))")
+		}
+	default:
+		orderBy = "ProductID"
+		if c := filter.After; c != nil {
+			where = append(where, "ProductID > "+args.add(c.ProductID))
+		}
+	}
+
+	query := "SELECT " + productColumns + " FROM Catalog"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY " + orderBy + " LIMIT " + args.add(filter.PageSize+1)
+
+	rows, err := db.conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	products, err := scanProducts(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(products) <= filter.PageSize {
+		return products, nil, nil
+	}
+	products = products[:filter.PageSize]
+	last := products[len(products)-1]
+	return products, &ProductCursor{
+		ProductID:   last.ProductId,
+		ProductName: last.ProductName,
+		Price:       last.Price,
+	}, nil
+}
+
+// GetProductsByIDs возвращает найденные товары из productIDs одним запросом, по возрастанию ID.
+// Отсутствующие ID просто не попадают в результат
+func (db *catalogDB) GetProductsByIDs(productIDs []int32) ([]*proto.Product, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT `+productColumns+`
+        FROM Catalog
+        WHERE ProductID = ANY($1)
+        ORDER BY ProductID`, productIDs)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanProducts(rows)
+}
+
+// productColumns столбцы товара в порядке, который ожидает scanProducts
+const productColumns = `ProductID, ProductName, StockQuantity, PricePerUnit, Currency,
+        COALESCE(ParentProductID, 0), COALESCE(SKU, ''), VariantAttributes, Attributes, ReorderThreshold`
+
+// scanProducts читает строки из столбцов productColumns
+func scanProducts(rows pgx.Rows) ([]*proto.Product, error) {
 	var products []*proto.Product
 	for rows.Next() {
-		var product proto.Product
-		err := rows.Scan(
-			&product.ProductId,
-			 &product.ProductName, 
-			 &product.StockQuantity, 
-			 &product.PricePerUnit,
-		)
+		product, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, &product)
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
-
 	return products, nil
 }
 
-func (db *catalogDB) GetProductByID(productID int32) (string, int, float64, error) {
+// scanProduct читает товар из столбцов productColumns; extra - столбцы после них
+func scanProduct(row pgx.Row, extra ...interface{}) (*proto.Product, error) {
+	var product proto.Product
+	var price pgtype.Numeric
+	var currency string
+	var attributes map[string]interface{}
+	dest := []interface{}{
+		&product.ProductId,
+		&product.ProductName,
+		&product.StockQuantity,
+		&price,
+		&currency,
+		&product.ParentProductId,
+		&product.Sku,
+		&product.VariantAttributes,
+		&attributes,
+		&product.ReorderThreshold,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if product.Price, err = money.FromNumeric(price, currency); err != nil {
+		return nil, fmt.Errorf("product %d: %w", product.ProductId, err)
+	}
+	product.PricePerUnit = money.ToFloat(product.Price)
+	if product.Attributes, err = structpb.NewStruct(attributes); err != nil {
+		return nil, fmt.Errorf("product %d attributes: %w", product.ProductId, err)
+	}
+	return &product, nil
+}
+
+// queryArgs параметры динамически собираемого запроса
+type queryArgs []interface{}
+
+// add добавляет значение в параметры и возвращает его плейсхолдер $N
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE, чтобы искать подстроку буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (db *catalogDB) GetProductByID(productID int32) (string, int, *proto.Money, error) {
 	var productName string
 	var stockQuantity int
-	var pricePerUnit float64
+	var price pgtype.Numeric
+	var currency string
 	err := db.conn.QueryRow(context.Background(),
-			"SELECT ProductName, StockQuantity, PricePerUnit FROM Catalog WHERE ProductID=$1", 
-			productID,
-		).
-		Scan(&productName, &stockQuantity, &pricePerUnit)
+		"SELECT ProductName, StockQuantity, PricePerUnit, Currency FROM Catalog WHERE ProductID=$1",
+		productID,
+	).
+		Scan(&productName, &stockQuantity, &price, &currency)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	pricePerUnit, err := money.FromNumeric(price, currency)
 	if err != nil {
-		return "", 0, 0, err
+		return "", 0, nil, fmt.Errorf("product %d: %w", productID, err)
 	}
 	return productName, stockQuantity, pricePerUnit, nil
 }
 
-func (db *catalogDB) UpdateProduct(productID int, productName string, stockQuantity int, pricePerUnit float64) error {
-	_, err := db.conn.Exec(context.Background(),
-		"UPDATE Catalog SET ProductName=$1, StockQuantity=$2, PricePerUnit=$3 WHERE ProductID=$4",
-		productName, stockQuantity, pricePerUnit, productID)
-	return err
+// UpdateProduct заменяет название, общий остаток и цену товара. Разница в остатке
+// применяется к складу по умолчанию и записывается в журнал как корректировка.
+// Новая цена попадает в историю и действует до следующей запланированной цены
+func (db *catalogDB) UpdateProduct(productID int, productName string, stockQuantity int, price *proto.Money, actor string) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Остаток меняется раньше строки товара: триггер складов тоже блокирует сначала склад
+	adjustment := StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT, Actor: actor}
+	if err := setStockQuantity(ctx, tx, int32(productID), stockQuantity, adjustment); err != nil {
+		return err
+	}
+	if price == nil {
+		_, err = tx.Exec(ctx, "UPDATE Catalog SET ProductName=$1 WHERE ProductID=$2", productName, productID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	}
+	_, err = tx.Exec(ctx,
+		"UPDATE Catalog SET ProductName=$1, PricePerUnit=$2, Currency=$3 WHERE ProductID=$4",
+		productName, money.String(price), price.CurrencyCode, productID)
+	if err != nil {
+		return err
+	}
+	if err := changeCurrentPrice(ctx, tx, int32(productID), price, actor); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *catalogDB) UpdateProductFields(productID int32, update ProductUpdate) error {
+	sets := []string{}
+	args := queryArgs{productID}
+	if update.ProductName != nil {
+		sets = append(sets, "ProductName="+args.add(*update.ProductName))
+	}
+	if update.Price != nil {
+		sets = append(sets, "PricePerUnit="+args.add(money.String(update.Price))+", Currency="+args.add(update.Price.CurrencyCode))
+	}
+	if update.Attributes != nil {
+		encoded, err := encodeAttributes(update.Attributes)
+		if err != nil {
+			return err
+		}
+		sets = append(sets, "Attributes="+args.add(encoded)+"::jsonb")
+	}
+	if update.ReorderThreshold != nil {
+		sets = append(sets, "ReorderThreshold="+args.add(*update.ReorderThreshold))
+	}
+	if len(sets) == 0 && update.StockQuantity == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Общий остаток задается через склад по умолчанию, строку товара обновит триггер
+	if update.StockQuantity != nil {
+		adjustment := StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT, Actor: update.Actor}
+		if err := setStockQuantity(ctx, tx, productID, *update.StockQuantity, adjustment); err != nil {
+			return err
+		}
+	}
+
+	// Пустой SET не нужен, но строку все равно проверяем, чтобы вернуть ErrProductNotFound
+	query := "SELECT 1 FROM Catalog WHERE ProductID=$1"
+	if len(sets) > 0 {
+		query = "UPDATE Catalog SET " + strings.Join(sets, ", ") + " WHERE ProductID=$1"
+	}
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	if update.Price != nil {
+		if err := changeCurrentPrice(ctx, tx, productID, update.Price, update.Actor); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
 }
 
-func (db *catalogDB) DeleteProduct(productID int) error {
-	_, err := db.conn.Exec(
-		context.Background(), 
+// DeleteProduct удаляет товар вместе с вариантами. Остатки на складах удаляются
+// каскадно, поэтому перед удалением они списываются в журнале корректировкой
+func (db *catalogDB) DeleteProduct(productID int, actor string) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO StockMovements (ProductID, WarehouseID, Delta, Reason, Actor)
+        SELECT s.ProductID, s.WarehouseID, -s.Quantity, $2, $3
+        FROM (
+            SELECT ProductID, WarehouseID, Quantity
+            FROM WarehouseStock
+            WHERE Quantity > 0 AND ProductID IN (
+                SELECT ProductID FROM Catalog WHERE ProductID = $1 OR ParentProductID = $1
+            )
+            ORDER BY ProductID, WarehouseID
+            FOR UPDATE
+        ) s`,
+		productID, movementReasons[proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT], actor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movements: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
 		"DELETE FROM Catalog WHERE ProductID=$1",
 		productID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// ReserveStock списывает товар с одного склада по стратегии PRIORITY. Остаток на складе
+// уменьшается условным UPDATE, поэтому параллельные заказы не могут увести его в минус
+func (db *catalogDB) ReserveStock(productID int32, quantity int, movement StockMovement) (int, int32, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	warehouseID, err := allocateStock(ctx, tx, productID, quantity, 0, nil, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		// Ни один склад не подошел: товара нет, он продается вариантами или не хватает остатка
+		return 0, 0, db.stockError(productID)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var stockQuantity int
+	err = tx.QueryRow(ctx,
+		"SELECT StockQuantity FROM Catalog WHERE ProductID=$1",
+		productID,
+	).Scan(&stockQuantity)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stockQuantity, warehouseID, nil
+}
+
+// ReleaseStock возвращает товар на склад warehouseID (0 - склад по умолчанию)
+func (db *catalogDB) ReleaseStock(productID, warehouseID int32, quantity int, operationID string, movement StockMovement) (int, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if operationID != "" {
+		// Ключ операции записывается в той же транзакции, что и изменение остатка
+		tag, err := tx.Exec(ctx, `
+            INSERT INTO StockOperations (OperationID, ProductID, Quantity)
+            VALUES ($1, $2, $3)
+            ON CONFLICT (OperationID) DO NOTHING`,
+			operationID, productID, quantity,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record stock operation: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			// Операция уже применена - возвращаем текущий остаток
+			var stockQuantity int
+			err := tx.QueryRow(ctx,
+				"SELECT StockQuantity FROM Catalog WHERE ProductID=$1",
+				productID,
+			).Scan(&stockQuantity)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrProductNotFound
+			}
+			return stockQuantity, err
+		}
+	}
+
+	if warehouseID == 0 {
+		if warehouseID, err = defaultWarehouse(ctx, tx); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := changeWarehouseStock(ctx, tx, productID, warehouseID, quantity, movement); err != nil {
+		return 0, err
+	}
+
+	var stockQuantity int
+	err = tx.QueryRow(ctx,
+		"SELECT StockQuantity FROM Catalog WHERE ProductID=$1",
+		productID,
+	).Scan(&stockQuantity)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return stockQuantity, nil
+}
+
+// stockError определяет, почему не удалось списать товар
+func (db *catalogDB) stockError(productID int32) error {
+	var exists, hasVariants bool
+	err := db.conn.QueryRow(context.Background(), `
+        SELECT EXISTS (SELECT 1 FROM Catalog WHERE ProductID = $1),
+               EXISTS (SELECT 1 FROM Catalog WHERE ParentProductID = $1)`,
+		productID,
+	).Scan(&exists, &hasVariants)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrProductNotFound
+	}
+	if hasVariants {
+		return ErrProductHasVariants
+	}
+	return ErrInsufficientStock
 }
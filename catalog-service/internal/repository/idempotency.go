@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// IdempotencyRetention сколько хранится ключ идемпотентности.
+// После этого срока ключ можно использовать для нового запроса
+const IdempotencyRetention = 24 * time.Hour
+
+// claimIdempotencyKey занимает ключ для нового запроса. Если ключ уже
+// использован, возвращает сохраненный ProductID и claimed = false
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, key, requestHash string) (productID int, claimed bool, err error) {
+	// Просроченный ключ перезаписывается, как если бы его не было
+	tag, err := tx.Exec(ctx, `
+        INSERT INTO IdempotencyKeys (IdempotencyKey, RequestHash)
+        VALUES ($1, $2)
+        ON CONFLICT (IdempotencyKey) DO UPDATE
+        SET RequestHash = EXCLUDED.RequestHash,
+            ProductID = NULL,
+            CreatedAt = CURRENT_TIMESTAMP
+        WHERE IdempotencyKeys.CreatedAt < CURRENT_TIMESTAMP - make_interval(secs => $3)`,
+		key, requestHash, IdempotencyRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return 0, true, nil
+	}
+
+	var savedHash string
+	err = tx.QueryRow(ctx,
+		"SELECT RequestHash, ProductID FROM IdempotencyKeys WHERE IdempotencyKey = $1",
+		key,
+	).Scan(&savedHash, &productID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	if savedHash != requestHash {
+		return 0, false, ErrIdempotencyKeyMismatch
+	}
+	return productID, false, nil
+}
+
+// PurgeIdempotencyKeys удаляет ключи идемпотентности старше IdempotencyRetention
+func (db *catalogDB) PurgeIdempotencyKeys() (int, error) {
+	tag, err := db.conn.Exec(context.Background(),
+		"DELETE FROM IdempotencyKeys WHERE CreatedAt < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		IdempotencyRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,129 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"store/proto"
+	"strings"
+)
+
+// Уровни остатка товара относительно порога дозаказа
+const (
+	StockLevelOK  = "ok"
+	StockLevelLow = "low" // Остаток не выше порога дозаказа
+	StockLevelOut = "out" // Товар закончился
+)
+
+// stockLevel вычисляет уровень остатка строки Catalog. Выражение совпадает
+// с условием индекса idx_catalog_stock_alert
+const stockLevel = `(CASE WHEN StockQuantity <= 0 THEN 'out'
+                WHEN StockQuantity <= ReorderThreshold THEN 'low'
+                ELSE 'ok' END)`
+
+// StockAlert товар, уровень остатка которого изменился с последнего оповещения
+type StockAlert struct {
+	ProductID        int32
+	ProductName      string
+	StockQuantity    int32
+	ReorderThreshold int32
+	Level            string // Текущий уровень остатка
+	NotifiedLevel    string // Уровень, о котором оповещали последний раз
+}
+
+// LowStockFilter параметры выборки заканчивающихся товаров
+type LowStockFilter struct {
+	OutOfStockOnly bool
+	PageSize       int
+	After          *LowStockCursor // nil - первая страница
+}
+
+// LowStockCursor ключ последнего товара страницы заканчивающихся товаров
+type LowStockCursor struct {
+	StockQuantity int32
+	ProductID     int32
+}
+
+// GetLowStockProducts возвращает товары с остатком не выше порога дозаказа
+// от меньшего остатка к большему. Товары с вариантами не продаются сами
+// и в выборку не попадают - попадают их варианты
+func (db *catalogDB) GetLowStockProducts(filter LowStockFilter) ([]*proto.Product, *LowStockCursor, error) {
+	var args queryArgs
+
+	where := []string{"StockQuantity <= ReorderThreshold", sellable}
+	if filter.OutOfStockOnly {
+		where = append(where, "StockQuantity <= 0")
+	}
+	if c := filter.After; c != nil {
+		where = append(where, "(StockQuantity, ProductID) > ("+args.add(c.StockQuantity)+", "+args.add(c.ProductID)+")")
+	}
+
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT `+productColumns+`
+        FROM Catalog
+        WHERE `+strings.Join(where, " AND ")+`
+        ORDER BY StockQuantity, ProductID
+        LIMIT `+args.add(filter.PageSize+1),
+		args...,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	products, err := scanProducts(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(products) <= filter.PageSize {
+		return products, nil, nil
+	}
+	products = products[:filter.PageSize]
+	last := products[len(products)-1]
+	return products, &LowStockCursor{StockQuantity: last.StockQuantity, ProductID: last.ProductId}, nil
+}
+
+// GetStockAlerts возвращает до limit продаваемых товаров с ID больше afterID, у которых
+// уровень остатка отличается от уровня последнего оповещения, по возрастанию ID
+func (db *catalogDB) GetStockAlerts(afterID int32, limit int) ([]StockAlert, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT ProductID, ProductName, StockQuantity, ReorderThreshold, `+stockLevel+`, StockAlertLevel
+        FROM Catalog
+        WHERE ProductID > $1 AND `+stockLevel+` <> StockAlertLevel AND `+sellable+`
+        ORDER BY ProductID
+        LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stock alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []StockAlert
+	for rows.Next() {
+		var alert StockAlert
+		err := rows.Scan(
+			&alert.ProductID, &alert.ProductName, &alert.StockQuantity,
+			&alert.ReorderThreshold, &alert.Level, &alert.NotifiedLevel,
+		)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// SetStockAlertLevel меняет уровень последнего оповещения с from на to. Если другая
+// реплика уже записала другой уровень, строка не меняется: уровень перепроверится
+// при следующем чтении
+func (db *catalogDB) SetStockAlertLevel(productID int32, from, to string) error {
+	_, err := db.conn.Exec(context.Background(),
+		"UPDATE Catalog SET StockAlertLevel = $3 WHERE ProductID = $1 AND StockAlertLevel = $2",
+		productID, from, to,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save stock alert level: %w", err)
+	}
+	return nil
+}
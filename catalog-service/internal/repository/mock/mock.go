@@ -3,16 +3,19 @@
 //
 // Generated by this command:
 //
-//	mockgen -source=db.go -destination=mock/mock.go
+//	mockgen -source=db.go -destination=mock/mock.go -package mock
 //
 
-// Package mock_db is a generated GoMock package.
+// Package mock is a generated GoMock package.
 package mock
 
 import (
-	gomock "go.uber.org/mock/gomock"
 	reflect "reflect"
-	"store/proto"
+	db "store/catalog-service/internal/repository"
+	proto "store/proto"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
 )
 
 // MockCatalogDB is a mock of CatalogDB interface.
@@ -40,56 +43,311 @@ func (m *MockCatalogDB) EXPECT() *MockCatalogDBMockRecorder {
 }
 
 // AddProduct mocks base method.
-func (m *MockCatalogDB) AddProduct(productName string, stockQuantity int, pricePerUnit float64) (int, error) {
+func (m *MockCatalogDB) AddProduct(productName string, stockQuantity int, price *proto.Money, attributes map[string]any, idempotencyKey, requestHash, actor string) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddProduct", productName, stockQuantity, pricePerUnit)
+	ret := m.ctrl.Call(m, "AddProduct", productName, stockQuantity, price, attributes, idempotencyKey, requestHash, actor)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AddProduct indicates an expected call of AddProduct.
-func (mr *MockCatalogDBMockRecorder) AddProduct(productName, stockQuantity, pricePerUnit any) *gomock.Call {
+func (mr *MockCatalogDBMockRecorder) AddProduct(productName, stockQuantity, price, attributes, idempotencyKey, requestHash, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddProduct", reflect.TypeOf((*MockCatalogDB)(nil).AddProduct), productName, stockQuantity, price, attributes, idempotencyKey, requestHash, actor)
+}
+
+// AddProductVariant mocks base method.
+func (m *MockCatalogDB) AddProductVariant(variant db.ProductVariant) (int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddProductVariant", variant)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddProductVariant indicates an expected call of AddProductVariant.
+func (mr *MockCatalogDBMockRecorder) AddProductVariant(variant any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddProductVariant", reflect.TypeOf((*MockCatalogDB)(nil).AddProductVariant), variant)
+}
+
+// AdjustWarehouseStock mocks base method.
+func (m *MockCatalogDB) AdjustWarehouseStock(productID, warehouseID int32, delta int, movement db.StockMovement) (int, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdjustWarehouseStock", productID, warehouseID, delta, movement)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// AdjustWarehouseStock indicates an expected call of AdjustWarehouseStock.
+func (mr *MockCatalogDBMockRecorder) AdjustWarehouseStock(productID, warehouseID, delta, movement any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustWarehouseStock", reflect.TypeOf((*MockCatalogDB)(nil).AdjustWarehouseStock), productID, warehouseID, delta, movement)
+}
+
+// ApplyScheduledPrices mocks base method.
+func (m *MockCatalogDB) ApplyScheduledPrices() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyScheduledPrices")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ApplyScheduledPrices indicates an expected call of ApplyScheduledPrices.
+func (mr *MockCatalogDBMockRecorder) ApplyScheduledPrices() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyScheduledPrices", reflect.TypeOf((*MockCatalogDB)(nil).ApplyScheduledPrices))
+}
+
+// CancelPurchaseOrder mocks base method.
+func (m *MockCatalogDB) CancelPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelPurchaseOrder", purchaseOrderID)
+	ret0, _ := ret[0].(*proto.PurchaseOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelPurchaseOrder indicates an expected call of CancelPurchaseOrder.
+func (mr *MockCatalogDBMockRecorder) CancelPurchaseOrder(purchaseOrderID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelPurchaseOrder", reflect.TypeOf((*MockCatalogDB)(nil).CancelPurchaseOrder), purchaseOrderID)
+}
+
+// CancelReservation mocks base method.
+func (m *MockCatalogDB) CancelReservation(reservationID int32, actor string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelReservation", reservationID, actor)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelReservation indicates an expected call of CancelReservation.
+func (mr *MockCatalogDBMockRecorder) CancelReservation(reservationID, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelReservation", reflect.TypeOf((*MockCatalogDB)(nil).CancelReservation), reservationID, actor)
+}
+
+// CommitReservation mocks base method.
+func (m *MockCatalogDB) CommitReservation(reservationID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommitReservation", reservationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommitReservation indicates an expected call of CommitReservation.
+func (mr *MockCatalogDBMockRecorder) CommitReservation(reservationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitReservation", reflect.TypeOf((*MockCatalogDB)(nil).CommitReservation), reservationID)
+}
+
+// CreateCategory mocks base method.
+func (m *MockCatalogDB) CreateCategory(name string, parentID int32) (*proto.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateCategory", name, parentID)
+	ret0, _ := ret[0].(*proto.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateCategory indicates an expected call of CreateCategory.
+func (mr *MockCatalogDBMockRecorder) CreateCategory(name, parentID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCatalogDB)(nil).CreateCategory), name, parentID)
+}
+
+// CreatePurchaseOrder mocks base method.
+func (m *MockCatalogDB) CreatePurchaseOrder(supplierID, warehouseID int32, items []*proto.PurchaseOrderLine) (*proto.PurchaseOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePurchaseOrder", supplierID, warehouseID, items)
+	ret0, _ := ret[0].(*proto.PurchaseOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePurchaseOrder indicates an expected call of CreatePurchaseOrder.
+func (mr *MockCatalogDBMockRecorder) CreatePurchaseOrder(supplierID, warehouseID, items any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePurchaseOrder", reflect.TypeOf((*MockCatalogDB)(nil).CreatePurchaseOrder), supplierID, warehouseID, items)
+}
+
+// CreateReservation mocks base method.
+func (m *MockCatalogDB) CreateReservation(items []*proto.ReservationItem, allocation *proto.Allocation, ttl time.Duration, movement db.StockMovement) (*db.Reservation, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReservation", items, allocation, ttl, movement)
+	ret0, _ := ret[0].(*db.Reservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReservation indicates an expected call of CreateReservation.
+func (mr *MockCatalogDBMockRecorder) CreateReservation(items, allocation, ttl, movement any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*MockCatalogDB)(nil).CreateReservation), items, allocation, ttl, movement)
+}
+
+// CreateSupplier mocks base method.
+func (m *MockCatalogDB) CreateSupplier(name, email, phone string) (*proto.Supplier, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSupplier", name, email, phone)
+	ret0, _ := ret[0].(*proto.Supplier)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSupplier indicates an expected call of CreateSupplier.
+func (mr *MockCatalogDBMockRecorder) CreateSupplier(name, email, phone any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSupplier", reflect.TypeOf((*MockCatalogDB)(nil).CreateSupplier), name, email, phone)
+}
+
+// CreateWarehouse mocks base method.
+func (m *MockCatalogDB) CreateWarehouse(name string, priority int32, location *proto.GeoPoint, active bool) (*proto.Warehouse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWarehouse", name, priority, location, active)
+	ret0, _ := ret[0].(*proto.Warehouse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWarehouse indicates an expected call of CreateWarehouse.
+func (mr *MockCatalogDBMockRecorder) CreateWarehouse(name, priority, location, active any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWarehouse", reflect.TypeOf((*MockCatalogDB)(nil).CreateWarehouse), name, priority, location, active)
+}
+
+// DeleteCategory mocks base method.
+func (m *MockCatalogDB) DeleteCategory(categoryID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCategory", categoryID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCategory indicates an expected call of DeleteCategory.
+func (mr *MockCatalogDBMockRecorder) DeleteCategory(categoryID any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddProduct", reflect.TypeOf((*MockCatalogDB)(nil).AddProduct), productName, stockQuantity, pricePerUnit)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCatalogDB)(nil).DeleteCategory), categoryID)
 }
 
 // DeleteProduct mocks base method.
-func (m *MockCatalogDB) DeleteProduct(productID int) error {
+func (m *MockCatalogDB) DeleteProduct(productID int, actor string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeleteProduct", productID)
+	ret := m.ctrl.Call(m, "DeleteProduct", productID, actor)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteProduct indicates an expected call of DeleteProduct.
-func (mr *MockCatalogDBMockRecorder) DeleteProduct(productID any) *gomock.Call {
+func (mr *MockCatalogDBMockRecorder) DeleteProduct(productID, actor any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockCatalogDB)(nil).DeleteProduct), productID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockCatalogDB)(nil).DeleteProduct), productID, actor)
+}
+
+// ExpireReservations mocks base method.
+func (m *MockCatalogDB) ExpireReservations() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExpireReservations")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExpireReservations indicates an expected call of ExpireReservations.
+func (mr *MockCatalogDBMockRecorder) ExpireReservations() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExpireReservations", reflect.TypeOf((*MockCatalogDB)(nil).ExpireReservations))
 }
 
 // GetAllProducts mocks base method.
-func (m *MockCatalogDB) GetAllProducts() ([]*proto.Product, error) {
+func (m *MockCatalogDB) GetAllProducts(filter db.ProductFilter) ([]*proto.Product, *db.ProductCursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllProducts")
+	ret := m.ctrl.Call(m, "GetAllProducts", filter)
 	ret0, _ := ret[0].([]*proto.Product)
+	ret1, _ := ret[1].(*db.ProductCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetAllProducts indicates an expected call of GetAllProducts.
+func (mr *MockCatalogDBMockRecorder) GetAllProducts(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllProducts", reflect.TypeOf((*MockCatalogDB)(nil).GetAllProducts), filter)
+}
+
+// GetCategories mocks base method.
+func (m *MockCatalogDB) GetCategories(rootID int32) ([]*proto.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCategories", rootID)
+	ret0, _ := ret[0].([]*proto.Category)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllProducts indicates an expected call of GetAllProducts.
-func (mr *MockCatalogDBMockRecorder) GetAllProducts() *gomock.Call {
+// GetCategories indicates an expected call of GetCategories.
+func (mr *MockCatalogDBMockRecorder) GetCategories(rootID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockCatalogDB)(nil).GetCategories), rootID)
+}
+
+// GetEffectivePrices mocks base method.
+func (m *MockCatalogDB) GetEffectivePrices(productIDs []int32, at time.Time) (map[int32]*proto.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEffectivePrices", productIDs, at)
+	ret0, _ := ret[0].(map[int32]*proto.Money)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEffectivePrices indicates an expected call of GetEffectivePrices.
+func (mr *MockCatalogDBMockRecorder) GetEffectivePrices(productIDs, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEffectivePrices", reflect.TypeOf((*MockCatalogDB)(nil).GetEffectivePrices), productIDs, at)
+}
+
+// GetLowStockProducts mocks base method.
+func (m *MockCatalogDB) GetLowStockProducts(filter db.LowStockFilter) ([]*proto.Product, *db.LowStockCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLowStockProducts", filter)
+	ret0, _ := ret[0].([]*proto.Product)
+	ret1, _ := ret[1].(*db.LowStockCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetLowStockProducts indicates an expected call of GetLowStockProducts.
+func (mr *MockCatalogDBMockRecorder) GetLowStockProducts(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLowStockProducts", reflect.TypeOf((*MockCatalogDB)(nil).GetLowStockProducts), filter)
+}
+
+// GetPriceHistory mocks base method.
+func (m *MockCatalogDB) GetPriceHistory(productID int32) ([]*proto.ProductPrice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPriceHistory", productID)
+	ret0, _ := ret[0].([]*proto.ProductPrice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPriceHistory indicates an expected call of GetPriceHistory.
+func (mr *MockCatalogDBMockRecorder) GetPriceHistory(productID any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllProducts", reflect.TypeOf((*MockCatalogDB)(nil).GetAllProducts))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPriceHistory", reflect.TypeOf((*MockCatalogDB)(nil).GetPriceHistory), productID)
 }
 
 // GetProductByID mocks base method.
-func (m *MockCatalogDB) GetProductByID(productID int32) (string, int, float64, error) {
+func (m *MockCatalogDB) GetProductByID(productID int32) (string, int, *proto.Money, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetProductByID", productID)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(int)
-	ret2, _ := ret[2].(float64)
+	ret2, _ := ret[2].(*proto.Money)
 	ret3, _ := ret[3].(error)
 	return ret0, ret1, ret2, ret3
 }
@@ -100,16 +358,439 @@ func (mr *MockCatalogDBMockRecorder) GetProductByID(productID any) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductByID", reflect.TypeOf((*MockCatalogDB)(nil).GetProductByID), productID)
 }
 
+// GetProductCategories mocks base method.
+func (m *MockCatalogDB) GetProductCategories(productIDs []int32) (map[int32][]*proto.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductCategories", productIDs)
+	ret0, _ := ret[0].(map[int32][]*proto.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductCategories indicates an expected call of GetProductCategories.
+func (mr *MockCatalogDBMockRecorder) GetProductCategories(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductCategories", reflect.TypeOf((*MockCatalogDB)(nil).GetProductCategories), productIDs)
+}
+
+// GetProductVariants mocks base method.
+func (m *MockCatalogDB) GetProductVariants(productIDs []int32) (map[int32][]*proto.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductVariants", productIDs)
+	ret0, _ := ret[0].(map[int32][]*proto.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductVariants indicates an expected call of GetProductVariants.
+func (mr *MockCatalogDBMockRecorder) GetProductVariants(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductVariants", reflect.TypeOf((*MockCatalogDB)(nil).GetProductVariants), productIDs)
+}
+
+// GetProductsByIDs mocks base method.
+func (m *MockCatalogDB) GetProductsByIDs(productIDs []int32) ([]*proto.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductsByIDs", productIDs)
+	ret0, _ := ret[0].([]*proto.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductsByIDs indicates an expected call of GetProductsByIDs.
+func (mr *MockCatalogDBMockRecorder) GetProductsByIDs(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductsByIDs", reflect.TypeOf((*MockCatalogDB)(nil).GetProductsByIDs), productIDs)
+}
+
+// GetProductsBySKUs mocks base method.
+func (m *MockCatalogDB) GetProductsBySKUs(skus []string) ([]*proto.Product, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductsBySKUs", skus)
+	ret0, _ := ret[0].([]*proto.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductsBySKUs indicates an expected call of GetProductsBySKUs.
+func (mr *MockCatalogDBMockRecorder) GetProductsBySKUs(skus any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductsBySKUs", reflect.TypeOf((*MockCatalogDB)(nil).GetProductsBySKUs), skus)
+}
+
+// GetPurchaseOrder mocks base method.
+func (m *MockCatalogDB) GetPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPurchaseOrder", purchaseOrderID)
+	ret0, _ := ret[0].(*proto.PurchaseOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPurchaseOrder indicates an expected call of GetPurchaseOrder.
+func (mr *MockCatalogDBMockRecorder) GetPurchaseOrder(purchaseOrderID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPurchaseOrder", reflect.TypeOf((*MockCatalogDB)(nil).GetPurchaseOrder), purchaseOrderID)
+}
+
+// GetStockAlerts mocks base method.
+func (m *MockCatalogDB) GetStockAlerts(afterID int32, limit int) ([]db.StockAlert, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStockAlerts", afterID, limit)
+	ret0, _ := ret[0].([]db.StockAlert)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStockAlerts indicates an expected call of GetStockAlerts.
+func (mr *MockCatalogDBMockRecorder) GetStockAlerts(afterID, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockAlerts", reflect.TypeOf((*MockCatalogDB)(nil).GetStockAlerts), afterID, limit)
+}
+
+// GetStockChanges mocks base method.
+func (m *MockCatalogDB) GetStockChanges(afterSequence int64, productIDs []int32, limit int) ([]*proto.StockChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStockChanges", afterSequence, productIDs, limit)
+	ret0, _ := ret[0].([]*proto.StockChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStockChanges indicates an expected call of GetStockChanges.
+func (mr *MockCatalogDBMockRecorder) GetStockChanges(afterSequence, productIDs, limit any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockChanges", reflect.TypeOf((*MockCatalogDB)(nil).GetStockChanges), afterSequence, productIDs, limit)
+}
+
+// GetStockLevels mocks base method.
+func (m *MockCatalogDB) GetStockLevels(productIDs []int32) (map[int32][]*proto.StockLevel, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStockLevels", productIDs)
+	ret0, _ := ret[0].(map[int32][]*proto.StockLevel)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStockLevels indicates an expected call of GetStockLevels.
+func (mr *MockCatalogDBMockRecorder) GetStockLevels(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockLevels", reflect.TypeOf((*MockCatalogDB)(nil).GetStockLevels), productIDs)
+}
+
+// GetStockSnapshot mocks base method.
+func (m *MockCatalogDB) GetStockSnapshot(productIDs []int32) ([]*proto.StockChange, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStockSnapshot", productIDs)
+	ret0, _ := ret[0].([]*proto.StockChange)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetStockSnapshot indicates an expected call of GetStockSnapshot.
+func (mr *MockCatalogDBMockRecorder) GetStockSnapshot(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockSnapshot", reflect.TypeOf((*MockCatalogDB)(nil).GetStockSnapshot), productIDs)
+}
+
+// GetSuppliers mocks base method.
+func (m *MockCatalogDB) GetSuppliers() ([]*proto.Supplier, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSuppliers")
+	ret0, _ := ret[0].([]*proto.Supplier)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSuppliers indicates an expected call of GetSuppliers.
+func (mr *MockCatalogDBMockRecorder) GetSuppliers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSuppliers", reflect.TypeOf((*MockCatalogDB)(nil).GetSuppliers))
+}
+
+// GetWarehouses mocks base method.
+func (m *MockCatalogDB) GetWarehouses(activeOnly bool) ([]*proto.Warehouse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWarehouses", activeOnly)
+	ret0, _ := ret[0].([]*proto.Warehouse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWarehouses indicates an expected call of GetWarehouses.
+func (mr *MockCatalogDBMockRecorder) GetWarehouses(activeOnly any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWarehouses", reflect.TypeOf((*MockCatalogDB)(nil).GetWarehouses), activeOnly)
+}
+
+// ListPurchaseOrders mocks base method.
+func (m *MockCatalogDB) ListPurchaseOrders(filter db.PurchaseOrderFilter) ([]*proto.PurchaseOrder, int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPurchaseOrders", filter)
+	ret0, _ := ret[0].([]*proto.PurchaseOrder)
+	ret1, _ := ret[1].(int32)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListPurchaseOrders indicates an expected call of ListPurchaseOrders.
+func (mr *MockCatalogDBMockRecorder) ListPurchaseOrders(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPurchaseOrders", reflect.TypeOf((*MockCatalogDB)(nil).ListPurchaseOrders), filter)
+}
+
+// ListStockMovements mocks base method.
+func (m *MockCatalogDB) ListStockMovements(filter db.StockMovementFilter) ([]*proto.StockMovement, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListStockMovements", filter)
+	ret0, _ := ret[0].([]*proto.StockMovement)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListStockMovements indicates an expected call of ListStockMovements.
+func (mr *MockCatalogDBMockRecorder) ListStockMovements(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListStockMovements", reflect.TypeOf((*MockCatalogDB)(nil).ListStockMovements), filter)
+}
+
+// PurgeIdempotencyKeys mocks base method.
+func (m *MockCatalogDB) PurgeIdempotencyKeys() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeIdempotencyKeys")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeIdempotencyKeys indicates an expected call of PurgeIdempotencyKeys.
+func (mr *MockCatalogDBMockRecorder) PurgeIdempotencyKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeIdempotencyKeys", reflect.TypeOf((*MockCatalogDB)(nil).PurgeIdempotencyKeys))
+}
+
+// PurgeStockChanges mocks base method.
+func (m *MockCatalogDB) PurgeStockChanges() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeStockChanges")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeStockChanges indicates an expected call of PurgeStockChanges.
+func (mr *MockCatalogDBMockRecorder) PurgeStockChanges() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeStockChanges", reflect.TypeOf((*MockCatalogDB)(nil).PurgeStockChanges))
+}
+
+// ReceivePurchaseOrder mocks base method.
+func (m *MockCatalogDB) ReceivePurchaseOrder(purchaseOrderID int32, items []*proto.PurchaseOrderLine, operationID, actor string) (*proto.PurchaseOrder, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReceivePurchaseOrder", purchaseOrderID, items, operationID, actor)
+	ret0, _ := ret[0].(*proto.PurchaseOrder)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceivePurchaseOrder indicates an expected call of ReceivePurchaseOrder.
+func (mr *MockCatalogDBMockRecorder) ReceivePurchaseOrder(purchaseOrderID, items, operationID, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceivePurchaseOrder", reflect.TypeOf((*MockCatalogDB)(nil).ReceivePurchaseOrder), purchaseOrderID, items, operationID, actor)
+}
+
+// ReconcileStock mocks base method.
+func (m *MockCatalogDB) ReconcileStock() ([]db.StockDrift, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileStock")
+	ret0, _ := ret[0].([]db.StockDrift)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileStock indicates an expected call of ReconcileStock.
+func (mr *MockCatalogDBMockRecorder) ReconcileStock() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileStock", reflect.TypeOf((*MockCatalogDB)(nil).ReconcileStock))
+}
+
+// ReleaseStock mocks base method.
+func (m *MockCatalogDB) ReleaseStock(productID, warehouseID int32, quantity int, operationID string, movement db.StockMovement) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseStock", productID, warehouseID, quantity, operationID, movement)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseStock indicates an expected call of ReleaseStock.
+func (mr *MockCatalogDBMockRecorder) ReleaseStock(productID, warehouseID, quantity, operationID, movement any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseStock", reflect.TypeOf((*MockCatalogDB)(nil).ReleaseStock), productID, warehouseID, quantity, operationID, movement)
+}
+
+// ReserveStock mocks base method.
+func (m *MockCatalogDB) ReserveStock(productID int32, quantity int, movement db.StockMovement) (int, int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveStock", productID, quantity, movement)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(int32)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveStock indicates an expected call of ReserveStock.
+func (mr *MockCatalogDBMockRecorder) ReserveStock(productID, quantity, movement any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveStock", reflect.TypeOf((*MockCatalogDB)(nil).ReserveStock), productID, quantity, movement)
+}
+
+// SchedulePriceChange mocks base method.
+func (m *MockCatalogDB) SchedulePriceChange(productID int32, price *proto.Money, from, to *time.Time, actor string) (*proto.ProductPrice, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SchedulePriceChange", productID, price, from, to, actor)
+	ret0, _ := ret[0].(*proto.ProductPrice)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SchedulePriceChange indicates an expected call of SchedulePriceChange.
+func (mr *MockCatalogDBMockRecorder) SchedulePriceChange(productID, price, from, to, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SchedulePriceChange", reflect.TypeOf((*MockCatalogDB)(nil).SchedulePriceChange), productID, price, from, to, actor)
+}
+
+// SearchProducts mocks base method.
+func (m *MockCatalogDB) SearchProducts(filter db.SearchFilter) ([]*proto.ProductSearchResult, *db.SearchCursor, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchProducts", filter)
+	ret0, _ := ret[0].([]*proto.ProductSearchResult)
+	ret1, _ := ret[1].(*db.SearchCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchProducts indicates an expected call of SearchProducts.
+func (mr *MockCatalogDBMockRecorder) SearchProducts(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockCatalogDB)(nil).SearchProducts), filter)
+}
+
+// SequenceStockChanges mocks base method.
+func (m *MockCatalogDB) SequenceStockChanges() (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SequenceStockChanges")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SequenceStockChanges indicates an expected call of SequenceStockChanges.
+func (mr *MockCatalogDBMockRecorder) SequenceStockChanges() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SequenceStockChanges", reflect.TypeOf((*MockCatalogDB)(nil).SequenceStockChanges))
+}
+
+// SetProductCategories mocks base method.
+func (m *MockCatalogDB) SetProductCategories(productID int32, categoryIDs []int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetProductCategories", productID, categoryIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetProductCategories indicates an expected call of SetProductCategories.
+func (mr *MockCatalogDBMockRecorder) SetProductCategories(productID, categoryIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProductCategories", reflect.TypeOf((*MockCatalogDB)(nil).SetProductCategories), productID, categoryIDs)
+}
+
+// SetStockAlertLevel mocks base method.
+func (m *MockCatalogDB) SetStockAlertLevel(productID int32, from, to string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStockAlertLevel", productID, from, to)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetStockAlertLevel indicates an expected call of SetStockAlertLevel.
+func (mr *MockCatalogDBMockRecorder) SetStockAlertLevel(productID, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStockAlertLevel", reflect.TypeOf((*MockCatalogDB)(nil).SetStockAlertLevel), productID, from, to)
+}
+
+// StockSequenceRange mocks base method.
+func (m *MockCatalogDB) StockSequenceRange() (int64, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StockSequenceRange")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// StockSequenceRange indicates an expected call of StockSequenceRange.
+func (mr *MockCatalogDBMockRecorder) StockSequenceRange() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StockSequenceRange", reflect.TypeOf((*MockCatalogDB)(nil).StockSequenceRange))
+}
+
+// UpdateCategory mocks base method.
+func (m *MockCatalogDB) UpdateCategory(categoryID int32, update db.CategoryUpdate) (*proto.Category, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCategory", categoryID, update)
+	ret0, _ := ret[0].(*proto.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateCategory indicates an expected call of UpdateCategory.
+func (mr *MockCatalogDBMockRecorder) UpdateCategory(categoryID, update any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCategory", reflect.TypeOf((*MockCatalogDB)(nil).UpdateCategory), categoryID, update)
+}
+
 // UpdateProduct mocks base method.
-func (m *MockCatalogDB) UpdateProduct(productID int, productName string, stockQuantity int, pricePerUnit float64) error {
+func (m *MockCatalogDB) UpdateProduct(productID int, productName string, stockQuantity int, price *proto.Money, actor string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateProduct", productID, productName, stockQuantity, pricePerUnit)
+	ret := m.ctrl.Call(m, "UpdateProduct", productID, productName, stockQuantity, price, actor)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateProduct indicates an expected call of UpdateProduct.
-func (mr *MockCatalogDBMockRecorder) UpdateProduct(productID, productName, stockQuantity, pricePerUnit any) *gomock.Call {
+func (mr *MockCatalogDBMockRecorder) UpdateProduct(productID, productName, stockQuantity, price, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockCatalogDB)(nil).UpdateProduct), productID, productName, stockQuantity, price, actor)
+}
+
+// UpdateProductFields mocks base method.
+func (m *MockCatalogDB) UpdateProductFields(productID int32, update db.ProductUpdate) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateProductFields", productID, update)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateProductFields indicates an expected call of UpdateProductFields.
+func (mr *MockCatalogDBMockRecorder) UpdateProductFields(productID, update any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProductFields", reflect.TypeOf((*MockCatalogDB)(nil).UpdateProductFields), productID, update)
+}
+
+// UpdateWarehouse mocks base method.
+func (m *MockCatalogDB) UpdateWarehouse(warehouseID int32, update db.WarehouseUpdate) (*proto.Warehouse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWarehouse", warehouseID, update)
+	ret0, _ := ret[0].(*proto.Warehouse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateWarehouse indicates an expected call of UpdateWarehouse.
+func (mr *MockCatalogDBMockRecorder) UpdateWarehouse(warehouseID, update any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockCatalogDB)(nil).UpdateProduct), productID, productName, stockQuantity, pricePerUnit)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWarehouse", reflect.TypeOf((*MockCatalogDB)(nil).UpdateWarehouse), warehouseID, update)
 }
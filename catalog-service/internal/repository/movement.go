@@ -0,0 +1,194 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"store/proto"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ExpiryActor инициатор возврата товара по просроченным резервам
+const ExpiryActor = "reservation-expiry"
+
+// StockMovement причина изменения остатка для журнала движений
+type StockMovement struct {
+	Reason          proto.StockMovementReason
+	OrderID         int32 // 0 - движение без заказа
+	ReservationID   int32 // 0 - движение без резерва
+	PurchaseOrderID int32 // 0 - движение без заказа поставщику
+	Actor           string
+}
+
+// movementReasons значения столбца StockMovements.Reason
+var movementReasons = map[proto.StockMovementReason]string{
+	proto.StockMovementReason_STOCK_MOVEMENT_REASON_SALE:       "sale",
+	proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN:     "return",
+	proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK:    "restock",
+	proto.StockMovementReason_STOCK_MOVEMENT_REASON_ADJUSTMENT: "adjustment",
+}
+
+// StockMovementFilter параметры выборки журнала движений; нулевые поля не ограничивают выборку
+type StockMovementFilter struct {
+	ProductID       int32
+	WarehouseID     int32
+	OrderID         int32
+	PurchaseOrderID int32
+	Reasons         []proto.StockMovementReason
+	PageSize        int
+	Before          int64 // MovementID последней записи предыдущей страницы; 0 - первая страница
+}
+
+// StockDrift расхождение записанного остатка с остатком, пересчитанным по журналу
+type StockDrift struct {
+	ProductID   int32
+	WarehouseID int32 // 0 - общий остаток товара в Catalog
+	Quantity    int   // Записанный остаток
+	Expected    int   // Сумма движений по журналу
+}
+
+// recordMovement записывает движение в журнал. Вызывается в транзакции,
+// которая меняет остаток, поэтому журнал не расходится с WarehouseStock
+func recordMovement(ctx context.Context, tx pgx.Tx, productID, warehouseID int32, delta int, movement StockMovement) error {
+	reason, ok := movementReasons[movement.Reason]
+	if !ok {
+		return fmt.Errorf("unknown stock movement reason %v", movement.Reason)
+	}
+	_, err := tx.Exec(ctx, `
+        INSERT INTO StockMovements (ProductID, WarehouseID, Delta, Reason, OrderID, ReservationID, PurchaseOrderID, Actor)
+        VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, 0), NULLIF($7, 0), $8)`,
+		productID, warehouseID, delta, reason, movement.OrderID, movement.ReservationID, movement.PurchaseOrderID, movement.Actor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movement: %w", err)
+	}
+	return nil
+}
+
+// ListStockMovements возвращает страницу журнала от новых движений к старым и
+// MovementID последней записи для следующей страницы (0, если страница последняя)
+func (db *catalogDB) ListStockMovements(filter StockMovementFilter) ([]*proto.StockMovement, int64, error) {
+	var where []string
+	var args queryArgs
+
+	if filter.ProductID != 0 {
+		where = append(where, "ProductID = "+args.add(filter.ProductID))
+	}
+	if filter.WarehouseID != 0 {
+		where = append(where, "WarehouseID = "+args.add(filter.WarehouseID))
+	}
+	if filter.OrderID != 0 {
+		where = append(where, "OrderID = "+args.add(filter.OrderID))
+	}
+	if filter.PurchaseOrderID != 0 {
+		where = append(where, "PurchaseOrderID = "+args.add(filter.PurchaseOrderID))
+	}
+	if len(filter.Reasons) > 0 {
+		reasons := make([]string, 0, len(filter.Reasons))
+		for _, reason := range filter.Reasons {
+			value, ok := movementReasons[reason]
+			if !ok {
+				return nil, 0, fmt.Errorf("unknown stock movement reason %v", reason)
+			}
+			reasons = append(reasons, value)
+		}
+		where = append(where, "Reason = ANY("+args.add(reasons)+")")
+	}
+	if filter.Before != 0 {
+		where = append(where, "MovementID < "+args.add(filter.Before))
+	}
+
+	query := `SELECT MovementID, ProductID, WarehouseID, Delta, Reason,
+               COALESCE(OrderID, 0), COALESCE(ReservationID, 0), COALESCE(PurchaseOrderID, 0), Actor, CreatedAt
+        FROM StockMovements`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY MovementID DESC LIMIT " + args.add(filter.PageSize+1)
+
+	rows, err := db.conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read stock movements: %w", err)
+	}
+	defer rows.Close()
+
+	reasons := make(map[string]proto.StockMovementReason, len(movementReasons))
+	for reason, value := range movementReasons {
+		reasons[value] = reason
+	}
+
+	var movements []*proto.StockMovement
+	for rows.Next() {
+		var movement proto.StockMovement
+		var reason string
+		var createdAt time.Time
+		err := rows.Scan(
+			&movement.MovementId, &movement.ProductId, &movement.WarehouseId, &movement.Delta, &reason,
+			&movement.OrderId, &movement.ReservationId, &movement.PurchaseOrderId, &movement.Actor, &createdAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		movement.Reason = reasons[reason]
+		movement.CreatedAt = createdAt.Format(time.RFC3339)
+		movements = append(movements, &movement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if len(movements) <= filter.PageSize {
+		return movements, 0, nil
+	}
+	movements = movements[:filter.PageSize]
+	return movements, movements[len(movements)-1].MovementId, nil
+}
+
+// ReconcileStock пересчитывает остатки по журналу движений и возвращает расхождения:
+// остатки на складах, не равные сумме их движений, и общие остатки товаров,
+// не равные сумме движений по всем складам. Чтение идет в одном снимке базы
+func (db *catalogDB) ReconcileStock() ([]StockDrift, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// У удаленного товара нет ни строки остатка, ни товара, а движения в сумме дают 0
+	rows, err := tx.Query(ctx, `
+        WITH ledger AS (
+            SELECT ProductID, WarehouseID, SUM(Delta) AS Quantity
+            FROM StockMovements
+            GROUP BY ProductID, WarehouseID
+        )
+        SELECT COALESCE(s.ProductID, l.ProductID), COALESCE(s.WarehouseID, l.WarehouseID),
+               COALESCE(s.Quantity, 0)::bigint, COALESCE(l.Quantity, 0)::bigint
+        FROM WarehouseStock s
+        FULL JOIN ledger l ON l.ProductID = s.ProductID AND l.WarehouseID = s.WarehouseID
+        WHERE COALESCE(s.Quantity, 0) <> COALESCE(l.Quantity, 0)
+        UNION ALL
+        SELECT c.ProductID, 0, c.StockQuantity::bigint, COALESCE(SUM(l.Quantity), 0)::bigint
+        FROM Catalog c
+        LEFT JOIN ledger l ON l.ProductID = c.ProductID
+        GROUP BY c.ProductID, c.StockQuantity
+        HAVING c.StockQuantity <> COALESCE(SUM(l.Quantity), 0)
+        ORDER BY 1, 2`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile stock: %w", err)
+	}
+	defer rows.Close()
+
+	var drifts []StockDrift
+	for rows.Next() {
+		var drift StockDrift
+		if err := rows.Scan(&drift.ProductID, &drift.WarehouseID, &drift.Quantity, &drift.Expected); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, drift)
+	}
+	return drifts, rows.Err()
+}
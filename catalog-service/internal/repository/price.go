@@ -0,0 +1,301 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/money"
+	"store/proto"
+	"time"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+// ErrEmptyPriceInterval возвращается, если effective_to не позже начала интервала
+var ErrEmptyPriceInterval = errors.New("price interval is empty")
+
+const productPriceColumns = "PriceID, ProductID, Price, Currency, EffectiveFrom, EffectiveTo, Actor, CreatedAt"
+
+// SchedulePriceChange назначает цену товара на интервал [from, to). from nil или в прошлом -
+// с текущего момента по часам базы, to nil - бессрочно. Цены, пересекающиеся с интервалом, обрезаются,
+// а цена, которая действовала бы после to, продолжает действовать с to
+func (db *catalogDB) SchedulePriceChange(productID int32, price *proto.Money, from, to *time.Time, actor string) (*proto.ProductPrice, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокировка товара упорядочивает изменения его интервалов цен
+	var now time.Time
+	err = tx.QueryRow(ctx,
+		"SELECT now() FROM Catalog WHERE ProductID = $1 FOR UPDATE",
+		productID,
+	).Scan(&now)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Прошлое в истории цен не переписывается: from из допуска на расхождение часов
+	// сдвигается на текущий момент
+	if from == nil || from.Before(now) {
+		from = &now
+	}
+	if to != nil && !to.After(*from) {
+		return nil, ErrEmptyPriceInterval
+	}
+
+	record, err := setPrice(ctx, tx, productID, price, *from, to, actor)
+	if err != nil {
+		return nil, err
+	}
+	// Цена, которая действует уже сейчас, сразу попадает в Catalog
+	if !from.After(now) {
+		_, err := tx.Exec(ctx,
+			"UPDATE Catalog SET PricePerUnit = $2, Currency = $3 WHERE ProductID = $1",
+			productID, money.String(price), price.CurrencyCode,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return record, nil
+}
+
+// GetEffectivePrices возвращает цены товаров, действующие в момент at, по ID товара.
+// Товара без цены на этот момент в результате нет
+func (db *catalogDB) GetEffectivePrices(productIDs []int32, at time.Time) (map[int32]*proto.Money, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT ProductID, Price, Currency
+        FROM ProductPrices
+        WHERE ProductID = ANY($1)
+          AND EffectiveFrom <= $2 AND (EffectiveTo IS NULL OR EffectiveTo > $2)`,
+		productIDs, at,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read effective prices: %w", err)
+	}
+	defer rows.Close()
+
+	prices := make(map[int32]*proto.Money, len(productIDs))
+	for rows.Next() {
+		var productID int32
+		var price pgtype.Numeric
+		var currency string
+		if err := rows.Scan(&productID, &price, &currency); err != nil {
+			return nil, err
+		}
+		if prices[productID], err = money.FromNumeric(price, currency); err != nil {
+			return nil, fmt.Errorf("product %d: %w", productID, err)
+		}
+	}
+	return prices, rows.Err()
+}
+
+// GetPriceHistory возвращает все цены товара, включая запланированные, по EffectiveFrom
+func (db *catalogDB) GetPriceHistory(productID int32) ([]*proto.ProductPrice, error) {
+	ctx := context.Background()
+
+	rows, err := db.conn.Query(ctx, `
+        SELECT `+productPriceColumns+`
+        FROM ProductPrices
+        WHERE ProductID = $1
+        ORDER BY EffectiveFrom`,
+		productID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price history: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []*proto.ProductPrice
+	for rows.Next() {
+		price, err := scanProductPrice(rows)
+		if err != nil {
+			return nil, err
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(prices) > 0 {
+		return prices, nil
+	}
+
+	// Пустая история бывает только у товара, которого нет
+	var exists bool
+	err = db.conn.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM Catalog WHERE ProductID = $1)",
+		productID,
+	).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrProductNotFound
+	}
+	return nil, nil
+}
+
+// ApplyScheduledPrices переносит в Catalog цены, которые начали действовать,
+// и возвращает число товаров с новой ценой
+func (db *catalogDB) ApplyScheduledPrices() (int, error) {
+	tag, err := db.conn.Exec(context.Background(), `
+        UPDATE Catalog c
+        SET PricePerUnit = p.Price, Currency = p.Currency
+        FROM ProductPrices p
+        WHERE p.ProductID = c.ProductID
+          AND p.EffectiveFrom <= now() AND (p.EffectiveTo IS NULL OR p.EffectiveTo > now())
+          AND (c.PricePerUnit, c.Currency) IS DISTINCT FROM (p.Price, p.Currency)`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to apply scheduled prices: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// insertInitialPrice начинает историю цен нового товара
+func insertInitialPrice(ctx context.Context, tx pgx.Tx, productID int32, price *proto.Money, actor string) error {
+	_, err := tx.Exec(ctx, `
+        INSERT INTO ProductPrices (ProductID, Price, Currency, EffectiveFrom, Actor)
+        VALUES ($1, $2, $3, now(), $4)`,
+		productID, money.String(price), price.CurrencyCode, actor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record price: %w", err)
+	}
+	return nil
+}
+
+// changeCurrentPrice меняет цену товара с текущего момента до следующей запланированной
+// цены, чтобы правка цены не отменяла запланированные изменения. Строка товара
+// должна быть заблокирована вызывающим
+func changeCurrentPrice(ctx context.Context, tx pgx.Tx, productID int32, price *proto.Money, actor string) error {
+	var now time.Time
+	var next *time.Time
+	var unchanged bool
+	err := tx.QueryRow(ctx, `
+        SELECT now(),
+               (SELECT MIN(EffectiveFrom) FROM ProductPrices
+                WHERE ProductID = $1 AND EffectiveFrom > now()),
+               EXISTS (SELECT 1 FROM ProductPrices
+                       WHERE ProductID = $1 AND Price = $2::numeric AND Currency = $3
+                         AND EffectiveFrom <= now() AND (EffectiveTo IS NULL OR EffectiveTo > now()))`,
+		productID, money.String(price), price.CurrencyCode,
+	).Scan(&now, &next, &unchanged)
+	if err != nil {
+		return err
+	}
+	if unchanged {
+		return nil
+	}
+	_, err = setPrice(ctx, tx, productID, price, now, next, actor)
+	return err
+}
+
+// setPrice записывает цену на интервал [from, to) и подрезает пересекающиеся с ним
+// интервалы: часть до from и часть после to сохраняют прежнюю цену
+func setPrice(ctx context.Context, tx pgx.Tx, productID int32, price *proto.Money, from time.Time, to *time.Time, actor string) (*proto.ProductPrice, error) {
+	type span struct {
+		priceID int64
+		from    time.Time
+		to      *time.Time
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT PriceID, EffectiveFrom, EffectiveTo
+        FROM ProductPrices
+        WHERE ProductID = $1
+          AND (EffectiveTo IS NULL OR EffectiveTo > $2)
+          AND ($3::timestamptz IS NULL OR EffectiveFrom < $3)
+        ORDER BY EffectiveFrom`,
+		productID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var overlapping []span
+	for rows.Next() {
+		var s span
+		if err := rows.Scan(&s.priceID, &s.from, &s.to); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		overlapping = append(overlapping, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range overlapping {
+		// Прежняя цена продолжает действовать после to
+		tail := to != nil && (s.to == nil || s.to.After(*to))
+
+		if s.from.Before(from) {
+			if tail {
+				_, err := tx.Exec(ctx, `
+                    INSERT INTO ProductPrices (ProductID, Price, Currency, EffectiveFrom, EffectiveTo, Actor, CreatedAt)
+                    SELECT ProductID, Price, Currency, $2, EffectiveTo, Actor, CreatedAt
+                    FROM ProductPrices WHERE PriceID = $1`,
+					s.priceID, *to,
+				)
+				if err != nil {
+					return nil, fmt.Errorf("failed to split price: %w", err)
+				}
+			}
+			_, err = tx.Exec(ctx, "UPDATE ProductPrices SET EffectiveTo = $2 WHERE PriceID = $1", s.priceID, from)
+		} else if tail {
+			_, err = tx.Exec(ctx, "UPDATE ProductPrices SET EffectiveFrom = $2 WHERE PriceID = $1", s.priceID, *to)
+		} else {
+			_, err = tx.Exec(ctx, "DELETE FROM ProductPrices WHERE PriceID = $1", s.priceID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to trim price: %w", err)
+		}
+	}
+
+	record, err := scanProductPrice(tx.QueryRow(ctx, `
+        INSERT INTO ProductPrices (ProductID, Price, Currency, EffectiveFrom, EffectiveTo, Actor)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING `+productPriceColumns,
+		productID, money.String(price), price.CurrencyCode, from, to, actor,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to record price: %w", err)
+	}
+	return record, nil
+}
+
+func scanProductPrice(row pgx.Row) (*proto.ProductPrice, error) {
+	var record proto.ProductPrice
+	var price pgtype.Numeric
+	var currency string
+	var from, createdAt time.Time
+	var to *time.Time
+	err := row.Scan(
+		&record.PriceId, &record.ProductId, &price, &currency,
+		&from, &to, &record.Actor, &createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if record.Price, err = money.FromNumeric(price, currency); err != nil {
+		return nil, fmt.Errorf("price %d: %w", record.PriceId, err)
+	}
+	record.EffectiveFrom = from.Format(time.RFC3339)
+	if to != nil {
+		record.EffectiveTo = to.Format(time.RFC3339)
+	}
+	record.CreatedAt = createdAt.Format(time.RFC3339)
+	return &record, nil
+}
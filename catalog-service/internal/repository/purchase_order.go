@@ -0,0 +1,545 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/proto"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrSupplierNotFound возвращается, если поставщика с указанным ID нет
+	ErrSupplierNotFound = errors.New("supplier not found")
+	// ErrSupplierExists возвращается, если поставщик с таким названием уже есть
+	ErrSupplierExists = errors.New("supplier with this name already exists")
+	// ErrPurchaseOrderNotFound возвращается, если заказа поставщику с указанным ID нет
+	ErrPurchaseOrderNotFound = errors.New("purchase order not found")
+	// ErrPurchaseOrderClosed возвращается при приемке или отмене полностью принятого
+	// или отмененного заказа поставщику
+	ErrPurchaseOrderClosed = errors.New("purchase order is closed")
+	// ErrProductNotInPurchaseOrder возвращается при приемке товара, которого нет в заказе
+	ErrProductNotInPurchaseOrder = errors.New("product is not in purchase order")
+	// ErrReceiptExceedsOrdered возвращается, если принимается больше, чем осталось принять
+	ErrReceiptExceedsOrdered = errors.New("received quantity exceeds ordered quantity")
+	// ErrPurchaseOrderProductDeleted возвращается при приемке товара, который после
+	// оформления заказа удален из каталога: такую позицию принять нельзя
+	ErrPurchaseOrderProductDeleted = errors.New("purchase order product was deleted from catalog")
+)
+
+// Статусы заказа поставщику
+const (
+	PurchaseOrderOpen              = "open"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+	PurchaseOrderCancelled         = "cancelled"
+)
+
+// purchaseOrderStatuses значения столбца PurchaseOrders.Status
+var purchaseOrderStatuses = map[proto.PurchaseOrderStatus]string{
+	proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_OPEN:               PurchaseOrderOpen,
+	proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_PARTIALLY_RECEIVED: PurchaseOrderPartiallyReceived,
+	proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_RECEIVED:           PurchaseOrderReceived,
+	proto.PurchaseOrderStatus_PURCHASE_ORDER_STATUS_CANCELLED:          PurchaseOrderCancelled,
+}
+
+// PurchaseOrderFilter параметры выборки заказов поставщикам; нулевые поля не ограничивают выборку
+type PurchaseOrderFilter struct {
+	SupplierID int32
+	Statuses   []proto.PurchaseOrderStatus
+	PageSize   int
+	Before     int32 // PurchaseOrderID последнего заказа предыдущей страницы; 0 - первая страница
+}
+
+// querier запросы, общие для пула соединений и транзакции
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+const purchaseOrderColumns = "PurchaseOrderID, SupplierID, WarehouseID, Status, CreatedAt, UpdatedAt"
+
+// CreateSupplier добавляет поставщика
+func (db *catalogDB) CreateSupplier(name, email, phone string) (*proto.Supplier, error) {
+	supplier := proto.Supplier{Name: name, Email: email, Phone: phone}
+	err := db.conn.QueryRow(context.Background(),
+		"INSERT INTO Suppliers (Name, Email, Phone) VALUES ($1, $2, $3) RETURNING SupplierID",
+		name, email, phone,
+	).Scan(&supplier.SupplierId)
+	if isUniqueViolation(err) {
+		return nil, ErrSupplierExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create supplier: %w", err)
+	}
+	return &supplier, nil
+}
+
+// GetSuppliers возвращает поставщиков по названию
+func (db *catalogDB) GetSuppliers() ([]*proto.Supplier, error) {
+	rows, err := db.conn.Query(context.Background(),
+		"SELECT SupplierID, Name, Email, Phone FROM Suppliers ORDER BY lower(Name), SupplierID",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suppliers []*proto.Supplier
+	for rows.Next() {
+		var supplier proto.Supplier
+		if err := rows.Scan(&supplier.SupplierId, &supplier.Name, &supplier.Email, &supplier.Phone); err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, &supplier)
+	}
+	return suppliers, rows.Err()
+}
+
+// CreatePurchaseOrder создает заказ поставщику на склад warehouseID (0 - склад по умолчанию).
+// Товар с вариантами заказывается вариантами, как и продается
+func (db *catalogDB) CreatePurchaseOrder(supplierID, warehouseID int32, items []*proto.PurchaseOrderLine) (*proto.PurchaseOrder, error) {
+	ctx := context.Background()
+
+	// Складываем повторяющиеся позиции, чтобы не нарушить первичный ключ
+	quantities := make(map[int32]int32)
+	var productIDs []int32
+	for _, item := range items {
+		if _, ok := quantities[item.ProductId]; !ok {
+			productIDs = append(productIDs, item.ProductId)
+		}
+		quantities[item.ProductId] += item.Quantity
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkPurchasable(ctx, tx, productIDs); err != nil {
+		return nil, err
+	}
+	if warehouseID == 0 {
+		if warehouseID, err = defaultWarehouse(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	var purchaseOrderID int32
+	err = tx.QueryRow(ctx, `
+        INSERT INTO PurchaseOrders (SupplierID, WarehouseID, Status)
+        VALUES ($1, $2, $3)
+        RETURNING PurchaseOrderID`,
+		supplierID, warehouseID, PurchaseOrderOpen,
+	).Scan(&purchaseOrderID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		if pgErr.ConstraintName == "purchase_orders_warehouse_fkey" {
+			return nil, ErrWarehouseNotFound
+		}
+		return nil, ErrSupplierNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create purchase order: %w", err)
+	}
+
+	for _, productID := range productIDs {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO PurchaseOrderItems (PurchaseOrderID, ProductID, Quantity)
+            VALUES ($1, $2, $3)`,
+			purchaseOrderID, productID, quantities[productID],
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add purchase order item: %w", err)
+		}
+	}
+
+	order, err := getPurchaseOrder(ctx, tx, purchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return order, nil
+}
+
+// GetPurchaseOrder возвращает заказ поставщику с позициями
+func (db *catalogDB) GetPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error) {
+	return getPurchaseOrder(context.Background(), db.conn, purchaseOrderID)
+}
+
+// ListPurchaseOrders возвращает страницу заказов поставщикам от новых к старым и
+// PurchaseOrderID последнего заказа для следующей страницы (0, если страница последняя)
+func (db *catalogDB) ListPurchaseOrders(filter PurchaseOrderFilter) ([]*proto.PurchaseOrder, int32, error) {
+	ctx := context.Background()
+
+	var where []string
+	var args queryArgs
+
+	if filter.SupplierID != 0 {
+		where = append(where, "SupplierID = "+args.add(filter.SupplierID))
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]string, 0, len(filter.Statuses))
+		for _, status := range filter.Statuses {
+			value, ok := purchaseOrderStatuses[status]
+			if !ok {
+				return nil, 0, fmt.Errorf("unknown purchase order status %v", status)
+			}
+			statuses = append(statuses, value)
+		}
+		where = append(where, "Status = ANY("+args.add(statuses)+")")
+	}
+	if filter.Before != 0 {
+		where = append(where, "PurchaseOrderID < "+args.add(filter.Before))
+	}
+
+	query := "SELECT " + purchaseOrderColumns + " FROM PurchaseOrders"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY PurchaseOrderID DESC LIMIT " + args.add(filter.PageSize+1)
+
+	rows, err := db.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read purchase orders: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []*proto.PurchaseOrder
+	for rows.Next() {
+		order, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var last int32
+	if len(orders) > filter.PageSize {
+		orders = orders[:filter.PageSize]
+		last = orders[len(orders)-1].PurchaseOrderId
+	}
+	if err := withPurchaseOrderItems(ctx, db.conn, orders...); err != nil {
+		return nil, 0, err
+	}
+	return orders, last, nil
+}
+
+// ReceivePurchaseOrder принимает товар по заказу поставщику: увеличивает принятое
+// количество позиций и остаток склада заказа движением RESTOCK со ссылкой на заказ.
+// Пустой items принимает все, что еще не пришло. Если operationID не пустой,
+// приемка применяется не более одного раза: повтор возвращает текущий заказ
+func (db *catalogDB) ReceivePurchaseOrder(purchaseOrderID int32, items []*proto.PurchaseOrderLine, operationID, actor string) (*proto.PurchaseOrder, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Блокировка заказа упорядочивает параллельные приемки
+	var warehouseID int32
+	var status string
+	err = tx.QueryRow(ctx,
+		"SELECT WarehouseID, Status FROM PurchaseOrders WHERE PurchaseOrderID = $1 FOR UPDATE",
+		purchaseOrderID,
+	).Scan(&warehouseID, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if operationID != "" {
+		// Ключ приемки записывается в той же транзакции, что и изменение остатка
+		tag, err := tx.Exec(ctx, `
+            INSERT INTO PurchaseOrderReceipts (OperationID, PurchaseOrderID)
+            VALUES ($1, $2)
+            ON CONFLICT (OperationID) DO NOTHING`,
+			operationID, purchaseOrderID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record purchase order receipt: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			// Приемка уже проведена - возвращаем текущий заказ, если ключ выдан для него
+			var keyOrderID int32
+			err := tx.QueryRow(ctx,
+				"SELECT PurchaseOrderID FROM PurchaseOrderReceipts WHERE OperationID = $1",
+				operationID,
+			).Scan(&keyOrderID)
+			if err != nil {
+				return nil, err
+			}
+			if keyOrderID != purchaseOrderID {
+				return nil, ErrIdempotencyKeyMismatch
+			}
+			return getPurchaseOrder(ctx, tx, purchaseOrderID)
+		}
+	}
+
+	if status == PurchaseOrderReceived || status == PurchaseOrderCancelled {
+		return nil, ErrPurchaseOrderClosed
+	}
+
+	receipt, err := receiptQuantities(ctx, tx, purchaseOrderID, items)
+	if err != nil {
+		return nil, err
+	}
+
+	movement := StockMovement{
+		Reason:          proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK,
+		PurchaseOrderID: purchaseOrderID,
+		Actor:           actor,
+	}
+	for _, line := range receipt {
+		_, err := tx.Exec(ctx, `
+            UPDATE PurchaseOrderItems
+            SET ReceivedQuantity = ReceivedQuantity + $3
+            WHERE PurchaseOrderID = $1 AND ProductID = $2`,
+			purchaseOrderID, line.ProductId, line.Quantity,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update purchase order item: %w", err)
+		}
+		_, err = changeWarehouseStock(ctx, tx, line.ProductId, warehouseID, int(line.Quantity), movement)
+		if errors.Is(err, ErrProductNotFound) {
+			// Позиции заказа не ссылаются на Catalog, товар мог быть удален
+			err = ErrPurchaseOrderProductDeleted
+		}
+		if err != nil {
+			return nil, fmt.Errorf("product %d: %w", line.ProductId, err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE PurchaseOrders
+        SET Status = CASE
+                WHEN EXISTS (SELECT 1 FROM PurchaseOrderItems
+                             WHERE PurchaseOrderID = $1 AND ReceivedQuantity < Quantity)
+                THEN $2 ELSE $3 END,
+            UpdatedAt = CURRENT_TIMESTAMP
+        WHERE PurchaseOrderID = $1`,
+		purchaseOrderID, PurchaseOrderPartiallyReceived, PurchaseOrderReceived,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update purchase order status: %w", err)
+	}
+
+	order, err := getPurchaseOrder(ctx, tx, purchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return order, nil
+}
+
+// CancelPurchaseOrder отменяет заказ поставщику; принятый товар остается на складе
+func (db *catalogDB) CancelPurchaseOrder(purchaseOrderID int32) (*proto.PurchaseOrder, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE PurchaseOrders
+        SET Status = $2, UpdatedAt = CURRENT_TIMESTAMP
+        WHERE PurchaseOrderID = $1 AND Status IN ($3, $4)`,
+		purchaseOrderID, PurchaseOrderCancelled, PurchaseOrderOpen, PurchaseOrderPartiallyReceived,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel purchase order: %w", err)
+	}
+
+	order, err := getPurchaseOrder(ctx, tx, purchaseOrderID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrPurchaseOrderClosed
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return order, nil
+}
+
+// checkPurchasable проверяет, что товары есть в каталоге и продаются сами, а не вариантами
+func checkPurchasable(ctx context.Context, tx pgx.Tx, productIDs []int32) error {
+	rows, err := tx.Query(ctx, `
+        SELECT ProductID, NOT `+sellable+`
+        FROM Catalog
+        WHERE ProductID = ANY($1)`,
+		productIDs,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := make(map[int32]bool, len(productIDs))
+	for rows.Next() {
+		var productID int32
+		var hasVariants bool
+		if err := rows.Scan(&productID, &hasVariants); err != nil {
+			return err
+		}
+		if hasVariants {
+			return fmt.Errorf("product %d: %w", productID, ErrProductHasVariants)
+		}
+		found[productID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, productID := range productIDs {
+		if !found[productID] {
+			return fmt.Errorf("product %d: %w", productID, ErrProductNotFound)
+		}
+	}
+	return nil
+}
+
+// receiptQuantities проверяет приемку по позициям заказа и возвращает ненулевые
+// количества к приемке по возрастанию ProductID. Пустой items - весь непринятый остаток
+func receiptQuantities(ctx context.Context, tx pgx.Tx, purchaseOrderID int32, items []*proto.PurchaseOrderLine) ([]*proto.PurchaseOrderLine, error) {
+	requested := make(map[int32]int32, len(items))
+	for _, item := range items {
+		requested[item.ProductId] += item.Quantity
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT ProductID, Quantity - ReceivedQuantity
+        FROM PurchaseOrderItems
+        WHERE PurchaseOrderID = $1
+        ORDER BY ProductID`,
+		purchaseOrderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipt []*proto.PurchaseOrderLine
+	for rows.Next() {
+		var productID, remaining int32
+		if err := rows.Scan(&productID, &remaining); err != nil {
+			return nil, err
+		}
+
+		quantity := remaining
+		if len(items) > 0 {
+			var ok bool
+			if quantity, ok = requested[productID]; !ok {
+				continue
+			}
+			delete(requested, productID)
+			if quantity > remaining {
+				return nil, fmt.Errorf("product %d: %w", productID, ErrReceiptExceedsOrdered)
+			}
+		}
+		if quantity > 0 {
+			receipt = append(receipt, &proto.PurchaseOrderLine{ProductId: productID, Quantity: quantity})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Все, что осталось в requested, в заказе не числится
+	for productID := range requested {
+		return nil, fmt.Errorf("product %d: %w", productID, ErrProductNotInPurchaseOrder)
+	}
+	return receipt, nil
+}
+
+// getPurchaseOrder читает заказ поставщику с позициями
+func getPurchaseOrder(ctx context.Context, q querier, purchaseOrderID int32) (*proto.PurchaseOrder, error) {
+	order, err := scanPurchaseOrder(q.QueryRow(ctx,
+		"SELECT "+purchaseOrderColumns+" FROM PurchaseOrders WHERE PurchaseOrderID = $1",
+		purchaseOrderID,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := withPurchaseOrderItems(ctx, q, order); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// withPurchaseOrderItems дополняет заказы поставщикам их позициями одним запросом
+func withPurchaseOrderItems(ctx context.Context, q querier, orders ...*proto.PurchaseOrder) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	byID := make(map[int32]*proto.PurchaseOrder, len(orders))
+	ids := make([]int32, len(orders))
+	for i, order := range orders {
+		byID[order.PurchaseOrderId] = order
+		ids[i] = order.PurchaseOrderId
+	}
+
+	rows, err := q.Query(ctx, `
+        SELECT PurchaseOrderID, ProductID, Quantity, ReceivedQuantity
+        FROM PurchaseOrderItems
+        WHERE PurchaseOrderID = ANY($1)
+        ORDER BY PurchaseOrderID, ProductID`,
+		ids,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read purchase order items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var purchaseOrderID int32
+		var item proto.PurchaseOrderItem
+		if err := rows.Scan(&purchaseOrderID, &item.ProductId, &item.Quantity, &item.ReceivedQuantity); err != nil {
+			return err
+		}
+		order := byID[purchaseOrderID]
+		order.Items = append(order.Items, &item)
+	}
+	return rows.Err()
+}
+
+func scanPurchaseOrder(row pgx.Row) (*proto.PurchaseOrder, error) {
+	var order proto.PurchaseOrder
+	var status string
+	var createdAt, updatedAt time.Time
+	err := row.Scan(
+		&order.PurchaseOrderId, &order.SupplierId, &order.WarehouseId,
+		&status, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for value, name := range purchaseOrderStatuses {
+		if name == status {
+			order.Status = value
+		}
+	}
+	order.CreatedAt = createdAt.Format(time.RFC3339)
+	order.UpdatedAt = updatedAt.Format(time.RFC3339)
+	return &order, nil
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/proto"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Статусы резерва
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationCancelled = "cancelled"
+	ReservationExpired   = "expired"
+)
+
+// Reservation созданный резерв
+type Reservation struct {
+	ReservationID int32
+	ExpiresAt     time.Time
+	Items         []*proto.ReservationItem // Позиции со складами, с которых они списаны
+}
+
+// CreateReservation списывает товар по всем позициям в одной транзакции:
+// либо резервируются все позиции, либо ни одной. Каждая позиция списывается
+// с одного склада: указанного в ней или выбранного по allocation
+func (db *catalogDB) CreateReservation(items []*proto.ReservationItem, allocation *proto.Allocation, ttl time.Duration, movement StockMovement) (*Reservation, error) {
+	ctx := context.Background()
+
+	// Складываем повторяющиеся позиции, чтобы не нарушить первичный ключ
+	merged := make(map[int32]*proto.ReservationItem)
+	var productIDs []int32
+	for _, item := range items {
+		line, ok := merged[item.ProductId]
+		if !ok {
+			line = &proto.ReservationItem{ProductId: item.ProductId}
+			merged[item.ProductId] = line
+			productIDs = append(productIDs, item.ProductId)
+		}
+		line.Quantity += item.Quantity
+		if item.WarehouseId != 0 {
+			line.WarehouseId = item.WarehouseId
+		}
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	reservation := &Reservation{}
+	err = tx.QueryRow(ctx, `
+        INSERT INTO Reservations (Status, ExpiresAt, OrderID, Actor)
+        VALUES ($1, CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', NULLIF($3, 0), $4)
+        RETURNING ReservationID, ExpiresAt`,
+		ReservationPending, int64(ttl/time.Second), movement.OrderID, movement.Actor,
+	).Scan(&reservation.ReservationID, &reservation.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reservation: %w", err)
+	}
+	movement.ReservationID = reservation.ReservationID
+
+	for _, productID := range productIDs {
+		line := merged[productID]
+		warehouseID, err := allocateStock(ctx, tx, productID, int(line.Quantity), line.WarehouseId, allocation, movement)
+		if errors.Is(err, ErrInsufficientStock) && line.WarehouseId == 0 {
+			err = db.stockError(productID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("product %d: %w", productID, err)
+		}
+		line.WarehouseId = warehouseID
+
+		_, err = tx.Exec(ctx, `
+            INSERT INTO ReservationItems (ReservationID, ProductID, Quantity, WarehouseID)
+            VALUES ($1, $2, $3, $4)`,
+			reservation.ReservationID, productID, line.Quantity, warehouseID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add reservation item: %w", err)
+		}
+		reservation.Items = append(reservation.Items, line)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return reservation, nil
+}
+
+// CommitReservation подтверждает резерв. Повторное подтверждение не считается ошибкой
+func (db *catalogDB) CommitReservation(reservationID int32) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	var expired bool
+	err = tx.QueryRow(ctx, `
+        SELECT Status, ExpiresAt <= CURRENT_TIMESTAMP
+        FROM Reservations
+        WHERE ReservationID = $1
+        FOR UPDATE`,
+		reservationID,
+	).Scan(&status, &expired)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrReservationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case status == ReservationCommitted:
+		return nil
+	case status != ReservationPending:
+		return fmt.Errorf("reservation %d is %s: %w", reservationID, status, ErrReservationNotPending)
+	case expired:
+		// Срок истек, но сборщик еще не успел снять резерв - снимаем сами
+		if err := releaseReservations(ctx, tx, []int32{reservationID}, ReservationExpired, ExpiryActor); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return fmt.Errorf("reservation %d is %s: %w", reservationID, ReservationExpired, ErrReservationNotPending)
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE Reservations SET Status=$1 WHERE ReservationID=$2",
+		ReservationCommitted, reservationID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to commit reservation: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CancelReservation отменяет резерв и возвращает товар на склад.
+// Повторная отмена, как и отмена просроченного резерва, не считается ошибкой
+func (db *catalogDB) CancelReservation(reservationID int32, actor string) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx,
+		"SELECT Status FROM Reservations WHERE ReservationID = $1 FOR UPDATE",
+		reservationID,
+	).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrReservationNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case ReservationCancelled, ReservationExpired:
+		return nil
+	case ReservationCommitted:
+		return fmt.Errorf("reservation %d is %s: %w", reservationID, status, ErrReservationNotPending)
+	}
+
+	if err := releaseReservations(ctx, tx, []int32{reservationID}, ReservationCancelled, actor); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ExpireReservations снимает все просроченные резервы одной транзакцией
+func (db *catalogDB) ExpireReservations() (int, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// SKIP LOCKED: резервы, которые сейчас подтверждаются или отменяются, не трогаем
+	rows, err := tx.Query(ctx, `
+        SELECT ReservationID
+        FROM Reservations
+        WHERE Status = $1 AND ExpiresAt <= CURRENT_TIMESTAMP
+        FOR UPDATE SKIP LOCKED`,
+		ReservationPending,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var reservationIDs []int32
+	for rows.Next() {
+		var reservationID int32
+		if err := rows.Scan(&reservationID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		reservationIDs = append(reservationIDs, reservationID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(reservationIDs) == 0 {
+		return 0, nil
+	}
+
+	if err := releaseReservations(ctx, tx, reservationIDs, ReservationExpired, ExpiryActor); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(reservationIDs), nil
+}
+
+// releaseReservations возвращает товар по резервам на склад и переводит их в статус status.
+// Возврат записывается в журнал движений от имени actor с заказом резерва.
+// Резервы должны быть заблокированы вызывающей транзакцией
+func releaseReservations(ctx context.Context, tx pgx.Tx, reservationIDs []int32, status, actor string) error {
+	// Товар возвращается на склад, с которого был списан; позиции резервов, созданных
+	// до появления складов, - на склад по умолчанию. Удаленные товары пропускаются
+	_, err := tx.Exec(ctx, `
+        INSERT INTO WarehouseStock (ProductID, WarehouseID, Quantity)
+        SELECT r.ProductID,
+               COALESCE(r.WarehouseID, (SELECT WarehouseID FROM Warehouses WHERE IsDefault)),
+               SUM(r.Quantity)
+        FROM ReservationItems r
+        WHERE r.ReservationID = ANY($1)
+          AND EXISTS (SELECT 1 FROM Catalog c WHERE c.ProductID = r.ProductID)
+        GROUP BY 1, 2
+        ON CONFLICT (ProductID, WarehouseID)
+        DO UPDATE SET Quantity = WarehouseStock.Quantity + EXCLUDED.Quantity`,
+		reservationIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore stock: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO StockMovements (ProductID, WarehouseID, Delta, Reason, OrderID, ReservationID, Actor)
+        SELECT i.ProductID,
+               COALESCE(i.WarehouseID, (SELECT WarehouseID FROM Warehouses WHERE IsDefault)),
+               i.Quantity, $2, r.OrderID, r.ReservationID, $3
+        FROM ReservationItems i
+        JOIN Reservations r ON r.ReservationID = i.ReservationID
+        WHERE i.ReservationID = ANY($1)
+          AND EXISTS (SELECT 1 FROM Catalog c WHERE c.ProductID = i.ProductID)
+        ORDER BY i.ReservationID, i.ProductID`,
+		reservationIDs, movementReasons[proto.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN], actor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movements: %w", err)
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE Reservations SET Status=$1 WHERE ReservationID = ANY($2)",
+		status, reservationIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update reservation status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"store/proto"
+	"strings"
+)
+
+// SearchFilter параметры полнотекстового поиска товаров
+type SearchFilter struct {
+	Query       string // Поисковая фраза в синтаксисе websearch_to_tsquery
+	InStockOnly bool
+	PageSize    int
+	After       *SearchCursor // nil - первая страница
+}
+
+// SearchCursor ключ последнего результата страницы. Релевантность хранится
+// в точности real, как ее возвращает ts_rank_cd, поэтому сравнение с ней точное
+type SearchCursor struct {
+	Rank      float32
+	ProductID int32
+}
+
+// searchHeadline параметры подсветки найденных слов в названии
+const searchHeadline = "StartSel=<b>, StopSel=</b>, HighlightAll=true"
+
+// SearchProducts ищет товары по SearchVector. Запрос разбирается русской и английской
+// конфигурациями, как и сам вектор, и товар подходит, если совпал хотя бы один из разборов.
+// Подсветка считается только для строк страницы: ts_headline заметно дороже поиска по индексу
+func (db *catalogDB) SearchProducts(filter SearchFilter) ([]*proto.ProductSearchResult, *SearchCursor, error) {
+	var where []string
+	var args queryArgs
+
+	query := args.add(filter.Query)
+	where = append(where, "SearchVector @@ search.q")
+	if filter.InStockOnly {
+		where = append(where, "StockQuantity > 0")
+	}
+	if c := filter.After; c != nil {
+		rank := args.add(c.Rank)
+		where = append(where, "(ts_rank_cd(SearchVector, search.q) < "+rank+"::real OR "+
+			"(ts_rank_cd(SearchVector, search.q) = "+rank+"::real AND ProductID > "+args.add(c.ProductID)+"))")
+	}
+
+	rows, err := db.conn.Query(context.Background(), `
+        WITH search AS (
+            SELECT websearch_to_tsquery('russian', `+query+`) || websearch_to_tsquery('english', `+query+`) AS q
+        ),
+        page AS (
+            SELECT Catalog.*, ts_rank_cd(SearchVector, search.q) AS Rank
+            FROM Catalog, search
+            WHERE `+strings.Join(where, " AND ")+`
+            ORDER BY Rank DESC, ProductID
+            LIMIT `+args.add(filter.PageSize+1)+`
+        )
+        SELECT `+productColumns+`, Rank, ts_headline('russian', ProductName, search.q, '`+searchHeadline+`')
+        FROM page, search
+        ORDER BY Rank DESC, ProductID`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var results []*proto.ProductSearchResult
+	for rows.Next() {
+		var result proto.ProductSearchResult
+		if result.Product, err = scanProduct(rows, &result.Rank, &result.Snippet); err != nil {
+			return nil, nil, err
+		}
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(results) <= filter.PageSize {
+		return results, nil, nil
+	}
+	results = results[:filter.PageSize]
+	last := results[len(results)-1]
+	return results, &SearchCursor{Rank: last.Rank, ProductID: last.Product.ProductId}, nil
+}
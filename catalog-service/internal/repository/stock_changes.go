@@ -0,0 +1,162 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"store/proto"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// StockChangeRetention сколько хранятся записи журнала изменений остатков.
+// Продолжить поток WatchStock можно только с позиции внутри этого окна
+const StockChangeRetention = 7 * 24 * time.Hour
+
+// GetStockChanges возвращает до limit изменений с Sequence больше afterSequence
+// в порядке Sequence. Пустой productIDs - изменения всех товаров
+func (db *catalogDB) GetStockChanges(afterSequence int64, productIDs []int32, limit int) ([]*proto.StockChange, error) {
+	if productIDs == nil {
+		productIDs = []int32{} // nil передается как NULL, а фильтру нужен пустой массив
+	}
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT Sequence, ProductID, StockQuantity, Deleted, ChangedAt
+        FROM StockChanges
+        WHERE Sequence > $1 AND (cardinality($2::int[]) = 0 OR ProductID = ANY($2))
+        ORDER BY Sequence
+        LIMIT $3`, afterSequence, productIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stock changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []*proto.StockChange
+	for rows.Next() {
+		var change proto.StockChange
+		var changedAt time.Time
+		if err := rows.Scan(&change.Sequence, &change.ProductId, &change.StockQuantity, &change.Deleted, &changedAt); err != nil {
+			return nil, err
+		}
+		change.ChangedAt = changedAt.Format(time.RFC3339)
+		changes = append(changes, &change)
+	}
+	return changes, rows.Err()
+}
+
+// SequenceStockChanges назначает позиции журнала изменениям, транзакции которых
+// старше pg_snapshot_xmin, и возвращает их число. Такие транзакции уже завершились:
+// изменение, которому позиция достанется позже, получит ее больше любой выданной.
+// Позиции назначает одна реплика за раз, остальные в это время пропускают ход
+func (db *catalogDB) SequenceStockChanges() (int, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var locked bool
+	err = tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock(hashtext('stockchanges'))").Scan(&locked)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock stock changes: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE StockChanges c
+        SET Sequence = n.Sequence
+        FROM (
+            SELECT ChangeID,
+                   (SELECT COALESCE(MAX(Sequence), 0) FROM StockChanges)
+                   + row_number() OVER (ORDER BY TxID, ChangeID) AS Sequence
+            FROM StockChanges
+            WHERE Sequence IS NULL
+              AND TxID < pg_snapshot_xmin(pg_current_snapshot())
+        ) n
+        WHERE c.ChangeID = n.ChangeID`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sequence stock changes: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// GetStockSnapshot возвращает текущие остатки и позицию журнала, на которой они сняты.
+// Оба чтения идут в одном снимке: изменения после снимка имеют Sequence больше возвращенной.
+// Изменение, которое уже видно в остатках, но еще без позиции, придет подписчику
+// еще раз - с тем же остатком
+func (db *catalogDB) GetStockSnapshot(productIDs []int32) ([]*proto.StockChange, int64, error) {
+	ctx := context.Background()
+	if productIDs == nil {
+		productIDs = []int32{}
+	}
+
+	tx, err := db.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var sequence int64
+	if err := tx.QueryRow(ctx, "SELECT COALESCE(MAX(Sequence), 0) FROM StockChanges").Scan(&sequence); err != nil {
+		return nil, 0, fmt.Errorf("failed to read stock sequence: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT ProductID, StockQuantity
+        FROM Catalog
+        WHERE cardinality($1::int[]) = 0 OR ProductID = ANY($1)
+        ORDER BY ProductID`, productIDs)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read stock: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var snapshot []*proto.StockChange
+	for rows.Next() {
+		change := proto.StockChange{Sequence: sequence, ChangedAt: now}
+		if err := rows.Scan(&change.ProductId, &change.StockQuantity); err != nil {
+			return nil, 0, err
+		}
+		snapshot = append(snapshot, &change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return snapshot, sequence, nil
+}
+
+// StockSequenceRange возвращает первую и последнюю позиции журнала изменений остатков
+// (0, 0 - журнал пуст)
+func (db *catalogDB) StockSequenceRange() (int64, int64, error) {
+	var oldest, latest int64
+	err := db.conn.QueryRow(context.Background(),
+		"SELECT COALESCE(MIN(Sequence), 0), COALESCE(MAX(Sequence), 0) FROM StockChanges",
+	).Scan(&oldest, &latest)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read stock sequence range: %w", err)
+	}
+	return oldest, latest, nil
+}
+
+// PurgeStockChanges удаляет записи журнала старше StockChangeRetention.
+// Последняя запись остается всегда, чтобы не потерять текущую позицию журнала
+func (db *catalogDB) PurgeStockChanges() (int, error) {
+	tag, err := db.conn.Exec(context.Background(), `
+        DELETE FROM StockChanges
+        WHERE ChangedAt < CURRENT_TIMESTAMP - make_interval(secs => $1)
+          AND Sequence < (SELECT MAX(Sequence) FROM StockChanges)`,
+		StockChangeRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge stock changes: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
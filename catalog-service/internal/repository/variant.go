@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"store/money"
+	"store/proto"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrSKUExists возвращается, если артикул уже занят другим товаром
+	ErrSKUExists = errors.New("sku already exists")
+	// ErrVariantExists возвращается, если у товара уже есть вариант с такими же атрибутами
+	ErrVariantExists = errors.New("variant with these attributes already exists")
+	// ErrProductIsVariant возвращается при попытке добавить вариант к варианту
+	ErrProductIsVariant = errors.New("product is a variant")
+	// ErrProductHasVariants возвращается при списании товара, который продается вариантами
+	ErrProductHasVariants = errors.New("product is sold by variants")
+	// ErrParentHasStock возвращается при добавлении варианта к товару, у которого есть
+	// свой остаток или неподтвержденные резервы: после этого товар продается только
+	// вариантами, и его остаток нельзя было бы продать
+	ErrParentHasStock = errors.New("parent product has stock or pending reservations")
+)
+
+// sellable условие UPDATE Catalog: товар с вариантами продается только вариантами,
+// его собственный остаток не списывается
+const sellable = "NOT EXISTS (SELECT 1 FROM Catalog v WHERE v.ParentProductID = Catalog.ProductID)"
+
+// ProductVariant новый вариант товара
+type ProductVariant struct {
+	ParentProductID int32
+	SKU             string
+	Attributes      map[string]string // Отличающие вариант атрибуты, например color, volume
+	ProductName     string            // Пусто - название родителя с атрибутами в скобках
+	StockQuantity   int
+	Price           *proto.Money
+	Actor           string // Инициатор начального прихода для журнала движений
+}
+
+// AddProductVariant добавляет вариант к товару. Вариант к варианту добавить нельзя:
+// иерархия всегда в один уровень. Остаток товара перед этим нужно списать,
+// а его резервы - подтвердить или отменить
+func (db *catalogDB) AddProductVariant(variant ProductVariant) (int32, error) {
+	ctx := context.Background()
+
+	attributes, err := json.Marshal(variant.Attributes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode variant attributes: %w", err)
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// FOR SHARE не дает удалить родителя или изменить его остаток, пока добавляется вариант
+	var parentName string
+	var grandparentID *int32
+	var hasStock bool
+	err = tx.QueryRow(ctx, `
+        SELECT ProductName, ParentProductID,
+               StockQuantity > 0 OR EXISTS (
+                   SELECT 1
+                   FROM ReservationItems i
+                   JOIN Reservations r ON r.ReservationID = i.ReservationID
+                   WHERE i.ProductID = Catalog.ProductID AND r.Status = $2
+               )
+        FROM Catalog
+        WHERE ProductID = $1
+        FOR SHARE`,
+		variant.ParentProductID, ReservationPending,
+	).Scan(&parentName, &grandparentID, &hasStock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if grandparentID != nil {
+		return 0, ErrProductIsVariant
+	}
+	if hasStock {
+		return 0, ErrParentHasStock
+	}
+
+	name := variant.ProductName
+	if name == "" {
+		name = fmt.Sprintf("%s (%s)", parentName, variantSuffix(variant.Attributes))
+	}
+
+	var productID int32
+	err = tx.QueryRow(ctx, `
+        INSERT INTO Catalog (ProductName, StockQuantity, PricePerUnit, Currency, ParentProductID, SKU, VariantAttributes)
+        VALUES ($1, 0, $2, $3, $4, $5, $6::jsonb)
+        RETURNING ProductID`,
+		name, money.String(variant.Price), variant.Price.CurrencyCode,
+		variant.ParentProductID, variant.SKU, string(attributes),
+	).Scan(&productID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		if pgErr.ConstraintName == "idx_catalog_variant_attributes" {
+			return 0, ErrVariantExists
+		}
+		return 0, ErrSKUExists
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := insertInitialPrice(ctx, tx, productID, variant.Price, variant.Actor); err != nil {
+		return 0, err
+	}
+	restock := StockMovement{Reason: proto.StockMovementReason_STOCK_MOVEMENT_REASON_RESTOCK, Actor: variant.Actor}
+	if err := setStockQuantity(ctx, tx, productID, variant.StockQuantity, restock); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return productID, nil
+}
+
+// variantSuffix перечисляет значения атрибутов в порядке ключей: "красный, 1.7 л"
+func variantSuffix(attributes map[string]string) string {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = attributes[key]
+	}
+	return strings.Join(values, ", ")
+}
+
+// GetProductsBySKUs возвращает найденные товары по артикулам, по возрастанию ID.
+// Отсутствующие артикулы просто не попадают в результат
+func (db *catalogDB) GetProductsBySKUs(skus []string) ([]*proto.Product, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT `+productColumns+`
+        FROM Catalog
+        WHERE SKU = ANY($1)
+        ORDER BY ProductID`, skus)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanProducts(rows)
+}
+
+// GetProductVariants возвращает варианты товаров одним запросом, по возрастанию ID
+func (db *catalogDB) GetProductVariants(productIDs []int32) (map[int32][]*proto.Product, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT `+productColumns+`
+        FROM Catalog
+        WHERE ParentProductID = ANY($1)
+        ORDER BY ProductID`, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants, err := scanProducts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byParent := make(map[int32][]*proto.Product)
+	for _, variant := range variants {
+		byParent[variant.ParentProductId] = append(byParent[variant.ParentProductId], variant)
+	}
+	return byParent, nil
+}
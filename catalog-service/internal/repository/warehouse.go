@@ -0,0 +1,345 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"store/proto"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	// ErrWarehouseNotFound возвращается, если склада с указанным ID нет
+	ErrWarehouseNotFound = errors.New("warehouse not found")
+	// ErrWarehouseExists возвращается, если склад с таким названием уже есть
+	ErrWarehouseExists = errors.New("warehouse with this name already exists")
+	// ErrStockOnOtherWarehouses возвращается, если новый общий остаток меньше остатка
+	// на складах, отличных от склада по умолчанию
+	ErrStockOnOtherWarehouses = errors.New("stock on other warehouses exceeds new stock quantity")
+)
+
+// WarehouseUpdate изменяемые поля склада; nil означает, что поле не меняется
+type WarehouseUpdate struct {
+	Name     *string
+	Priority *int32
+	// UpdateLocation - заменить координаты на Location (nil - удалить координаты)
+	UpdateLocation bool
+	Location       *proto.GeoPoint
+	Active         *bool
+	// MakeDefault - сделать склад складом по умолчанию вместо текущего
+	MakeDefault bool
+}
+
+const warehouseColumns = "WarehouseID, Name, Priority, Latitude, Longitude, Active, IsDefault"
+
+// CreateWarehouse создает склад
+func (db *catalogDB) CreateWarehouse(name string, priority int32, location *proto.GeoPoint, active bool) (*proto.Warehouse, error) {
+	latitude, longitude := geoArgs(location)
+	row := db.conn.QueryRow(context.Background(), `
+        INSERT INTO Warehouses (Name, Priority, Latitude, Longitude, Active)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING `+warehouseColumns,
+		name, priority, latitude, longitude, active,
+	)
+	warehouse, err := scanWarehouse(row)
+	if isUniqueViolation(err) {
+		return nil, ErrWarehouseExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warehouse: %w", err)
+	}
+	return warehouse, nil
+}
+
+// GetWarehouses возвращает склады по приоритету, затем по ID
+func (db *catalogDB) GetWarehouses(activeOnly bool) ([]*proto.Warehouse, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT `+warehouseColumns+`
+        FROM Warehouses
+        WHERE Active OR NOT $1
+        ORDER BY Priority, WarehouseID`,
+		activeOnly,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warehouses []*proto.Warehouse
+	for rows.Next() {
+		warehouse, err := scanWarehouse(rows)
+		if err != nil {
+			return nil, err
+		}
+		warehouses = append(warehouses, warehouse)
+	}
+	return warehouses, rows.Err()
+}
+
+// UpdateWarehouse изменяет склад и возвращает его новое состояние
+func (db *catalogDB) UpdateWarehouse(warehouseID int32, update WarehouseUpdate) (*proto.Warehouse, error) {
+	ctx := context.Background()
+
+	var sets []string
+	args := queryArgs{warehouseID}
+	if update.Name != nil {
+		sets = append(sets, "Name = "+args.add(*update.Name))
+	}
+	if update.Priority != nil {
+		sets = append(sets, "Priority = "+args.add(*update.Priority))
+	}
+	if update.UpdateLocation {
+		latitude, longitude := geoArgs(update.Location)
+		sets = append(sets, "Latitude = "+args.add(latitude), "Longitude = "+args.add(longitude))
+	}
+	if update.Active != nil {
+		sets = append(sets, "Active = "+args.add(*update.Active))
+	}
+	if update.MakeDefault {
+		sets = append(sets, "IsDefault = TRUE")
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if update.MakeDefault {
+		// Уникальный индекс допускает один склад по умолчанию: сначала снимаем признак с текущего
+		_, err := tx.Exec(ctx,
+			"UPDATE Warehouses SET IsDefault = FALSE WHERE IsDefault AND WarehouseID <> $1",
+			warehouseID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset default warehouse: %w", err)
+		}
+	}
+
+	query := "SELECT " + warehouseColumns + " FROM Warehouses WHERE WarehouseID = $1"
+	if len(sets) > 0 {
+		query = "UPDATE Warehouses SET " + strings.Join(sets, ", ") + " WHERE WarehouseID = $1 RETURNING " + warehouseColumns
+	}
+	warehouse, err := scanWarehouse(tx.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWarehouseNotFound
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrWarehouseExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update warehouse: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return warehouse, nil
+}
+
+// AdjustWarehouseStock меняет остаток товара на складе на delta и возвращает
+// остаток на складе и общий остаток товара после изменения
+func (db *catalogDB) AdjustWarehouseStock(productID, warehouseID int32, delta int, movement StockMovement) (int, int, error) {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	warehouseQuantity, err := changeWarehouseStock(ctx, tx, productID, warehouseID, delta, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		// Списание не прошло: возможно, нет самого товара или склада
+		if err := checkStockTarget(ctx, tx, productID, warehouseID); err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, ErrInsufficientStock
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var stockQuantity int
+	err = tx.QueryRow(ctx,
+		"SELECT StockQuantity FROM Catalog WHERE ProductID = $1",
+		productID,
+	).Scan(&stockQuantity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return warehouseQuantity, stockQuantity, nil
+}
+
+// GetStockLevels возвращает ненулевые остатки товаров по складам одним запросом,
+// склады в порядке приоритета
+func (db *catalogDB) GetStockLevels(productIDs []int32) (map[int32][]*proto.StockLevel, error) {
+	rows, err := db.conn.Query(context.Background(), `
+        SELECT s.ProductID, w.WarehouseID, w.Name, s.Quantity
+        FROM WarehouseStock s
+        JOIN Warehouses w ON w.WarehouseID = s.WarehouseID
+        WHERE s.ProductID = ANY($1) AND s.Quantity > 0
+        ORDER BY s.ProductID, w.Priority, w.WarehouseID`,
+		productIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	levels := make(map[int32][]*proto.StockLevel)
+	for rows.Next() {
+		var productID int32
+		var level proto.StockLevel
+		if err := rows.Scan(&productID, &level.WarehouseId, &level.WarehouseName, &level.Quantity); err != nil {
+			return nil, err
+		}
+		levels[productID] = append(levels[productID], &level)
+	}
+	return levels, rows.Err()
+}
+
+// changeWarehouseStock меняет остаток товара на складе на delta, записывает движение
+// в журнал и возвращает новый остаток. Строка остатка создается при первом приходе.
+// Остаток не уходит в минус: в этом случае возвращается ErrInsufficientStock.
+// Общий остаток в Catalog обновляет триггер, поэтому строки склада блокируются
+// раньше строки товара
+func changeWarehouseStock(ctx context.Context, tx pgx.Tx, productID, warehouseID int32, delta int, movement StockMovement) (int, error) {
+	var quantity int
+	err := tx.QueryRow(ctx, `
+        UPDATE WarehouseStock
+        SET Quantity = Quantity + $3
+        WHERE ProductID = $1 AND WarehouseID = $2 AND Quantity + $3 >= 0
+        RETURNING Quantity`,
+		productID, warehouseID, delta,
+	).Scan(&quantity)
+	if err == nil {
+		return quantity, recordMovement(ctx, tx, productID, warehouseID, delta, movement)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+	if delta < 0 {
+		return 0, ErrInsufficientStock
+	}
+
+	// Строки еще нет. Параллельный приход мог создать ее раньше - тогда складываем
+	err = tx.QueryRow(ctx, `
+        INSERT INTO WarehouseStock (ProductID, WarehouseID, Quantity)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (ProductID, WarehouseID)
+        DO UPDATE SET Quantity = WarehouseStock.Quantity + EXCLUDED.Quantity
+        RETURNING Quantity`,
+		productID, warehouseID, delta,
+	).Scan(&quantity)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		if pgErr.ConstraintName == "warehouse_stock_warehouse_fkey" {
+			return 0, ErrWarehouseNotFound
+		}
+		return 0, ErrProductNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return quantity, recordMovement(ctx, tx, productID, warehouseID, delta, movement)
+}
+
+// setStockQuantity задает общий остаток товара, меняя остаток на складе по умолчанию.
+// Остатки других складов не меняются; если они больше нового общего остатка,
+// возвращается ErrStockOnOtherWarehouses
+func setStockQuantity(ctx context.Context, tx pgx.Tx, productID int32, stockQuantity int, movement StockMovement) error {
+	// Блокируем строки складов товара, чтобы сумма не изменилась до записи
+	var current int
+	err := tx.QueryRow(ctx, `
+        SELECT COALESCE(SUM(Quantity), 0)
+        FROM (SELECT Quantity FROM WarehouseStock WHERE ProductID = $1 FOR UPDATE) s`,
+		productID,
+	).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if stockQuantity == current {
+		return nil
+	}
+
+	warehouseID, err := defaultWarehouse(ctx, tx)
+	if err != nil {
+		return err
+	}
+	_, err = changeWarehouseStock(ctx, tx, productID, warehouseID, stockQuantity-current, movement)
+	if errors.Is(err, ErrInsufficientStock) {
+		return ErrStockOnOtherWarehouses
+	}
+	return err
+}
+
+// defaultWarehouse возвращает ID склада по умолчанию
+func defaultWarehouse(ctx context.Context, tx pgx.Tx) (int32, error) {
+	var warehouseID int32
+	err := tx.QueryRow(ctx, "SELECT WarehouseID FROM Warehouses WHERE IsDefault").Scan(&warehouseID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get default warehouse: %w", err)
+	}
+	return warehouseID, nil
+}
+
+// checkStockTarget проверяет, что товар и склад существуют
+func checkStockTarget(ctx context.Context, tx pgx.Tx, productID, warehouseID int32) error {
+	var productExists, warehouseExists bool
+	err := tx.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM Catalog WHERE ProductID = $1),
+               EXISTS (SELECT 1 FROM Warehouses WHERE WarehouseID = $2)`,
+		productID, warehouseID,
+	).Scan(&productExists, &warehouseExists)
+	if err != nil {
+		return err
+	}
+	if !productExists {
+		return ErrProductNotFound
+	}
+	if !warehouseExists {
+		return ErrWarehouseNotFound
+	}
+	return nil
+}
+
+// geoArgs раскладывает координаты на аргументы запроса; nil - NULL в обоих столбцах
+func geoArgs(location *proto.GeoPoint) (*float64, *float64) {
+	if location == nil {
+		return nil, nil
+	}
+	return &location.Latitude, &location.Longitude
+}
+
+// isUniqueViolation проверяет, что запрос нарушил уникальный индекс
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func scanWarehouse(row pgx.Row) (*proto.Warehouse, error) {
+	var warehouse proto.Warehouse
+	var latitude, longitude *float64
+	err := row.Scan(
+		&warehouse.WarehouseId, &warehouse.Name, &warehouse.Priority,
+		&latitude, &longitude, &warehouse.Active, &warehouse.IsDefault,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if latitude != nil && longitude != nil {
+		warehouse.Location = &proto.GeoPoint{Latitude: *latitude, Longitude: *longitude}
+	}
+	return &warehouse, nil
+}
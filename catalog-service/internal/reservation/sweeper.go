@@ -0,0 +1,46 @@
+package reservation
+
+import (
+	"context"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"time"
+)
+
+// Sweeper периодически снимает просроченные резервы, чтобы товар,
+// зарезервированный упавшим клиентом, вернулся на склад
+type Sweeper struct {
+	db       db.CatalogDB
+	interval time.Duration
+}
+
+// NewSweeper создает сборщик, который запускается раз в interval
+func NewSweeper(db db.CatalogDB, interval time.Duration) *Sweeper {
+	return &Sweeper{db: db, interval: interval}
+}
+
+// Run выполняет проверку до отмены ctx
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *Sweeper) sweep() {
+	expired, err := s.db.ExpireReservations()
+	if err != nil {
+		log.Printf("Ошибка при снятии просроченных резервов: %v", err)
+		return
+	}
+	if expired > 0 {
+		log.Printf("Снято просроченных резервов: %d", expired)
+	}
+}
@@ -0,0 +1,137 @@
+package stockfeed
+
+import (
+	"context"
+	"log"
+	db "store/catalog-service/internal/repository"
+	"store/proto"
+	"sync"
+	"time"
+)
+
+// Feed периодически читает журнал изменений остатков и рассылает новые записи
+// подписчикам WatchStock. Журнал пишется в базе, поэтому подписчики видят
+// изменения, сделанные любой репликой каталога.
+//
+// Если подписчик не успевает читать и его буфер переполнен, Feed закрывает его канал:
+// подписчик должен дочитать пропущенное из журнала и подписаться заново
+type Feed struct {
+	db        db.CatalogDB
+	interval  time.Duration
+	batchSize int
+	buffer    int
+
+	// Позиция журнала, до которой изменения уже разосланы; меняется только в Run
+	last    int64
+	started bool
+
+	mu          sync.Mutex
+	subscribers map[chan *proto.StockChange]map[int32]bool
+}
+
+// NewFeed создает ленту, опрашивающую журнал раз в interval пачками по batchSize записей.
+// buffer - сколько изменений может ждать каждого подписчика
+func NewFeed(db db.CatalogDB, interval time.Duration, batchSize int, buffer int) *Feed {
+	return &Feed{
+		db:          db,
+		interval:    interval,
+		batchSize:   batchSize,
+		buffer:      buffer,
+		subscribers: make(map[chan *proto.StockChange]map[int32]bool),
+	}
+}
+
+// Subscribe подписывает на изменения товаров productIDs (пусто - всех товаров).
+// Канал закрывается при вызове возвращенной функции или если подписчик отстал
+func (f *Feed) Subscribe(productIDs []int32) (<-chan *proto.StockChange, func()) {
+	var products map[int32]bool
+	if len(productIDs) > 0 {
+		products = make(map[int32]bool, len(productIDs))
+		for _, id := range productIDs {
+			products[id] = true
+		}
+	}
+	ch := make(chan *proto.StockChange, f.buffer)
+
+	f.mu.Lock()
+	f.subscribers[ch] = products
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.remove(ch)
+	}
+}
+
+// remove закрывает канал подписчика; вызывается под f.mu
+func (f *Feed) remove(ch chan *proto.StockChange) {
+	if _, ok := f.subscribers[ch]; ok {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Publish рассылает изменение подписчикам, которые следят за этим товаром
+func (f *Feed) Publish(change *proto.StockChange) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch, products := range f.subscribers {
+		if products != nil && !products[change.ProductId] {
+			continue
+		}
+		select {
+		case ch <- change:
+		default:
+			f.remove(ch)
+		}
+	}
+}
+
+// Run опрашивает журнал до отмены ctx
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.poll(); err != nil {
+				log.Printf("Ошибка при чтении журнала изменений остатков: %v", err)
+			}
+		}
+	}
+}
+
+// poll назначает позиции новым изменениям и дочитывает журнал до конца.
+// При первом запуске лента начинает с текущей позиции:
+// более ранние изменения подписчики получают из журнала сами
+func (f *Feed) poll() error {
+	if _, err := f.db.SequenceStockChanges(); err != nil {
+		return err
+	}
+	if !f.started {
+		_, latest, err := f.db.StockSequenceRange()
+		if err != nil {
+			return err
+		}
+		f.last, f.started = latest, true
+	}
+
+	for {
+		changes, err := f.db.GetStockChanges(f.last, nil, f.batchSize)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			f.Publish(change)
+			f.last = change.Sequence
+		}
+		if len(changes) < f.batchSize {
+			return nil
+		}
+	}
+}
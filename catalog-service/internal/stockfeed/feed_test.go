@@ -0,0 +1,74 @@
+package stockfeed
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	mock "store/catalog-service/internal/repository/mock"
+	"store/proto"
+)
+
+func TestFeed_PublishFiltersByProduct(t *testing.T) {
+	feed := NewFeed(nil, 0, 10, 4)
+
+	kettles, unsubscribeKettles := feed.Subscribe([]int32{2})
+	defer unsubscribeKettles()
+	all, unsubscribeAll := feed.Subscribe(nil)
+	defer unsubscribeAll()
+
+	mug := &proto.StockChange{Sequence: 1, ProductId: 4, StockQuantity: 94}
+	kettle := &proto.StockChange{Sequence: 2, ProductId: 2, StockQuantity: 99}
+	feed.Publish(mug)
+	feed.Publish(kettle)
+
+	assert.Equal(t, kettle, <-kettles)
+	assert.Empty(t, kettles)
+	assert.Equal(t, mug, <-all)
+	assert.Equal(t, kettle, <-all)
+}
+
+func TestFeed_LaggingSubscriberIsClosed(t *testing.T) {
+	feed := NewFeed(nil, 0, 10, 1)
+
+	updates, unsubscribe := feed.Subscribe(nil)
+	feed.Publish(&proto.StockChange{Sequence: 1, ProductId: 1})
+	feed.Publish(&proto.StockChange{Sequence: 2, ProductId: 1})
+
+	// Первое изменение осталось в буфере, второе не поместилось - канал закрыт
+	assert.Equal(t, int64(1), (<-updates).Sequence)
+	_, open := <-updates
+	assert.False(t, open)
+
+	// Повторная отписка безопасна
+	unsubscribe()
+}
+
+func TestFeed_PollStartsFromLatestAndReadsInBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockCatalogDB(ctrl)
+	feed := NewFeed(mockDB, 0, 2, 10)
+	updates, unsubscribe := feed.Subscribe(nil)
+	defer unsubscribe()
+
+	first := []*proto.StockChange{{Sequence: 11, ProductId: 1}, {Sequence: 12, ProductId: 2}}
+	second := []*proto.StockChange{{Sequence: 14, ProductId: 1}}
+	// Перед чтением журнала лента назначает позиции новым изменениям
+	gomock.InOrder(
+		mockDB.EXPECT().SequenceStockChanges().Return(3, nil),
+		mockDB.EXPECT().StockSequenceRange().Return(int64(1), int64(10), nil),
+		mockDB.EXPECT().GetStockChanges(int64(10), nil, 2).Return(first, nil),
+		mockDB.EXPECT().GetStockChanges(int64(12), nil, 2).Return(second, nil),
+		mockDB.EXPECT().SequenceStockChanges().Return(0, nil),
+		mockDB.EXPECT().GetStockChanges(int64(14), nil, 2).Return(nil, nil),
+	)
+
+	assert.NoError(t, feed.poll())
+	assert.NoError(t, feed.poll())
+
+	assert.Equal(t, int64(11), (<-updates).Sequence)
+	assert.Equal(t, int64(12), (<-updates).Sequence)
+	assert.Equal(t, int64(14), (<-updates).Sequence)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ReservationItems;
+DROP TABLE IF EXISTS Reservations;
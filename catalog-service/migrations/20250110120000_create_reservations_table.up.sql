@@ -0,0 +1,16 @@
+CREATE TABLE Reservations (
+    ReservationID   SERIAL PRIMARY KEY,
+    Status          VARCHAR(20)           NOT NULL    DEFAULT 'pending',
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    ExpiresAt       TIMESTAMP             NOT NULL
+);
+
+CREATE TABLE ReservationItems (
+    ReservationID   INT                   NOT NULL    REFERENCES Reservations (ReservationID) ON DELETE CASCADE,
+    ProductID       INT                   NOT NULL,
+    Quantity        INT                   NOT NULL    CHECK (Quantity > 0),
+    PRIMARY KEY (ReservationID, ProductID)
+);
+
+-- Индекс для поиска просроченных резервов
+CREATE INDEX reservations_pending_expires_idx ON Reservations (ExpiresAt) WHERE Status = 'pending';
@@ -0,0 +1,7 @@
+-- Примененные операции с остатком: повтор операции с тем же OperationID ничего не меняет
+CREATE TABLE StockOperations (
+    OperationID     VARCHAR(255)          PRIMARY KEY,
+    ProductID       INT                   NOT NULL,
+    Quantity        INT                   NOT NULL,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,9 @@
+-- Ключи идемпотентности AddProduct: повтор запроса с тем же ключом возвращает исходный ProductID
+CREATE TABLE IdempotencyKeys (
+    IdempotencyKey  VARCHAR(255)          PRIMARY KEY,
+    RequestHash     VARCHAR(64)           NOT NULL,
+    ProductID       INT,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_idempotencykeys_createdat ON IdempotencyKeys (CreatedAt);
@@ -0,0 +1 @@
+ALTER TABLE Catalog DROP COLUMN IF EXISTS Currency;
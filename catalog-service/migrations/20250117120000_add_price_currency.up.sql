@@ -0,0 +1,2 @@
+-- Валюта цены товара; PricePerUnit хранится точно в NUMERIC и читается без float
+ALTER TABLE Catalog ADD COLUMN Currency CHAR(3) NOT NULL DEFAULT 'RUB';
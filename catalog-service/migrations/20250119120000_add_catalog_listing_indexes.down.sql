@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_catalog_price_id;
+DROP INDEX IF EXISTS idx_catalog_name_id;
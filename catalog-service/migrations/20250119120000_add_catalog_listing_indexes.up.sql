@@ -0,0 +1,3 @@
+-- Индексы под keyset-пагинацию GetAllProducts по названию и цене
+CREATE INDEX idx_catalog_name_id ON Catalog (ProductName, ProductID);
+CREATE INDEX idx_catalog_price_id ON Catalog (PricePerUnit, ProductID);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS catalog_stock_changes ON Catalog;
+DROP FUNCTION IF EXISTS record_stock_change();
+DROP TABLE IF EXISTS StockChanges;
@@ -0,0 +1,37 @@
+-- Журнал изменений остатков для WatchStock. Sequence - позиция, с которой клиент
+-- продолжает поток после переподключения. StockQuantity - остаток после изменения
+CREATE TABLE StockChanges (
+    Sequence        BIGSERIAL             PRIMARY KEY,
+    ProductID       INT                   NOT NULL,
+    StockQuantity   INT                   NOT NULL,
+    Deleted         BOOLEAN               NOT NULL    DEFAULT FALSE,
+    ChangedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stockchanges_product_sequence ON StockChanges (ProductID, Sequence);
+CREATE INDEX idx_stockchanges_changedat ON StockChanges (ChangedAt);
+
+-- Запись делает триггер в той же транзакции, что и само изменение, поэтому
+-- в журнал попадают все пути: AddProduct, UpdateProduct, DeleteProduct, резервы и возвраты.
+-- Блокировка до конца транзакции выстраивает коммиты в порядке Sequence:
+-- читатель журнала не увидит позицию N+1 раньше, чем закоммитится N
+CREATE FUNCTION record_stock_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.StockQuantity IS NOT DISTINCT FROM OLD.StockQuantity THEN
+        RETURN NULL;
+    END IF;
+
+    PERFORM pg_advisory_xact_lock(hashtext('stockchanges'));
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO StockChanges (ProductID, StockQuantity, Deleted) VALUES (OLD.ProductID, 0, TRUE);
+    ELSE
+        INSERT INTO StockChanges (ProductID, StockQuantity) VALUES (NEW.ProductID, NEW.StockQuantity);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER catalog_stock_changes
+    AFTER INSERT OR DELETE OR UPDATE OF StockQuantity ON Catalog
+    FOR EACH ROW EXECUTE FUNCTION record_stock_change();
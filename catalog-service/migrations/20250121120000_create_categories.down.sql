@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS ProductCategories;
+DROP TABLE IF EXISTS Categories;
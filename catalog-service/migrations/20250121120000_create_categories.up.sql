@@ -0,0 +1,20 @@
+-- Дерево категорий: ParentID IS NULL - корневая категория
+CREATE TABLE Categories (
+    CategoryID      SERIAL                PRIMARY KEY,
+    Name            VARCHAR(255)          NOT NULL,
+    ParentID        INT                   REFERENCES Categories (CategoryID) ON DELETE RESTRICT,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Имена соседних категорий не повторяются (без учета регистра)
+CREATE UNIQUE INDEX idx_categories_parent_name ON Categories (COALESCE(ParentID, 0), lower(Name));
+CREATE INDEX idx_categories_parentid ON Categories (ParentID);
+
+-- Товар может входить в несколько категорий
+CREATE TABLE ProductCategories (
+    ProductID       INT                   NOT NULL    REFERENCES Catalog (ProductID) ON DELETE CASCADE,
+    CategoryID      INT                   NOT NULL    REFERENCES Categories (CategoryID) ON DELETE CASCADE,
+    PRIMARY KEY (ProductID, CategoryID)
+);
+
+CREATE INDEX idx_productcategories_categoryid ON ProductCategories (CategoryID);
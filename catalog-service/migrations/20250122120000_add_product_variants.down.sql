@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_catalog_variant_attributes;
+DROP INDEX IF EXISTS idx_catalog_sku;
+ALTER TABLE Catalog DROP CONSTRAINT IF EXISTS catalog_variant_sku_check;
+ALTER TABLE Catalog
+    DROP COLUMN IF EXISTS VariantAttributes,
+    DROP COLUMN IF EXISTS SKU,
+    DROP COLUMN IF EXISTS ParentProductID;
@@ -0,0 +1,15 @@
+-- Варианты товара (цвет, объем...) - обычные строки Catalog со ссылкой на родительский товар:
+-- остаток, цена, резервы и журнал остатков у варианта свои, как у любого товара
+ALTER TABLE Catalog
+    ADD COLUMN ParentProductID   INT             REFERENCES Catalog (ProductID) ON DELETE CASCADE,
+    ADD COLUMN SKU               VARCHAR(64),
+    ADD COLUMN VariantAttributes JSONB           NOT NULL    DEFAULT '{}';
+
+-- У каждого варианта есть артикул, по нему вариант указывают в заказе
+ALTER TABLE Catalog ADD CONSTRAINT catalog_variant_sku_check
+    CHECK (ParentProductID IS NULL OR SKU IS NOT NULL);
+
+CREATE UNIQUE INDEX idx_catalog_sku ON Catalog (SKU);
+-- Два варианта одного товара не могут совпадать по всем атрибутам
+CREATE UNIQUE INDEX idx_catalog_variant_attributes ON Catalog (ParentProductID, VariantAttributes)
+    WHERE ParentProductID IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_catalog_attributes;
+ALTER TABLE Catalog DROP COLUMN IF EXISTS Attributes;
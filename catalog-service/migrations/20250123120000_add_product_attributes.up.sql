@@ -0,0 +1,6 @@
+-- Характеристики товара (мощность, объем, материал...): у разных типов товаров они разные,
+-- поэтому хранятся в JSONB. Значения - строки, числа или логические значения
+ALTER TABLE Catalog ADD COLUMN Attributes JSONB NOT NULL DEFAULT '{}';
+
+-- jsonb_path_ops поддерживает @> (равенство) и @? (диапазоны чисел) фильтров GetAllProducts
+CREATE INDEX idx_catalog_attributes ON Catalog USING GIN (Attributes jsonb_path_ops);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_catalog_search;
+ALTER TABLE Catalog DROP COLUMN IF EXISTS SearchVector;
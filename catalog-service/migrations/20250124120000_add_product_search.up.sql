@@ -0,0 +1,11 @@
+-- Поисковый вектор товара для SearchProducts. Название разбирается русской и английской
+-- конфигурациями (вес A), артикул - как есть (вес A), строковые характеристики - русской (вес C).
+-- Генерируемый столбец пересчитывается самим PostgreSQL при каждом изменении строки
+ALTER TABLE Catalog ADD COLUMN SearchVector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('russian', ProductName), 'A') ||
+    setweight(to_tsvector('english', ProductName), 'A') ||
+    setweight(to_tsvector('simple', COALESCE(SKU, '')), 'A') ||
+    setweight(jsonb_to_tsvector('russian', Attributes, '["string"]'), 'C')
+) STORED;
+
+CREATE INDEX idx_catalog_search ON Catalog USING GIN (SearchVector);
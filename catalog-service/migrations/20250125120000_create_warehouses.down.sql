@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS warehouse_stock_sync ON WarehouseStock;
+DROP FUNCTION IF EXISTS sync_catalog_stock();
+ALTER TABLE ReservationItems DROP COLUMN IF EXISTS WarehouseID;
+DROP TABLE IF EXISTS WarehouseStock;
+DROP TABLE IF EXISTS Warehouses;
@@ -0,0 +1,65 @@
+-- Склады. Priority задает порядок для стратегии PRIORITY (меньше - раньше),
+-- координаты - для стратегии NEAREST. Ровно один склад - склад по умолчанию:
+-- на него приходит остаток, для которого склад не указан
+CREATE TABLE Warehouses (
+    WarehouseID     SERIAL                PRIMARY KEY,
+    Name            VARCHAR(255)          NOT NULL,
+    Priority        INT                   NOT NULL    DEFAULT 0,
+    Latitude        DOUBLE PRECISION,
+    Longitude       DOUBLE PRECISION,
+    Active          BOOLEAN               NOT NULL    DEFAULT TRUE,
+    IsDefault       BOOLEAN               NOT NULL    DEFAULT FALSE,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT warehouses_location_check CHECK ((Latitude IS NULL) = (Longitude IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_warehouses_name ON Warehouses (lower(Name));
+CREATE UNIQUE INDEX idx_warehouses_default ON Warehouses (IsDefault) WHERE IsDefault;
+
+-- Остатки по складам. Catalog.StockQuantity - их сумма, ее поддерживает триггер ниже
+CREATE TABLE WarehouseStock (
+    ProductID       INT                   NOT NULL,
+    WarehouseID     INT                   NOT NULL,
+    Quantity        INT                   NOT NULL    CHECK (Quantity >= 0),
+    PRIMARY KEY (ProductID, WarehouseID),
+    CONSTRAINT warehouse_stock_product_fkey FOREIGN KEY (ProductID)
+        REFERENCES Catalog (ProductID) ON DELETE CASCADE,
+    CONSTRAINT warehouse_stock_warehouse_fkey FOREIGN KEY (WarehouseID)
+        REFERENCES Warehouses (WarehouseID) ON DELETE RESTRICT
+);
+
+CREATE INDEX idx_warehousestock_warehouseid ON WarehouseStock (WarehouseID);
+
+-- Весь текущий остаток переносим на склад по умолчанию
+INSERT INTO Warehouses (Name, IsDefault) VALUES ('Основной склад', TRUE);
+INSERT INTO WarehouseStock (ProductID, WarehouseID, Quantity)
+SELECT ProductID, (SELECT WarehouseID FROM Warehouses WHERE IsDefault), StockQuantity
+FROM Catalog
+WHERE StockQuantity > 0;
+
+-- Позиция резерва списывается с одного склада. NULL - резерв создан до появления складов
+ALTER TABLE ReservationItems ADD COLUMN WarehouseID INT REFERENCES Warehouses (WarehouseID);
+
+-- Изменение остатка на складе меняет общий остаток товара в той же транзакции,
+-- поэтому журнал StockChanges и WatchStock видят общий остаток как раньше.
+-- Строки WarehouseStock удаляются только вместе с товаром, DELETE не отслеживается
+CREATE FUNCTION sync_catalog_stock() RETURNS trigger AS $$
+DECLARE
+    delta INT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        delta := NEW.Quantity;
+    ELSE
+        delta := NEW.Quantity - OLD.Quantity;
+    END IF;
+
+    IF delta <> 0 THEN
+        UPDATE Catalog SET StockQuantity = StockQuantity + delta WHERE ProductID = NEW.ProductID;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER warehouse_stock_sync
+    AFTER INSERT OR UPDATE OF Quantity ON WarehouseStock
+    FOR EACH ROW EXECUTE FUNCTION sync_catalog_stock();
@@ -0,0 +1,3 @@
+ALTER TABLE Reservations DROP COLUMN IF EXISTS Actor, DROP COLUMN IF EXISTS OrderID;
+DROP TABLE IF EXISTS StockMovements;
+DROP FUNCTION IF EXISTS forbid_stock_movement_change();
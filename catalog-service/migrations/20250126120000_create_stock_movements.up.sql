@@ -0,0 +1,41 @@
+-- Журнал движений товара по складам. Каждое изменение WarehouseStock записывается
+-- сюда в той же транзакции, поэтому остаток на складе всегда равен сумме Delta
+-- его движений. Строки журнала не меняются и не удаляются, товар в журнале
+-- остается и после удаления из каталога, поэтому внешнего ключа на Catalog нет
+CREATE TABLE StockMovements (
+    MovementID      BIGSERIAL             PRIMARY KEY,
+    ProductID       INT                   NOT NULL,
+    WarehouseID     INT                   NOT NULL    REFERENCES Warehouses (WarehouseID),
+    Delta           INT                   NOT NULL    CHECK (Delta <> 0),
+    Reason          VARCHAR(20)           NOT NULL
+        CHECK (Reason IN ('sale', 'return', 'restock', 'adjustment')),
+    OrderID         INT,
+    ReservationID   INT,
+    Actor           VARCHAR(255)          NOT NULL    DEFAULT '',
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_stockmovements_product ON StockMovements (ProductID, MovementID);
+CREATE INDEX idx_stockmovements_order ON StockMovements (OrderID) WHERE OrderID IS NOT NULL;
+
+CREATE FUNCTION forbid_stock_movement_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'stock movements are immutable';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stock_movements_immutable
+    BEFORE UPDATE OR DELETE ON StockMovements
+    FOR EACH ROW EXECUTE FUNCTION forbid_stock_movement_change();
+
+-- Текущие остатки становятся начальными записями журнала
+INSERT INTO StockMovements (ProductID, WarehouseID, Delta, Reason, Actor)
+SELECT ProductID, WarehouseID, Quantity, 'adjustment', 'migration'
+FROM WarehouseStock
+WHERE Quantity > 0
+ORDER BY ProductID, WarehouseID;
+
+-- Заказ и инициатор резерва: по ним записываются движения при снятии резерва
+ALTER TABLE Reservations
+    ADD COLUMN OrderID INT,
+    ADD COLUMN Actor   VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_catalog_low_stock;
+DROP INDEX IF EXISTS idx_catalog_stock_alert;
+ALTER TABLE Catalog DROP COLUMN IF EXISTS StockAlertLevel, DROP COLUMN IF EXISTS ReorderThreshold;
@@ -0,0 +1,20 @@
+-- Порог дозаказа: товар с остатком не выше порога считается заканчивающимся.
+-- StockAlertLevel - уровень остатка, о котором уже отправлено оповещение:
+-- ok, low (остаток не выше порога) или out (товар закончился)
+ALTER TABLE Catalog
+    ADD COLUMN ReorderThreshold INT         NOT NULL    DEFAULT 0 CHECK (ReorderThreshold >= 0),
+    ADD COLUMN StockAlertLevel  VARCHAR(10) NOT NULL    DEFAULT 'ok'
+        CHECK (StockAlertLevel IN ('ok', 'low', 'out'));
+
+-- Текущее состояние считаем уже известным, оповещения пойдут об изменениях после миграции
+UPDATE Catalog SET StockAlertLevel = 'out' WHERE StockQuantity <= 0;
+
+-- Товары, уровень остатка которых изменился с последнего оповещения
+CREATE INDEX idx_catalog_stock_alert ON Catalog (ProductID)
+    WHERE (CASE WHEN StockQuantity <= 0 THEN 'out'
+                WHEN StockQuantity <= ReorderThreshold THEN 'low'
+                ELSE 'ok' END) <> StockAlertLevel;
+
+-- Заканчивающиеся товары для ListLowStockProducts, от меньшего остатка к большему
+CREATE INDEX idx_catalog_low_stock ON Catalog (StockQuantity, ProductID)
+    WHERE StockQuantity <= ReorderThreshold;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_stockmovements_purchase_order;
+ALTER TABLE StockMovements DROP COLUMN IF EXISTS PurchaseOrderID;
+DROP TABLE IF EXISTS PurchaseOrderReceipts;
+DROP TABLE IF EXISTS PurchaseOrderItems;
+DROP TABLE IF EXISTS PurchaseOrders;
+DROP TABLE IF EXISTS Suppliers;
@@ -0,0 +1,50 @@
+-- Поставщики товара
+CREATE TABLE Suppliers (
+    SupplierID      SERIAL                PRIMARY KEY,
+    Name            VARCHAR(255)          NOT NULL,
+    Email           VARCHAR(255)          NOT NULL    DEFAULT '',
+    Phone           VARCHAR(50)           NOT NULL    DEFAULT '',
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_suppliers_name ON Suppliers (lower(Name));
+
+-- Заказ поставщику. Товар приходит на склад WarehouseID
+CREATE TABLE PurchaseOrders (
+    PurchaseOrderID SERIAL                PRIMARY KEY,
+    SupplierID      INT                   NOT NULL,
+    WarehouseID     INT                   NOT NULL,
+    Status          VARCHAR(20)           NOT NULL    DEFAULT 'open'
+        CHECK (Status IN ('open', 'partially_received', 'received', 'cancelled')),
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    UpdatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT purchase_orders_supplier_fkey FOREIGN KEY (SupplierID)
+        REFERENCES Suppliers (SupplierID),
+    CONSTRAINT purchase_orders_warehouse_fkey FOREIGN KEY (WarehouseID)
+        REFERENCES Warehouses (WarehouseID)
+);
+
+CREATE INDEX idx_purchaseorders_supplier ON PurchaseOrders (SupplierID, PurchaseOrderID);
+
+-- Позиции заказа поставщику. Внешнего ключа на Catalog нет, как и у журнала движений:
+-- удаление товара не должно стирать историю закупок
+CREATE TABLE PurchaseOrderItems (
+    PurchaseOrderID  INT                  NOT NULL    REFERENCES PurchaseOrders (PurchaseOrderID) ON DELETE CASCADE,
+    ProductID        INT                  NOT NULL,
+    Quantity         INT                  NOT NULL    CHECK (Quantity > 0),
+    ReceivedQuantity INT                  NOT NULL    DEFAULT 0,
+    PRIMARY KEY (PurchaseOrderID, ProductID),
+    CHECK (ReceivedQuantity BETWEEN 0 AND Quantity)
+);
+
+-- Ключи примененных приемок: повтор приемки с тем же ключом не увеличит остаток второй раз
+CREATE TABLE PurchaseOrderReceipts (
+    OperationID     VARCHAR(255)          PRIMARY KEY,
+    PurchaseOrderID INT                   NOT NULL    REFERENCES PurchaseOrders (PurchaseOrderID) ON DELETE CASCADE,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Приход по заказу поставщику записывается в журнал со ссылкой на заказ
+ALTER TABLE StockMovements ADD COLUMN PurchaseOrderID INT;
+
+CREATE INDEX idx_stockmovements_purchase_order ON StockMovements (PurchaseOrderID) WHERE PurchaseOrderID IS NOT NULL;
@@ -0,0 +1,24 @@
+-- История цен товара. Цена действует в интервале [EffectiveFrom, EffectiveTo),
+-- EffectiveTo NULL - бессрочно. Интервалы одного товара не пересекаются: их
+-- меняет только репозиторий под блокировкой строки товара. Catalog.PricePerUnit -
+-- копия цены, действующей сейчас; запланированные цены переносит туда фоновая задача
+CREATE TABLE ProductPrices (
+    PriceID         BIGSERIAL             PRIMARY KEY,
+    ProductID       INT                   NOT NULL    REFERENCES Catalog (ProductID) ON DELETE CASCADE,
+    Price           NUMERIC(10, 2)        NOT NULL    CHECK (Price >= 0),
+    Currency        CHAR(3)               NOT NULL,
+    EffectiveFrom   TIMESTAMPTZ           NOT NULL,
+    EffectiveTo     TIMESTAMPTZ,
+    Actor           VARCHAR(255)          NOT NULL    DEFAULT '',
+    CreatedAt       TIMESTAMPTZ           NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT product_prices_range_check CHECK (EffectiveTo IS NULL OR EffectiveTo > EffectiveFrom)
+);
+
+CREATE UNIQUE INDEX idx_productprices_product_from ON ProductPrices (ProductID, EffectiveFrom);
+
+-- Текущие цены становятся началом истории. Момент назначения прежних цен неизвестен,
+-- поэтому история начинается с миграции
+INSERT INTO ProductPrices (ProductID, Price, Currency, EffectiveFrom, Actor)
+SELECT ProductID, PricePerUnit, Currency, CURRENT_TIMESTAMP, 'migration'
+FROM Catalog
+ORDER BY ProductID;
@@ -0,0 +1,40 @@
+-- Изменения без позиции получают ее сразу, чтобы не потеряться
+UPDATE StockChanges c
+SET Sequence = n.Sequence
+FROM (
+    SELECT ChangeID,
+           (SELECT COALESCE(MAX(Sequence), 0) FROM StockChanges)
+           + row_number() OVER (ORDER BY TxID, ChangeID) AS Sequence
+    FROM StockChanges
+    WHERE Sequence IS NULL
+) n
+WHERE c.ChangeID = n.ChangeID;
+
+SELECT setval('stockchanges_sequence_seq', (SELECT COALESCE(MAX(Sequence), 0) + 1 FROM StockChanges), false);
+
+DROP INDEX IF EXISTS idx_stockchanges_unsequenced;
+DROP INDEX IF EXISTS idx_stockchanges_sequence;
+ALTER TABLE StockChanges
+    DROP COLUMN IF EXISTS TxID,
+    DROP COLUMN IF EXISTS ChangeID;
+ALTER TABLE StockChanges
+    ALTER COLUMN Sequence SET NOT NULL,
+    ALTER COLUMN Sequence SET DEFAULT nextval('stockchanges_sequence_seq'),
+    ADD PRIMARY KEY (Sequence);
+
+CREATE OR REPLACE FUNCTION record_stock_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.StockQuantity IS NOT DISTINCT FROM OLD.StockQuantity THEN
+        RETURN NULL;
+    END IF;
+
+    PERFORM pg_advisory_xact_lock(hashtext('stockchanges'));
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO StockChanges (ProductID, StockQuantity, Deleted) VALUES (OLD.ProductID, 0, TRUE);
+    ELSE
+        INSERT INTO StockChanges (ProductID, StockQuantity) VALUES (NEW.ProductID, NEW.StockQuantity);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
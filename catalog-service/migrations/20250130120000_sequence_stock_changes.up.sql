@@ -0,0 +1,32 @@
+-- Позиции журнала изменений остатков назначаются после коммита, а не триггером.
+-- Раньше триггер брал общую блокировку, чтобы коммиты шли в порядке Sequence,
+-- и этим выстраивал в очередь все изменения остатков каталога.
+-- Теперь триггер только записывает изменение с ID своей транзакции, а лента WatchStock
+-- назначает позиции изменениям транзакций старше pg_snapshot_xmin: такие транзакции
+-- уже завершились, и изменение с меньшей позицией позже не появится
+ALTER TABLE StockChanges DROP CONSTRAINT stockchanges_pkey;
+ALTER TABLE StockChanges
+    ALTER COLUMN Sequence DROP DEFAULT,
+    ALTER COLUMN Sequence DROP NOT NULL;
+ALTER TABLE StockChanges ADD COLUMN ChangeID BIGSERIAL PRIMARY KEY;
+-- У записей до миграции позиция уже есть, TxID им не нужен
+ALTER TABLE StockChanges ADD COLUMN TxID xid8;
+ALTER TABLE StockChanges ALTER COLUMN TxID SET DEFAULT pg_current_xact_id();
+
+CREATE UNIQUE INDEX idx_stockchanges_sequence ON StockChanges (Sequence);
+CREATE INDEX idx_stockchanges_unsequenced ON StockChanges (TxID, ChangeID) WHERE Sequence IS NULL;
+
+CREATE OR REPLACE FUNCTION record_stock_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND NEW.StockQuantity IS NOT DISTINCT FROM OLD.StockQuantity THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO StockChanges (ProductID, StockQuantity, Deleted) VALUES (OLD.ProductID, 0, TRUE);
+    ELSE
+        INSERT INTO StockChanges (ProductID, StockQuantity) VALUES (NEW.ProductID, NEW.StockQuantity);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,37 @@
+// Package idempotency содержит общие для сервисов помощники ключей идемпотентности
+// и отпечатков запросов
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"google.golang.org/grpc/metadata"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Key возвращает ключ идемпотентности из поля запроса,
+// а если оно пустое - из метаданных idempotency-key
+func Key(ctx context.Context, key string) string {
+	if key != "" {
+		return key
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("idempotency-key"); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// RequestHash возвращает отпечаток запроса, по которому повтор с тем же
+// ключом отличается от другого запроса. Поле ключа перед вызовом нужно очистить
+func RequestHash(req protobuf.Message) (string, error) {
+	data, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,185 @@
+// Package money содержит точную арифметику над proto.Money.
+// Суммы считаются в миллиардных долях через big.Int, без float64
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgtype"
+	"store/proto"
+)
+
+// DefaultCurrency валюта цен, для которых валюта не указана
+const DefaultCurrency = "RUB"
+
+// nanosPerUnit количество nanos в одной единице валюты
+const nanosPerUnit = 1_000_000_000
+
+var (
+	// ErrInvalid возвращается для суммы с nanos вне диапазона или с разными знаками units и nanos
+	ErrInvalid = errors.New("invalid money value")
+	// ErrCurrencyMismatch возвращается при сложении сумм в разных валютах
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrOverflow возвращается, если результат не помещается в int64 units
+	ErrOverflow = errors.New("money overflow")
+)
+
+var bigNanosPerUnit = big.NewInt(nanosPerUnit)
+
+// New создает сумму units + nanos / 10^9
+func New(units int64, nanos int32, currency string) *proto.Money {
+	return &proto.Money{CurrencyCode: currency, Units: units, Nanos: nanos}
+}
+
+// Zero возвращает нулевую сумму в валюте currency
+func Zero(currency string) *proto.Money {
+	return New(0, 0, currency)
+}
+
+// Validate проверяет диапазон nanos и согласованность знаков
+func Validate(m *proto.Money) error {
+	if m == nil {
+		return ErrInvalid
+	}
+	if m.Nanos <= -nanosPerUnit || m.Nanos >= nanosPerUnit {
+		return ErrInvalid
+	}
+	if (m.Units > 0 && m.Nanos < 0) || (m.Units < 0 && m.Nanos > 0) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+// IsNegative сообщает, что сумма меньше нуля
+func IsNegative(m *proto.Money) bool {
+	return m.Units < 0 || m.Nanos < 0
+}
+
+// FitsScale сообщает, что у суммы не больше scale знаков после запятой,
+// то есть ее можно сохранить в NUMERIC(p, scale) без округления
+func FitsScale(m *proto.Money, scale int) bool {
+	if scale >= 9 {
+		return true
+	}
+	step := int32(math.Pow10(9 - scale))
+	return m.Nanos%step == 0
+}
+
+// Add складывает суммы в одной валюте
+func Add(a, b *proto.Money) (*proto.Money, error) {
+	if a.CurrencyCode != b.CurrencyCode {
+		return nil, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.CurrencyCode, b.CurrencyCode)
+	}
+	sum := new(big.Int).Add(toNanos(a), toNanos(b))
+	return fromNanos(sum, a.CurrencyCode)
+}
+
+// Sub вычитает b из a; суммы должны быть в одной валюте
+func Sub(a, b *proto.Money) (*proto.Money, error) {
+	if a.CurrencyCode != b.CurrencyCode {
+		return nil, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.CurrencyCode, b.CurrencyCode)
+	}
+	diff := new(big.Int).Sub(toNanos(a), toNanos(b))
+	return fromNanos(diff, a.CurrencyCode)
+}
+
+// Multiply умножает сумму на целое количество
+func Multiply(m *proto.Money, quantity int64) (*proto.Money, error) {
+	product := new(big.Int).Mul(toNanos(m), big.NewInt(quantity))
+	return fromNanos(product, m.CurrencyCode)
+}
+
+// Parse разбирает десятичную запись вида "5700", "-12.5" или "0.000000001"
+func Parse(s string, currency string) (*proto.Money, error) {
+	value := strings.TrimSpace(s)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+
+	intPart, fracPart, _ := strings.Cut(value, ".")
+	if intPart == "" && fracPart == "" || len(fracPart) > 9 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", 9-len(fracPart))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+	}
+
+	nanos, _ := new(big.Int).SetString(digits, 10)
+	if negative {
+		nanos.Neg(nanos)
+	}
+	return fromNanos(nanos, currency)
+}
+
+// String возвращает десятичную запись суммы без валюты, пригодную для NUMERIC
+func String(m *proto.Money) string {
+	nanos := toNanos(m)
+	sign := ""
+	if nanos.Sign() < 0 {
+		sign = "-"
+		nanos.Neg(nanos)
+	}
+	units, frac := new(big.Int).QuoRem(nanos, bigNanosPerUnit, new(big.Int))
+	if frac.Sign() == 0 {
+		return sign + units.String()
+	}
+	return sign + units.String() + "." + strings.TrimRight(fmt.Sprintf("%09d", frac.Int64()), "0")
+}
+
+// FromNumeric переводит значение NUMERIC из базы в Money без потери точности
+func FromNumeric(n pgtype.Numeric, currency string) (*proto.Money, error) {
+	if n.Status != pgtype.Present || n.NaN || n.InfinityModifier != pgtype.None {
+		return nil, fmt.Errorf("%w: numeric is not a finite value", ErrInvalid)
+	}
+
+	// Значение NUMERIC равно Int * 10^Exp, переводим его в nanos
+	nanos := new(big.Int).Set(n.Int)
+	shift := int64(n.Exp) + 9
+	if shift >= 0 {
+		nanos.Mul(nanos, new(big.Int).Exp(big.NewInt(10), big.NewInt(shift), nil))
+	} else {
+		divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(-shift), nil)
+		quo, rem := new(big.Int).QuoRem(nanos, divisor, new(big.Int))
+		if rem.Sign() != 0 {
+			return nil, fmt.Errorf("%w: more than 9 decimal places", ErrInvalid)
+		}
+		nanos = quo
+	}
+	return fromNanos(nanos, currency)
+}
+
+// FromFloat переводит устаревшее значение double в Money, округляя до копеек
+func FromFloat(v float64, currency string) *proto.Money {
+	cents := int64(math.Round(v * 100))
+	return New(cents/100, int32(cents%100)*10_000_000, currency)
+}
+
+// ToFloat переводит Money в double для устаревших полей
+func ToFloat(m *proto.Money) float64 {
+	if m == nil {
+		return 0
+	}
+	return float64(m.Units) + float64(m.Nanos)/nanosPerUnit
+}
+
+// toNanos возвращает сумму в миллиардных долях
+func toNanos(m *proto.Money) *big.Int {
+	nanos := new(big.Int).Mul(big.NewInt(m.Units), bigNanosPerUnit)
+	return nanos.Add(nanos, big.NewInt(int64(m.Nanos)))
+}
+
+// fromNanos собирает Money из суммы в миллиардных долях.
+// QuoRem округляет к нулю, поэтому знаки units и nanos совпадают
+func fromNanos(nanos *big.Int, currency string) (*proto.Money, error) {
+	units, frac := new(big.Int).QuoRem(nanos, bigNanosPerUnit, new(big.Int))
+	if !units.IsInt64() {
+		return nil, ErrOverflow
+	}
+	return New(units.Int64(), int32(frac.Int64()), currency), nil
+}
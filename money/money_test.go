@@ -0,0 +1,70 @@
+package money
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAndString(t *testing.T) {
+	cases := map[string]string{
+		"5700.00":     "5700",
+		"19.99":       "19.99",
+		"-0.5":        "-0.5",
+		"0.000000001": "0.000000001",
+		"+12":         "12",
+	}
+	for input, want := range cases {
+		m, err := Parse(input, DefaultCurrency)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, String(m), input)
+	}
+
+	for _, input := range []string{"", ".", "1.0000000001", "12a", "--1"} {
+		_, err := Parse(input, DefaultCurrency)
+		assert.ErrorIs(t, err, ErrInvalid, input)
+	}
+}
+
+func TestExactArithmetic(t *testing.T) {
+	price := New(19, 990000000, DefaultCurrency)
+
+	// 19.99 * 3 + 0.03 = 60.00 ровно, без ошибок округления float64
+	lineTotal, err := Multiply(price, 3)
+	assert.NoError(t, err)
+	total, err := Add(lineTotal, New(0, 30000000, DefaultCurrency))
+	assert.NoError(t, err)
+	assert.Equal(t, New(60, 0, DefaultCurrency), total)
+
+	negative, err := Add(New(1, 0, DefaultCurrency), New(-1, -500000000, DefaultCurrency))
+	assert.NoError(t, err)
+	assert.Equal(t, New(0, -500000000, DefaultCurrency), negative)
+
+	diff, err := Sub(New(10, 0, DefaultCurrency), price)
+	assert.NoError(t, err)
+	assert.Equal(t, New(-9, -990000000, DefaultCurrency), diff)
+
+	_, err = Add(price, New(1, 0, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestFromNumeric(t *testing.T) {
+	m, err := FromNumeric(pgtype.Numeric{Int: big.NewInt(570050), Exp: -2, Status: pgtype.Present}, DefaultCurrency)
+	assert.NoError(t, err)
+	assert.Equal(t, New(5700, 500000000, DefaultCurrency), m)
+
+	m, err = FromNumeric(pgtype.Numeric{Int: big.NewInt(12), Exp: 3, Status: pgtype.Present}, DefaultCurrency)
+	assert.NoError(t, err)
+	assert.Equal(t, New(12000, 0, DefaultCurrency), m)
+
+	_, err = FromNumeric(pgtype.Numeric{Status: pgtype.Null}, DefaultCurrency)
+	assert.ErrorIs(t, err, ErrInvalid)
+}
+
+func TestFromFloat(t *testing.T) {
+	assert.Equal(t, New(19, 990000000, DefaultCurrency), FromFloat(19.99, DefaultCurrency))
+	assert.Equal(t, New(-2, -500000000, DefaultCurrency), FromFloat(-2.5, DefaultCurrency))
+	assert.True(t, FitsScale(FromFloat(0.1+0.2, DefaultCurrency), 2))
+}
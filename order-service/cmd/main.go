@@ -6,18 +6,22 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"os"
-	"strings"
 	"net"
+	"os"
 	"store/order-service/internal/client"
 	"store/order-service/internal/handler"
+	"store/order-service/internal/outbox"
 	db "store/order-service/internal/repository"
+	"store/order-service/internal/saga"
+	"store/order-service/internal/watch"
 	"store/proto"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -30,6 +34,8 @@ type Config struct {
 	Port     string
 	DBName   string
 	SSLMode  string
+	// OutboxFile файл для событий заказов; если не задан, события пишутся в лог
+	OutboxFile string
 }
 
 // loadConfig загружает конфигурацию из текстового файла
@@ -67,6 +73,8 @@ func loadConfig(filePath string) (*Config, error) {
 			config.DBName = value
 		case "DB_SSLMODE":
 			config.SSLMode = value
+		case "OUTBOX_FILE":
+			config.OutboxFile = value
 		}
 	}
 
@@ -80,21 +88,21 @@ func loadConfig(filePath string) (*Config, error) {
 func generateDBURL(cfg Config, dbname bool) string {
 	if dbname {
 		return fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s?sslmode=%s", 
-			cfg.Username, 
-			cfg.Password, 
-			cfg.Host, 
-			cfg.Port, 
-			cfg.DBName, 
+			"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+			cfg.Username,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.DBName,
 			cfg.SSLMode,
 		)
 	} else {
 		return fmt.Sprintf(
-			"postgres://%s:%s@%s:%s?sslmode=%s", 
-			cfg.Username, 
-			cfg.Password, 
-			cfg.Host, 
-			cfg.Port, 
+			"postgres://%s:%s@%s:%s?sslmode=%s",
+			cfg.Username,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
 			cfg.SSLMode,
 		)
 	}
@@ -110,7 +118,7 @@ func createDatabaseIfNotExists(dbURL, dbName string) error {
 
 	var exists bool
 	err = db.QueryRow(
-		"SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)", 
+		"SELECT EXISTS (SELECT FROM pg_database WHERE datname = $1)",
 		dbName,
 	).Scan(&exists)
 	if err != nil {
@@ -148,6 +156,24 @@ func runMigrations(databaseURL string) error {
 	return nil
 }
 
+// runEvery раз в interval выполняет task, пока не отменен ctx.
+// Ошибка задачи только логируется: следующий запуск попробует снова
+func runEvery(ctx context.Context, interval time.Duration, task func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := task(ctx); err != nil {
+				log.Printf("Ошибка фоновой задачи: %v", err)
+			}
+		}
+	}
+}
+
 func main() {
 	// Загружаем конфигурацию
 	config, err := loadConfig("config.txt") // Укажите путь к вашему текстовому файлу
@@ -165,15 +191,16 @@ func main() {
 
 	// Подключаемся к базе данных
 	dbURLWithDB := generateDBURL(*config, true)
-	conn, err := pgx.Connect(context.Background(), dbURLWithDB)
+	// Пул соединений: к базе одновременно обращаются gRPC-обработчики и ретранслятор событий
+	conn, err := pgxpool.Connect(context.Background(), dbURLWithDB)
 	if err != nil {
 		log.Fatalf("Unable to connect to database: %v\n", err)
 	}
-	defer conn.Close(context.Background())
+	defer conn.Close()
 	fmt.Println("Connected to PostgreSQL!")
 
 	// Применяем миграции
-	if err := runMigrations(dbURLWithDB+"&x-migrations-table=order_migrations"); err != nil {
+	if err := runMigrations(dbURLWithDB + "&x-migrations-table=order_migrations"); err != nil {
 		log.Fatalf("Failed to run migrations: %v\n", err)
 	}
 	fmt.Println("Migrations applied successfully!")
@@ -186,15 +213,51 @@ func main() {
 	defer catalogClient.Close()
 
 	// Создаем экземпляр OrderDB
-	orderDB := db.NewOrderDB(conn, catalogClient)
+	orderDB := db.NewOrderDB(conn)
+
+	// Доводим до конца или откатываем саги, прерванные прошлым запуском
+	orderSaga := saga.NewCreateOrderSaga(orderDB, catalogClient)
+	if err := orderSaga.Recover(context.Background()); err != nil {
+		log.Printf("Ошибка при восстановлении саг: %v", err)
+	}
+
+	// Запускаем публикацию событий заказов из outbox
+	var publisher outbox.Publisher = outbox.LogPublisher{}
+	if config.OutboxFile != "" {
+		eventsFile, err := os.OpenFile(config.OutboxFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open outbox file: %v\n", err)
+		}
+		defer eventsFile.Close()
+		publisher = outbox.NewWriterPublisher(eventsFile)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go outbox.NewRelay(orderDB, publisher, time.Second, 100).Run(ctx)
+	go runEvery(ctx, time.Hour, func(ctx context.Context) error {
+		purged, err := orderDB.PurgeIdempotencyKeys(ctx)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Printf("Удалено устаревших ключей идемпотентности: %d", purged)
+		}
+		return nil
+	})
+	// Сага становится доступна для восстановления не сразу, а после нескольких минут
+	// без движения, поэтому брошенные саги ищутся и после старта
+	go runEvery(ctx, time.Minute, orderSaga.Recover)
 
 	// Создаем новый gRPC сервер
 	grpcServer := grpc.NewServer()
 
 	// Регистрируем обработчик
-	orderHandler := handler.NewOrderHandler(orderDB)
+	orderHandler := handler.NewOrderHandler(orderDB, catalogClient)
 	proto.RegisterOrderServiceServer(grpcServer, orderHandler)
 
+	// Изменения статусов, сделанные другими репликами, приходят через LISTEN/NOTIFY
+	go watch.NewListener(conn, orderDB, orderHandler.Watchers(), 5*time.Second).Run(ctx)
+
 	// Включаем Reflection
 	reflection.Register(grpcServer)
 
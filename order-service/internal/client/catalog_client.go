@@ -3,15 +3,33 @@ package client
 import (
 	"context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"log"
+	"store/money"
 	"store/proto"
+	"time"
 )
 
+//go:generate mockgen -source=catalog_client.go -destination=mock/mock.go -package mock
+
 // CatalogClient интерфейс для взаимодействия с catalog-service
 type CatalogClient interface {
-	UpdateProductStock(productID int32, newStockQuantity int32) error
+	ReserveStock(productID int32, quantity int32) error
+	// ReleaseStock возвращает товар заказа orderID на склад
+	ReleaseStock(orderID, productID, warehouseID int32, quantity int32, operationID string) error
+	// CreateReservation резервирует позиции заказа orderID на складах, выбранных по allocation.
+	// Возвращает ID резерва и склад каждой позиции по ID товара
+	CreateReservation(orderID int32, items []*proto.OrderItem, allocation *proto.Allocation, ttl time.Duration) (int32, map[int32]int32, error)
+	CommitReservation(reservationID int32) error
+	CancelReservation(reservationID int32) error
 	Close()
-	GetProductByID(productID int32) (string, int, float64, error)
+	GetProductByID(productID int32) (string, int, *proto.Money, error)
+	// GetProductsByIDs получает товары одним вызовом. Возвращает найденные товары по ID
+	// и ID, которых нет в каталоге
+	GetProductsByIDs(productIDs []int32) (map[int32]*proto.Product, []int32, error)
+	// GetProductsBySKUs получает варианты товаров по артикулам одним вызовом.
+	// Возвращает найденные товары по артикулу и артикулы, которых нет в каталоге
+	GetProductsBySKUs(skus []string) (map[string]*proto.Product, []string, error)
 }
 
 // CatalogClientImpl реализует интерфейс CatalogClient
@@ -20,6 +38,14 @@ type CatalogClientImpl struct {
 	client proto.ProductServiceClient
 }
 
+// stockActor инициатор изменений остатка в журнале движений catalog-service
+const stockActor = "order-service"
+
+// stockContext контекст вызова, меняющего остаток: инициатор передается в метаданных x-actor
+func stockContext() context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "x-actor", stockActor)
+}
+
 // NewCatalogClient создает новый экземпляр CatalogClient
 func NewCatalogClient(address string) (CatalogClient, error) {
 	conn, err := grpc.Dial(address, grpc.WithInsecure()) // Устанавливаем соединение
@@ -37,29 +63,145 @@ func (c *CatalogClientImpl) Close() {
 	}
 }
 
-// UpdateProductStock обновляет количество товара в каталоге через gRPC
-func (c *CatalogClientImpl) UpdateProductStock(productID int32, newStockQuantity int32) error {
-	req := &proto.UpdateProductRequest{
-		ProductId:     productID,
-		StockQuantity: newStockQuantity,
+// ReserveStock списывает quantity единиц товара в каталоге через gRPC.
+// Если товара не хватает, catalog-service возвращает FailedPrecondition
+func (c *CatalogClientImpl) ReserveStock(productID int32, quantity int32) error {
+	req := &proto.ReserveStockRequest{
+		ProductId: productID,
+		Quantity:  quantity,
+	}
+	_, err := c.client.ReserveStock(stockContext(), req)
+	if err != nil {
+		log.Printf("Failed to reserve product stock: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ReleaseStock возвращает quantity единиц товара на склад warehouseID через gRPC
+// (0 - склад по умолчанию). Повторный вызов с тем же operationID не меняет остаток
+func (c *CatalogClientImpl) ReleaseStock(orderID, productID, warehouseID int32, quantity int32, operationID string) error {
+	req := &proto.ReleaseStockRequest{
+		ProductId:   productID,
+		WarehouseId: warehouseID,
+		Quantity:    quantity,
+		OperationId: operationID,
+		OrderId:     orderID,
+	}
+	_, err := c.client.ReleaseStock(stockContext(), req)
+	if err != nil {
+		log.Printf("Failed to release product stock: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CreateReservation резервирует все позиции заказа одним вызовом.
+// Если резерв не подтвердить за ttl, catalog-service снимет его сам
+func (c *CatalogClientImpl) CreateReservation(orderID int32, items []*proto.OrderItem, allocation *proto.Allocation, ttl time.Duration) (int32, map[int32]int32, error) {
+	req := &proto.CreateReservationRequest{
+		TtlSeconds: int32(ttl / time.Second),
+		Allocation: allocation,
+		OrderId:    orderID,
+	}
+	for _, item := range items {
+		req.Items = append(req.Items, &proto.ReservationItem{
+			ProductId: item.ProductId,
+			Quantity:  item.Quantity,
+		})
 	}
-	_, err := c.client.UpdateProduct(context.Background(), req) // Вызываем метод catalog-service
+	res, err := c.client.CreateReservation(stockContext(), req)
 	if err != nil {
-		log.Printf("Failed to update product stock: %v", err)
+		log.Printf("Failed to create reservation: %v", err)
+		return 0, nil, err
+	}
+	warehouses := make(map[int32]int32, len(res.Items))
+	for _, item := range res.Items {
+		warehouses[item.ProductId] = item.WarehouseId
+	}
+	return res.ReservationId, warehouses, nil
+}
+
+// CommitReservation подтверждает резерв
+func (c *CatalogClientImpl) CommitReservation(reservationID int32) error {
+	req := &proto.CommitReservationRequest{
+		ReservationId: reservationID,
+	}
+	_, err := c.client.CommitReservation(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to commit reservation: %v", err)
+		return err
+	}
+	return nil
+}
+
+// CancelReservation отменяет резерв и возвращает товар на склад
+func (c *CatalogClientImpl) CancelReservation(reservationID int32) error {
+	req := &proto.CancelReservationRequest{
+		ReservationId: reservationID,
+	}
+	_, err := c.client.CancelReservation(stockContext(), req)
+	if err != nil {
+		log.Printf("Failed to cancel reservation: %v", err)
 		return err
 	}
 	return nil
 }
 
 // GetProductByID получает информацию о продукте по его ID через gRPC
-func (c *CatalogClientImpl) GetProductByID(productID int32) (string, int, float64, error) {
-    req := &proto.GetProductByIDRequest{
-        ProductId: productID,
-    }
-    res, err := c.client.GetProductByID(context.Background(), req)
-    if err != nil {
-        log.Printf("Failed to get product by ID: %v", err)
-        return "", 0, 0.0, err
-    }
-    return res.Product.ProductName, int(res.Product.StockQuantity), res.Product.PricePerUnit,  nil
-}
\ No newline at end of file
+func (c *CatalogClientImpl) GetProductByID(productID int32) (string, int, *proto.Money, error) {
+	req := &proto.GetProductByIDRequest{
+		ProductId: productID,
+	}
+	res, err := c.client.GetProductByID(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to get product by ID: %v", err)
+		return "", 0, nil, err
+	}
+	// Каталог без поля price (до перехода на Money) отдает только устаревший double
+	price := res.Product.Price
+	if price == nil {
+		price = money.FromFloat(res.Product.PricePerUnit, money.DefaultCurrency)
+	}
+	return res.Product.ProductName, int(res.Product.StockQuantity), price, nil
+}
+
+// GetProductsByIDs получает несколько продуктов одним вызовом через gRPC
+func (c *CatalogClientImpl) GetProductsByIDs(productIDs []int32) (map[int32]*proto.Product, []int32, error) {
+	req := &proto.GetProductsByIDsRequest{
+		ProductIds: productIDs,
+	}
+	res, err := c.client.GetProductsByIDs(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to get products by IDs: %v", err)
+		return nil, nil, err
+	}
+
+	products := make(map[int32]*proto.Product, len(res.Products))
+	for _, product := range res.Products {
+		// Каталог без поля price (до перехода на Money) отдает только устаревший double
+		if product.Price == nil {
+			product.Price = money.FromFloat(product.PricePerUnit, money.DefaultCurrency)
+		}
+		products[product.ProductId] = product
+	}
+	return products, res.MissingProductIds, nil
+}
+
+// GetProductsBySKUs получает товары по артикулам одним вызовом через gRPC
+func (c *CatalogClientImpl) GetProductsBySKUs(skus []string) (map[string]*proto.Product, []string, error) {
+	req := &proto.GetProductsByIDsRequest{
+		Skus: skus,
+	}
+	res, err := c.client.GetProductsByIDs(context.Background(), req)
+	if err != nil {
+		log.Printf("Failed to get products by SKUs: %v", err)
+		return nil, nil, err
+	}
+
+	products := make(map[string]*proto.Product, len(res.Products))
+	for _, product := range res.Products {
+		products[product.Sku] = product
+	}
+	return products, res.MissingSkus, nil
+}
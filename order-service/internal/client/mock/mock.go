@@ -0,0 +1,175 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: catalog_client.go
+//
+// Generated by this command:
+//
+//	mockgen -source=catalog_client.go -destination=mock/mock.go -package mock
+//
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	reflect "reflect"
+	proto "store/proto"
+	time "time"
+
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockCatalogClient is a mock of CatalogClient interface.
+type MockCatalogClient struct {
+	ctrl     *gomock.Controller
+	recorder *MockCatalogClientMockRecorder
+	isgomock struct{}
+}
+
+// MockCatalogClientMockRecorder is the mock recorder for MockCatalogClient.
+type MockCatalogClientMockRecorder struct {
+	mock *MockCatalogClient
+}
+
+// NewMockCatalogClient creates a new mock instance.
+func NewMockCatalogClient(ctrl *gomock.Controller) *MockCatalogClient {
+	mock := &MockCatalogClient{ctrl: ctrl}
+	mock.recorder = &MockCatalogClientMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCatalogClient) EXPECT() *MockCatalogClientMockRecorder {
+	return m.recorder
+}
+
+// CancelReservation mocks base method.
+func (m *MockCatalogClient) CancelReservation(reservationID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelReservation", reservationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelReservation indicates an expected call of CancelReservation.
+func (mr *MockCatalogClientMockRecorder) CancelReservation(reservationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelReservation", reflect.TypeOf((*MockCatalogClient)(nil).CancelReservation), reservationID)
+}
+
+// Close mocks base method.
+func (m *MockCatalogClient) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockCatalogClientMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockCatalogClient)(nil).Close))
+}
+
+// CommitReservation mocks base method.
+func (m *MockCatalogClient) CommitReservation(reservationID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CommitReservation", reservationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommitReservation indicates an expected call of CommitReservation.
+func (mr *MockCatalogClientMockRecorder) CommitReservation(reservationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitReservation", reflect.TypeOf((*MockCatalogClient)(nil).CommitReservation), reservationID)
+}
+
+// CreateReservation mocks base method.
+func (m *MockCatalogClient) CreateReservation(orderID int32, items []*proto.OrderItem, allocation *proto.Allocation, ttl time.Duration) (int32, map[int32]int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReservation", orderID, items, allocation, ttl)
+	ret0, _ := ret[0].(int32)
+	ret1, _ := ret[1].(map[int32]int32)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreateReservation indicates an expected call of CreateReservation.
+func (mr *MockCatalogClientMockRecorder) CreateReservation(orderID, items, allocation, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*MockCatalogClient)(nil).CreateReservation), orderID, items, allocation, ttl)
+}
+
+// GetProductByID mocks base method.
+func (m *MockCatalogClient) GetProductByID(productID int32) (string, int, *proto.Money, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductByID", productID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(*proto.Money)
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// GetProductByID indicates an expected call of GetProductByID.
+func (mr *MockCatalogClientMockRecorder) GetProductByID(productID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductByID", reflect.TypeOf((*MockCatalogClient)(nil).GetProductByID), productID)
+}
+
+// GetProductsByIDs mocks base method.
+func (m *MockCatalogClient) GetProductsByIDs(productIDs []int32) (map[int32]*proto.Product, []int32, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductsByIDs", productIDs)
+	ret0, _ := ret[0].(map[int32]*proto.Product)
+	ret1, _ := ret[1].([]int32)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetProductsByIDs indicates an expected call of GetProductsByIDs.
+func (mr *MockCatalogClientMockRecorder) GetProductsByIDs(productIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductsByIDs", reflect.TypeOf((*MockCatalogClient)(nil).GetProductsByIDs), productIDs)
+}
+
+// GetProductsBySKUs mocks base method.
+func (m *MockCatalogClient) GetProductsBySKUs(skus []string) (map[string]*proto.Product, []string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProductsBySKUs", skus)
+	ret0, _ := ret[0].(map[string]*proto.Product)
+	ret1, _ := ret[1].([]string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetProductsBySKUs indicates an expected call of GetProductsBySKUs.
+func (mr *MockCatalogClientMockRecorder) GetProductsBySKUs(skus any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductsBySKUs", reflect.TypeOf((*MockCatalogClient)(nil).GetProductsBySKUs), skus)
+}
+
+// ReleaseStock mocks base method.
+func (m *MockCatalogClient) ReleaseStock(orderID, productID, warehouseID, quantity int32, operationID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseStock", orderID, productID, warehouseID, quantity, operationID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseStock indicates an expected call of ReleaseStock.
+func (mr *MockCatalogClientMockRecorder) ReleaseStock(orderID, productID, warehouseID, quantity, operationID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseStock", reflect.TypeOf((*MockCatalogClient)(nil).ReleaseStock), orderID, productID, warehouseID, quantity, operationID)
+}
+
+// ReserveStock mocks base method.
+func (m *MockCatalogClient) ReserveStock(productID, quantity int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveStock", productID, quantity)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReserveStock indicates an expected call of ReserveStock.
+func (mr *MockCatalogClientMockRecorder) ReserveStock(productID, quantity any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveStock", reflect.TypeOf((*MockCatalogClient)(nil).ReserveStock), productID, quantity)
+}
@@ -6,85 +6,96 @@ import (
 	"errors"
 	"fmt"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
 	"log"
+	"store/idempotency"
 	"store/order-service/internal/client"
+	"store/order-service/internal/orderstatus"
 	db "store/order-service/internal/repository" // Импорт пакета db
+	"store/order-service/internal/saga"
+	"store/order-service/internal/watch"
 	"store/proto"
 )
 
+// watchBuffer сколько непрочитанных состояний заказа хранится для каждого подписчика WatchOrder
+const watchBuffer = 16
+
 type OrderHandler struct {
 	proto.UnimplementedOrderServiceServer
-	db db.OrderDB // Поле для работы с базой данных
+	db          db.OrderDB // Поле для работы с базой данных
+	catalog     client.CatalogClient
+	createOrder *saga.CreateOrderSaga
+	watchers    *watch.Broadcaster
+}
+
+func NewOrderHandler(db db.OrderDB, catalogClient client.CatalogClient) *OrderHandler {
+	return &OrderHandler{
+		db:          db,
+		catalog:     catalogClient,
+		createOrder: saga.NewCreateOrderSaga(db, catalogClient),
+		watchers:    watch.NewBroadcaster(watchBuffer),
+	}
 }
 
-func NewOrderHandler(db db.OrderDB) *OrderHandler {
-	return &OrderHandler{db: db}
+// Watchers возвращает рассыльщик изменений заказов для подписчиков WatchOrder.
+// Через него же доставляются изменения, сделанные другими репликами (watch.Listener)
+func (h *OrderHandler) Watchers() *watch.Broadcaster {
+	return h.watchers
 }
 
 // CreateOrder обрабатывает создание нового заказа
 func (h *OrderHandler) CreateOrder(ctx context.Context, req *proto.CreateOrderRequest) (*proto.CreateOrderResponse, error) {
 	log.Printf("Получен запрос CreateOrder для customer_id: %d", req.CustomerId)
 
-	// Генерируем новый OrderID
-	var orderID int32
-	err := h.db.GetNextOrderID(ctx, &orderID)
-	if err != nil {
-		log.Printf("Ошибка при генерации OrderID: %v", err)
-		return nil, err
+	if len(req.Items) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Заказ должен содержать хотя бы один товар")
 	}
-
-	// Создаем gRPC-клиент для catalog-service
-	catalogClient, err := client.NewCatalogClient("localhost:50051") // Укажите адрес catalog-service
-	if err != nil {
-		log.Printf("Ошибка при создании gRPC-клиента для catalog-service: %v", err)
-		return nil, err
-	}
-	defer catalogClient.Close()
-
-	// Обрабатываем каждый товар в заказе
 	for _, item := range req.Items {
-		// Получаем информацию о товаре, включая цену
-		_, stockQuantity, pricePerUnit, err := catalogClient.GetProductByID(item.ProductId)
-		if err != nil {
-			log.Printf("Ошибка при получении товара: %v", err)
-			return nil, err
-		}
-
-		// Проверяем наличие товара в достаточном количестве
-		if stockQuantity < int(item.Quantity) {
-			log.Printf("Недостаточно товара в наличии для product_id: %d", item.ProductId)
-			return nil, fmt.Errorf(" Not enough stock for the product")
+		if item.ProductId <= 0 && item.Sku == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "Для каждой позиции укажите product_id или sku")
 		}
+	}
 
-		// Создаем запись в таблице Orders
-		err = h.db.CreateOrder(
-			ctx,
-			orderID,
-			item.ProductId, 
-			req.CustomerId, 
-			item.Quantity, 
-			pricePerUnit,
-		)
-		if err != nil {
-			log.Printf("Ошибка при создании заказа: %v", err)
-			return nil, err
+	// Повтор запроса с тем же ключом возвращает уже созданный заказ
+	key := idempotency.Key(ctx, req.IdempotencyKey)
+	var hash string
+	if key != "" {
+		payload := protobuf.Clone(req).(*proto.CreateOrderRequest)
+		payload.IdempotencyKey = ""
+		var err error
+		if hash, err = idempotency.RequestHash(payload); err != nil {
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
 		}
 
-		// Обновляем количество товара в каталоге через gRPC
-		newStockQuantity := stockQuantity - int(item.Quantity)
-		err = catalogClient.UpdateProductStock(item.ProductId, int32(newStockQuantity))
-		if err != nil {
-			log.Printf("Ошибка при обновлении количества товара: %v", err)
-			return nil, err
+		record, err := h.db.GetIdempotencyKey(ctx, key)
+		switch {
+		case errors.Is(err, db.ErrIdempotencyKeyNotFound):
+			// Ключ новый, создаем заказ
+		case err != nil:
+			log.Printf("Ошибка при проверке ключа идемпотентности: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		case record.RequestHash != hash:
+			return nil, status.Errorf(codes.InvalidArgument, "Ключ идемпотентности уже использован с другими параметрами запроса")
+		case record.SagaStatus == db.SagaCompleted:
+			log.Printf("Повтор CreateOrder с ключом %q, возвращаем заказ %d", key, record.OrderID)
+			return &proto.CreateOrderResponse{OrderId: record.OrderID}, nil
+		case record.SagaStatus != db.SagaCompensated:
+			// Исходный запрос еще выполняется; откатившуюся сагу можно повторить
+			return nil, status.Errorf(codes.Aborted, "Заказ с этим ключом еще создается, повторите запрос позже")
 		}
+	}
 
-		log.Printf(
-			"Добавлен товар в заказ: OrderID=%d, ProductID=%d, Quantity=%d", 
-			orderID, 
-			item.ProductId, 
-			item.Quantity,
-		)
+	// Создаем заказ через сагу: при ошибке на любом шаге
+	// резерв товара и записанные строки заказа откатываются
+	orderID, err := h.createOrder.Execute(ctx, req.CustomerId, req.Items, req.Allocation, key, hash)
+	if errors.Is(err, db.ErrIdempotencyKeyInUse) {
+		return nil, status.Errorf(codes.Aborted, "Заказ с этим ключом еще создается, повторите запрос позже")
+	}
+	if err != nil {
+		log.Printf("Ошибка при создании заказа: %v", err)
+		return nil, err
 	}
 
 	log.Printf("Создан заказ с OrderID: %d", orderID)
@@ -102,7 +113,7 @@ func (h *OrderHandler) GetOrderByID(ctx context.Context, req *proto.GetOrderByID
 	// Получаем заказ из базы данных
 	order, err := h.db.GetOrderByID(req.OrderId)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, db.ErrOrderNotFound) || errors.Is(err, sql.ErrNoRows) {
 			// Возвращаем gRPC-ошибку с кодом NotFound
 			return nil, status.Errorf(codes.NotFound, "Заказ не найден")
 		}
@@ -114,32 +125,95 @@ func (h *OrderHandler) GetOrderByID(ctx context.Context, req *proto.GetOrderByID
 	return &proto.GetOrderByIDResponse{Order: order}, nil
 }
 
-// GetAllOrders обрабатывает запрос на получение всех заказов
+// GetAllOrders обрабатывает запрос на получение страницы заказов
 func (h *OrderHandler) GetAllOrders(ctx context.Context, req *proto.GetAllOrdersRequest) (*proto.GetAllOrdersResponse, error) {
 	log.Println("Получен запрос GetAllOrders")
 
-	// Получаем все заказы из базы данных
-	orders, err := h.db.GetAllOrders()
+	filter, err := orderFilter(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Получаем страницу заказов из базы данных
+	orders, next, err := h.db.GetAllOrders(ctx, filter)
 	if err != nil {
 		log.Printf("Ошибка при получении заказов: %v", err)
 		return nil, err
 	}
 
+	var nextPageToken string
+	if next != nil {
+		if nextPageToken, err = encodePageToken(req, next); err != nil {
+			log.Printf("Ошибка при формировании токена страницы: %v", err)
+			return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+	}
+
 	// Возвращаем ответ
 	return &proto.GetAllOrdersResponse{
-		Orders: orders,
+		Orders:        orders,
+		NextPageToken: nextPageToken,
 	}, nil
 }
 
 func (h *OrderHandler) UpdateOrder(ctx context.Context, req *proto.UpdateOrderRequest) (*proto.UpdateOrderResponse, error) {
 	log.Printf("Получен запрос UpdateOrder для order_id: %d", req.OrderId)
 
-	// Обновляем информацию о заказе
-	err := h.db.UpdateOrder(req.OrderId, req.Status)
+	// Новый статус берем из enum, а для старых клиентов - из строки
+	target := req.NewStatus
+	if target == proto.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		parsed, ok := orderstatus.Parse(req.Status)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "Неизвестный статус заказа: %q", req.Status)
+		}
+		target = parsed
+	}
+
+	// Получаем текущий статус заказа
+	order, err := h.db.GetOrderByID(req.OrderId)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Заказ не найден")
+	}
 	if err != nil {
+		log.Printf("Ошибка при получении заказа: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	current, ok := orderstatus.Parse(order.Status)
+	if !ok {
+		log.Printf("Заказ %d в неизвестном статусе %q", req.OrderId, order.Status)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	// Отмена всегда идет через CancelOrder, чтобы товар вернулся на склад
+	if target == proto.OrderStatus_ORDER_STATUS_CANCELLED {
+		if err := h.cancelOrder(order, current, "", actorFromRequest(ctx, req.Actor)); err != nil {
+			return nil, err
+		}
+		return &proto.UpdateOrderResponse{Success: true}, nil
+	}
+
+	// Проверяем переход по таблице допустимых переходов
+	if !orderstatus.CanTransition(current, target) {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"Недопустимый переход статуса заказа: %s -> %s",
+			orderstatus.Code(current),
+			orderstatus.Code(target),
+		)
+	}
+
+	// Обновляем информацию о заказе
+	err = h.db.UpdateOrder(req.OrderId, orderstatus.Code(current), orderstatus.Code(target), actorFromRequest(ctx, req.Actor))
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		return nil, status.Errorf(codes.NotFound, "Заказ не найден")
+	case errors.Is(err, db.ErrStatusConflict):
+		return nil, status.Errorf(codes.Aborted, "Статус заказа изменился, повторите запрос")
+	case err != nil:
 		log.Printf("Ошибка при обновлении заказа: %v", err)
 		return nil, err
 	}
+	h.publishStatus(order, target, "")
 
 	// Возвращаем успешный ответ
 	return &proto.UpdateOrderResponse{
@@ -147,13 +221,155 @@ func (h *OrderHandler) UpdateOrder(ctx context.Context, req *proto.UpdateOrderRe
 	}, nil
 }
 
-// DeleteOrder обрабатывает запрос на удаление заказа
+// publishStatus сообщает подписчикам WatchOrder новое состояние заказа.
+// Исходный заказ не меняется: подписчики получают копию
+func (h *OrderHandler) publishStatus(order *proto.Order, newStatus proto.OrderStatus, reason string) {
+	updated := protobuf.Clone(order).(*proto.Order)
+	updated.Status = orderstatus.Code(newStatus)
+	updated.OrderStatus = newStatus
+	updated.CancellationReason = reason
+	h.watchers.Publish(updated)
+}
+
+// WatchOrder отправляет текущее состояние заказа, а затем каждое изменение статуса.
+// Поток завершается, когда заказ доставлен или отменен, либо когда клиент отключился
+func (h *OrderHandler) WatchOrder(req *proto.WatchOrderRequest, stream proto.OrderService_WatchOrderServer) error {
+	log.Printf("Получен запрос WatchOrder для order_id: %d", req.OrderId)
+
+	// Подписываемся до чтения заказа, чтобы не пропустить изменение между ними
+	updates, unsubscribe := h.watchers.Subscribe(req.OrderId)
+	defer unsubscribe()
+
+	order, err := h.db.GetOrderByID(req.OrderId)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		return status.Errorf(codes.NotFound, "Заказ не найден")
+	}
+	if err != nil {
+		log.Printf("Ошибка при получении заказа: %v", err)
+		return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	var last string
+	for {
+		// Одно изменение может прийти дважды: от своей реплики и через LISTEN/NOTIFY
+		if order.Status != last {
+			if err := stream.Send(&proto.WatchOrderResponse{Order: order}); err != nil {
+				return err
+			}
+			last = order.Status
+		}
+		if orderstatus.IsFinal(order.OrderStatus) {
+			return nil
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case order = <-updates:
+		}
+	}
+}
+
+// actorFromRequest определяет, кто выполняет действие: поле запроса,
+// затем метаданные x-actor, иначе "unknown"
+func actorFromRequest(ctx context.Context, actor string) string {
+	if actor != "" {
+		return actor
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-actor"); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return "unknown"
+}
+
+// CancelOrder отменяет заказ и возвращает товар на склад.
+// Повторный вызов для уже отмененного заказа безопасен: товар вернется только один раз
+func (h *OrderHandler) CancelOrder(ctx context.Context, req *proto.CancelOrderRequest) (*proto.CancelOrderResponse, error) {
+	log.Printf("Получен запрос CancelOrder для order_id: %d", req.OrderId)
+
+	order, err := h.db.GetOrderByID(req.OrderId)
+	if errors.Is(err, db.ErrOrderNotFound) {
+		return nil, status.Errorf(codes.NotFound, "Заказ не найден")
+	}
+	if err != nil {
+		log.Printf("Ошибка при получении заказа: %v", err)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	current, ok := orderstatus.Parse(order.Status)
+	if !ok {
+		log.Printf("Заказ %d в неизвестном статусе %q", req.OrderId, order.Status)
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+
+	if err := h.cancelOrder(order, current, req.Reason, actorFromRequest(ctx, req.Actor)); err != nil {
+		return nil, err
+	}
+
+	return &proto.CancelOrderResponse{
+		Success: true,
+	}, nil
+}
+
+// cancelOrder переводит заказ в cancelled и возвращает товар на склад.
+// Каждая позиция возвращается с ключом операции, поэтому при повторе
+// (в том числе после частичного сбоя) товар не будет возвращен дважды.
+// Ключ строится по заказу и товару: он уникален, пока в заказе одна позиция
+// на товар. Это гарантируют сага создания заказа, которая отклоняет повторы
+// товара, и первичный ключ (OrderID, ProductID) строк заказа
+func (h *OrderHandler) cancelOrder(order *proto.Order, current proto.OrderStatus, reason string, actor string) error {
+	if current != proto.OrderStatus_ORDER_STATUS_CANCELLED {
+		if !orderstatus.CanTransition(current, proto.OrderStatus_ORDER_STATUS_CANCELLED) {
+			return status.Errorf(codes.FailedPrecondition, "Заказ в статусе %s нельзя отменить", orderstatus.Code(current))
+		}
+
+		err := h.db.CancelOrder(order.OrderId, orderstatus.Code(current), reason, actor)
+		switch {
+		case errors.Is(err, db.ErrOrderNotFound):
+			return status.Errorf(codes.NotFound, "Заказ не найден")
+		case errors.Is(err, db.ErrStatusConflict):
+			return status.Errorf(codes.Aborted, "Статус заказа изменился, повторите запрос")
+		case err != nil:
+			log.Printf("Ошибка при отмене заказа: %v", err)
+			return status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+		}
+		h.publishStatus(order, proto.OrderStatus_ORDER_STATUS_CANCELLED, reason)
+	}
+
+	for _, item := range order.Items {
+		operationID := fmt.Sprintf("order-%d-cancel-%d", order.OrderId, item.ProductId)
+		// Товар возвращается на склад, с которого был зарезервирован
+		if err := h.catalog.ReleaseStock(order.OrderId, item.ProductId, item.WarehouseId, item.Quantity, operationID); err != nil {
+			// Заказ уже отменен; повторный CancelOrder вернет оставшиеся позиции
+			log.Printf("Ошибка при возврате товара %d на склад: %v", item.ProductId, err)
+			return status.Errorf(codes.Unavailable, "Заказ отменен, но товар не возвращен на склад, повторите запрос")
+		}
+	}
+
+	log.Printf("Заказ %d отменен (%s): %s", order.OrderId, actor, reason)
+	return nil
+}
+
+// DeleteOrder безвозвратно удаляет заказ. Доступно только администратору
+// (метаданные x-role: admin) и только для отмененных заказов.
+// Роль передает сам клиент и сервис ее не проверяет: это защита от случайного
+// вызова, а не граница безопасности. Доступ к RPC нужно ограничивать снаружи
 func (h *OrderHandler) DeleteOrder(ctx context.Context, req *proto.DeleteOrderRequest) (*proto.DeleteOrderResponse, error) {
 	log.Printf("Получен запрос DeleteOrder для order_id: %d", req.OrderId)
 
+	if !isAdmin(ctx) {
+		return nil, status.Errorf(codes.PermissionDenied, "Удалять заказы может только администратор")
+	}
+
 	// Удаляем заказ из базы данных
 	err := h.db.DeleteOrder(req.OrderId)
-	if err != nil {
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		return nil, status.Errorf(codes.NotFound, "Заказ не найден")
+	case errors.Is(err, db.ErrOrderNotCancelled):
+		return nil, status.Errorf(codes.FailedPrecondition, "Удалить можно только отмененный заказ, используйте CancelOrder")
+	case err != nil:
 		log.Printf("Ошибка при удалении заказа: %v", err)
 		return nil, err
 	}
@@ -163,3 +379,18 @@ func (h *OrderHandler) DeleteOrder(ctx context.Context, req *proto.DeleteOrderRe
 		Success: true,
 	}, nil
 }
+
+// isAdmin проверяет роль вызывающего из метаданных x-role.
+// Значение не подтверждено учетными данными и может быть подделано клиентом
+func isAdmin(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, role := range md.Get("x-role") {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
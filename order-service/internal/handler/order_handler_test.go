@@ -3,13 +3,20 @@ package handler
 import (
 	"context"
 	"database/sql"
-	// "errors"
+	"errors"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
+	"store/idempotency"
+	"store/money"
+	clientmock "store/order-service/internal/client/mock"
+	db "store/order-service/internal/repository"
 	mock "store/order-service/internal/repository/mock"
 	"store/proto"
 )
@@ -113,7 +120,7 @@ func TestGetOrderByID_Success(t *testing.T) {
 	mockDB := mock.NewMockOrderDB(ctrl)
 
 	// Create the OrderHandler with the mock
-	handler := NewOrderHandler(mockDB)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
 
 	// Define test data
 	orderID := int32(2)
@@ -154,7 +161,7 @@ func TestGetOrderByID_NotFound(t *testing.T) {
 	mockDB := mock.NewMockOrderDB(ctrl)
 
 	// Создаем OrderHandler с моком
-	handler := NewOrderHandler(mockDB)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
 
 	// Определяем тестовые данные
 	orderID := int32(1)
@@ -181,30 +188,448 @@ func TestGetOrderByID_NotFound(t *testing.T) {
 	assert.Equal(t, codes.NotFound, status.Code())
 }
 
+func TestGetOrderByID_OrderNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().
+		GetOrderByID(int32(1)).
+		Return(nil, db.ErrOrderNotFound)
+
+	resp, err := handler.GetOrderByID(context.Background(), &proto.GetOrderByIDRequest{OrderId: 1})
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGetAllOrders_FiltersAndPagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	filter := db.OrderFilter{
+		CustomerID: 7,
+		Statuses:   []string{"pending", "paid"},
+		From:       time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:         time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		PageSize:   1,
+	}
+	firstPage := []*proto.Order{{OrderId: 12, CustomerId: 7}}
+	cursor := &db.OrderCursor{OrderDate: time.Date(2025, 1, 20, 10, 30, 0, 123456000, time.UTC), OrderID: 12}
+
+	mockDB.EXPECT().GetAllOrders(gomock.Any(), filter).Return(firstPage, cursor, nil)
+
+	req := &proto.GetAllOrdersRequest{
+		PageSize:   1,
+		CustomerId: 7,
+		Statuses:   []proto.OrderStatus{proto.OrderStatus_ORDER_STATUS_PENDING, proto.OrderStatus_ORDER_STATUS_PAID},
+		FromDate:   "2025-01-01T03:00:00+03:00",
+		ToDate:     "2025-02-01T00:00:00Z",
+	}
+	resp, err := handler.GetAllOrders(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, firstPage, resp.Orders)
+	assert.NotEmpty(t, resp.NextPageToken)
+
+	// Вторая страница продолжается после последнего заказа первой с точностью до микросекунд
+	filter.After = cursor
+	mockDB.EXPECT().GetAllOrders(gomock.Any(), filter).Return(nil, nil, nil)
+
+	req.PageToken = resp.NextPageToken
+	resp, err = handler.GetAllOrders(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.NextPageToken)
+
+	// Токен нельзя применить к другому клиенту
+	req.CustomerId = 8
+	resp, err = handler.GetAllOrders(context.Background(), req)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGetAllOrders_InvalidArguments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	requests := []*proto.GetAllOrdersRequest{
+		{PageSize: -1},
+		{Statuses: []proto.OrderStatus{proto.OrderStatus_ORDER_STATUS_UNSPECIFIED}},
+		{FromDate: "вчера"},
+		{FromDate: "2025-02-01T00:00:00Z", ToDate: "2025-01-01T00:00:00Z"},
+		{PageToken: "not-a-token"},
+	}
+	for _, req := range requests {
+		resp, err := handler.GetAllOrders(context.Background(), req)
+		assert.Nil(t, resp)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", req)
+	}
+}
+
 func TestUpdateOrder_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockDB := mock.NewMockOrderDB(ctrl)
-	handler := NewOrderHandler(mockDB)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
 
 	orderID := int32(1)
-	status := "new_status"
 
 	mockDB.EXPECT().
-		UpdateOrder(orderID, status).
+		GetOrderByID(orderID).
+		Return(&proto.Order{OrderId: orderID, Status: "pending"}, nil)
+	mockDB.EXPECT().
+		UpdateOrder(orderID, "pending", "paid", "manager:7").
 		Return(nil)
 
+	req := &proto.UpdateOrderRequest{
+		OrderId:   orderID,
+		NewStatus: proto.OrderStatus_ORDER_STATUS_PAID,
+		Actor:     "manager:7",
+	}
+	resp, err := handler.UpdateOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestUpdateOrder_LegacyStatusAndMetadataActor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	orderID := int32(1)
+
+	mockDB.EXPECT().
+		GetOrderByID(orderID).
+		Return(&proto.Order{OrderId: orderID, Status: "shipped"}, nil)
+	mockDB.EXPECT().
+		UpdateOrder(orderID, "shipped", "delivered", "courier").
+		Return(nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-actor", "courier"))
 	req := &proto.UpdateOrderRequest{
 		OrderId: orderID,
-		Status:  status,
+		Status:  "Выполнен",
+	}
+	resp, err := handler.UpdateOrder(ctx, req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestUpdateOrder_IllegalTransition(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	orderID := int32(1)
+
+	// Доставленный заказ нельзя вернуть в обработку
+	mockDB.EXPECT().
+		GetOrderByID(orderID).
+		Return(&proto.Order{OrderId: orderID, Status: "delivered"}, nil)
+
+	req := &proto.UpdateOrderRequest{
+		OrderId:   orderID,
+		NewStatus: proto.OrderStatus_ORDER_STATUS_PENDING,
 	}
 	resp, err := handler.UpdateOrder(context.Background(), req)
 
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestUpdateOrder_UnknownStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	req := &proto.UpdateOrderRequest{
+		OrderId: 1,
+		Status:  "new_status",
+	}
+	resp, err := handler.UpdateOrder(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestUpdateOrder_Conflict(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().
+		GetOrderByID(int32(1)).
+		Return(&proto.Order{OrderId: 1, Status: "paid"}, nil)
+	mockDB.EXPECT().
+		UpdateOrder(int32(1), "paid", "shipped", "unknown").
+		Return(db.ErrStatusConflict)
+
+	req := &proto.UpdateOrderRequest{
+		OrderId:   1,
+		NewStatus: proto.OrderStatus_ORDER_STATUS_SHIPPED,
+	}
+	resp, err := handler.UpdateOrder(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestCancelOrder_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	orderID := int32(3)
+	items := []*proto.OrderItem{
+		{ProductId: 10, Quantity: 2, WarehouseId: 3},
+		{ProductId: 11, Quantity: 1},
+	}
+
+	mockDB.EXPECT().
+		GetOrderByID(orderID).
+		Return(&proto.Order{OrderId: orderID, Status: "paid", Items: items}, nil)
+	mockDB.EXPECT().
+		CancelOrder(orderID, "paid", "Передумал", "customer:1").
+		Return(nil)
+	// Товар возвращается на склад, с которого был зарезервирован
+	mockClient.EXPECT().ReleaseStock(int32(3), int32(10), int32(3), int32(2), "order-3-cancel-10").Return(nil)
+	mockClient.EXPECT().ReleaseStock(int32(3), int32(11), int32(0), int32(1), "order-3-cancel-11").Return(nil)
+
+	req := &proto.CancelOrderRequest{OrderId: orderID, Reason: "Передумал", Actor: "customer:1"}
+	resp, err := handler.CancelOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestCancelOrder_AlreadyCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	orderID := int32(3)
+
+	// Повтор после сбоя: статус не меняется, возврат повторяется с теми же ключами
+	mockDB.EXPECT().
+		GetOrderByID(orderID).
+		Return(&proto.Order{
+			OrderId: orderID,
+			Status:  "cancelled",
+			Items:   []*proto.OrderItem{{ProductId: 10, Quantity: 2}},
+		}, nil)
+	mockClient.EXPECT().ReleaseStock(int32(3), int32(10), int32(0), int32(2), "order-3-cancel-10").Return(nil)
+
+	resp, err := handler.CancelOrder(context.Background(), &proto.CancelOrderRequest{OrderId: orderID})
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestCancelOrder_Shipped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().
+		GetOrderByID(int32(3)).
+		Return(&proto.Order{OrderId: 3, Status: "shipped"}, nil)
+
+	resp, err := handler.CancelOrder(context.Background(), &proto.CancelOrderRequest{OrderId: 3})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestUpdateOrder_CancelledRestocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	mockDB.EXPECT().
+		GetOrderByID(int32(4)).
+		Return(&proto.Order{
+			OrderId: 4,
+			Status:  "pending",
+			Items:   []*proto.OrderItem{{ProductId: 10, Quantity: 1}},
+		}, nil)
+	mockDB.EXPECT().CancelOrder(int32(4), "pending", "", "unknown").Return(nil)
+	mockClient.EXPECT().ReleaseStock(int32(4), int32(10), int32(0), int32(1), "order-4-cancel-10").Return(nil)
+
+	req := &proto.UpdateOrderRequest{OrderId: 4, NewStatus: proto.OrderStatus_ORDER_STATUS_CANCELLED}
+	resp, err := handler.UpdateOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+}
+
+func TestDeleteOrder_PermissionDenied(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	resp, err := handler.DeleteOrder(context.Background(), &proto.DeleteOrderRequest{OrderId: 1})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestDeleteOrder_NotCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().DeleteOrder(int32(1)).Return(db.ErrOrderNotCancelled)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-role", "admin"))
+	resp, err := handler.DeleteOrder(ctx, &proto.DeleteOrderRequest{OrderId: 1})
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestDeleteOrder_Admin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().DeleteOrder(int32(1)).Return(nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-role", "admin"))
+	resp, err := handler.DeleteOrder(ctx, &proto.DeleteOrderRequest{OrderId: 1})
+
 	assert.NoError(t, err)
 	assert.True(t, resp.Success)
 }
 
+// watchStream тестовый поток WatchOrder, передающий отправленные сообщения в канал
+type watchStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	sent chan *proto.Order
+}
+
+func (s *watchStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchStream) Send(resp *proto.WatchOrderResponse) error {
+	s.sent <- resp.Order
+	return nil
+}
+
+func TestWatchOrder_StreamsStatusChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	orderID := int32(1)
+	pending := &proto.Order{OrderId: orderID, Status: "pending", OrderStatus: proto.OrderStatus_ORDER_STATUS_PENDING}
+	mockDB.EXPECT().GetOrderByID(orderID).Return(pending, nil).Times(2)
+	mockDB.EXPECT().UpdateOrder(orderID, "pending", "paid", "manager").Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &watchStream{ctx: ctx, sent: make(chan *proto.Order, 10)}
+	done := make(chan error, 1)
+	go func() {
+		done <- handler.WatchOrder(&proto.WatchOrderRequest{OrderId: orderID}, stream)
+	}()
+
+	// Сначала приходит текущее состояние
+	assert.Equal(t, "pending", (<-stream.sent).Status)
+
+	_, err := handler.UpdateOrder(context.Background(), &proto.UpdateOrderRequest{
+		OrderId:   orderID,
+		NewStatus: proto.OrderStatus_ORDER_STATUS_PAID,
+		Actor:     "manager",
+	})
+	assert.NoError(t, err)
+
+	paid := <-stream.sent
+	assert.Equal(t, "paid", paid.Status)
+	assert.Equal(t, proto.OrderStatus_ORDER_STATUS_PAID, paid.OrderStatus)
+	assert.Equal(t, "pending", pending.Status, "исходный заказ не должен меняться")
+
+	// Повтор того же состояния (например, через LISTEN/NOTIFY) не отправляется
+	handler.Watchers().Publish(paid)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, stream.sent)
+}
+
+func TestWatchOrder_FinalStatusClosesStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	order := &proto.Order{OrderId: 1, Status: "cancelled", OrderStatus: proto.OrderStatus_ORDER_STATUS_CANCELLED}
+	mockDB.EXPECT().GetOrderByID(int32(1)).Return(order, nil)
+
+	stream := &watchStream{ctx: context.Background(), sent: make(chan *proto.Order, 10)}
+	err := handler.WatchOrder(&proto.WatchOrderRequest{OrderId: 1}, stream)
+
+	assert.NoError(t, err)
+	assert.Equal(t, order, <-stream.sent)
+	assert.False(t, handler.Watchers().HasSubscribers(1))
+}
+
+func TestWatchOrder_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().GetOrderByID(int32(1)).Return(nil, db.ErrOrderNotFound)
+
+	stream := &watchStream{ctx: context.Background(), sent: make(chan *proto.Order, 10)}
+	err := handler.WatchOrder(&proto.WatchOrderRequest{OrderId: 1}, stream)
+
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
 // func TestDeleteOrder_Success(t *testing.T) {
 // 	ctrl := gomock.NewController(t)
 // 	defer ctrl.Finish()
@@ -436,3 +861,471 @@ func TestUpdateOrder_Success(t *testing.T) {
 // 	assert.Nil(t, resp)
 // 	assert.Contains(t, err.Error(), "Database error")
 // }
+
+// kettle товар каталога, который заказывают в тестах CreateOrder
+func kettle() *proto.Product {
+	return &proto.Product{ProductId: 2, ProductName: "Чайник", StockQuantity: 100, Price: money.New(5700, 0, "RUB")}
+}
+
+// expectSagaStart мокирует генерацию OrderID, получение цены и сохранение саги
+func expectSagaStart(mockDB *mock.MockOrderDB, mockClient *clientmock.MockCatalogClient, orderID int32) {
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id *int32) error {
+			*id = orderID
+			return nil
+		})
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{2}).
+		Return(map[int32]*proto.Product{2: kettle()}, nil, nil)
+	mockDB.EXPECT().
+		CreateSaga(gomock.Any(), gomock.Any()).
+		Return(nil)
+}
+
+func TestCreateOrder_Success(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 2}}
+	expectSagaStart(mockDB, mockClient, 5)
+
+	mockClient.EXPECT().
+		CreateReservation(int32(5), items, gomock.Nil(), gomock.Any()).
+		Return(int32(9), map[int32]int32{2: 3}, nil)
+	mockDB.EXPECT().
+		CreateOrder(gomock.Any(), int32(5), int32(1), []db.OrderLine{
+			{ProductID: 2, ProductName: "Чайник", Quantity: 2, PricePerUnit: money.New(5700, 0, "RUB"), WarehouseID: 3},
+		}).
+		Return(nil)
+	mockClient.EXPECT().
+		CommitReservation(int32(9)).
+		Return(nil)
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(3)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), resp.OrderId)
+}
+
+func TestCreateOrder_Allocation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 2}}
+	allocation := &proto.Allocation{
+		Strategy:    proto.AllocationStrategy_ALLOCATION_STRATEGY_NEAREST,
+		Destination: &proto.GeoPoint{Latitude: 55.79, Longitude: 49.12},
+	}
+	expectSagaStart(mockDB, mockClient, 5)
+
+	mockClient.EXPECT().
+		CreateReservation(int32(5), items, allocation, gomock.Any()).
+		Return(int32(9), map[int32]int32{2: 4}, nil)
+	// Склад позиции сохраняется в саге сразу после резерва
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, state *db.SagaState) error {
+			assert.Equal(t, int32(4), state.Lines[0].WarehouseID)
+			return nil
+		}).
+		Times(3)
+	mockDB.EXPECT().
+		CreateOrder(gomock.Any(), int32(5), int32(1), gomock.Any()).
+		Return(nil)
+	mockClient.EXPECT().
+		CommitReservation(int32(9)).
+		Return(nil)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items, Allocation: allocation}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), resp.OrderId)
+}
+
+func TestCreateOrder_InsufficientStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 200}}
+	expectSagaStart(mockDB, mockClient, 5)
+
+	mockClient.EXPECT().
+		CreateReservation(int32(5), items, gomock.Nil(), gomock.Any()).
+		Return(int32(0), nil, status.Error(codes.FailedPrecondition, "Недостаточно товара на складе"))
+
+	// Откат: сага переходит в compensating, затем в compensated; компенсировать нечего
+	var saved []string
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, state *db.SagaState) error {
+			saved = append(saved, state.Status)
+			return nil
+		}).
+		Times(2)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, []string{db.SagaCompensating, db.SagaCompensated}, saved)
+}
+
+func TestCreateOrder_CreateOrderError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 2}}
+	expectSagaStart(mockDB, mockClient, 5)
+
+	mockClient.EXPECT().
+		CreateReservation(int32(5), items, gomock.Nil(), gomock.Any()).
+		Return(int32(9), nil, nil)
+	mockDB.EXPECT().
+		CreateOrder(gomock.Any(), int32(5), int32(1), gomock.Any()).
+		Return(errors.New("Database error"))
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(3)
+
+	// Строки не записались, поэтому откатывается только резерв
+	mockClient.EXPECT().
+		CancelReservation(int32(9)).
+		Return(nil)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Contains(t, err.Error(), "Database error")
+}
+
+func TestCreateOrder_CommitReservationError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 2}}
+	expectSagaStart(mockDB, mockClient, 5)
+
+	mockClient.EXPECT().
+		CreateReservation(int32(5), items, gomock.Nil(), gomock.Any()).
+		Return(int32(9), nil, nil)
+	mockDB.EXPECT().
+		CreateOrder(gomock.Any(), int32(5), int32(1), gomock.Any()).
+		Return(nil)
+	mockClient.EXPECT().
+		CommitReservation(int32(9)).
+		Return(status.Error(codes.FailedPrecondition, "Резерв уже закрыт"))
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(4)
+
+	// Откатываются оба шага: строки заказа и резерв
+	gomock.InOrder(
+		mockDB.EXPECT().DeleteOrderRows(gomock.Any(), int32(5)).Return(nil),
+		mockClient.EXPECT().CancelReservation(int32(9)).Return(nil),
+	)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Error(t, err)
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestCreateOrder_IdempotencyKeyReplay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	req := &proto.CreateOrderRequest{
+		CustomerId: 1,
+		Items:      []*proto.OrderItem{{ProductId: 2, Quantity: 2}},
+	}
+
+	// Первый запрос сохранил ключ с отпечатком запроса без ключа
+	hash, _ := idempotency.RequestHash(&proto.CreateOrderRequest{CustomerId: 1, Items: req.Items})
+	mockDB.EXPECT().
+		GetIdempotencyKey(gomock.Any(), "key-1").
+		Return(&db.IdempotencyRecord{Key: "key-1", RequestHash: hash, OrderID: 5, SagaStatus: db.SagaCompleted}, nil)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", "key-1"))
+	resp, err := handler.CreateOrder(ctx, req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), resp.OrderId)
+}
+
+func TestCreateOrder_IdempotencyKeyMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	mockDB.EXPECT().
+		GetIdempotencyKey(gomock.Any(), "key-1").
+		Return(&db.IdempotencyRecord{Key: "key-1", RequestHash: "other", OrderID: 5, SagaStatus: db.SagaCompleted}, nil)
+
+	req := &proto.CreateOrderRequest{
+		CustomerId:     1,
+		Items:          []*proto.OrderItem{{ProductId: 2, Quantity: 3}},
+		IdempotencyKey: "key-1",
+	}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateOrder_IdempotencyKeyInProgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	handler := NewOrderHandler(mockDB, clientmock.NewMockCatalogClient(ctrl))
+
+	req := &proto.CreateOrderRequest{
+		CustomerId:     1,
+		Items:          []*proto.OrderItem{{ProductId: 2, Quantity: 2}},
+		IdempotencyKey: "key-1",
+	}
+	hash, _ := idempotency.RequestHash(&proto.CreateOrderRequest{CustomerId: 1, Items: req.Items})
+
+	mockDB.EXPECT().
+		GetIdempotencyKey(gomock.Any(), "key-1").
+		Return(&db.IdempotencyRecord{Key: "key-1", RequestHash: hash, OrderID: 5, SagaStatus: db.SagaRunning}, nil)
+
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestCreateOrder_IdempotencyKeyNew(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	items := []*proto.OrderItem{{ProductId: 2, Quantity: 2}}
+	mockDB.EXPECT().
+		GetIdempotencyKey(gomock.Any(), "key-1").
+		Return(nil, db.ErrIdempotencyKeyNotFound)
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id *int32) error {
+			*id = 5
+			return nil
+		})
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{2}).
+		Return(map[int32]*proto.Product{2: kettle()}, nil, nil)
+	// Ключ занят параллельным запросом: сага не начинается
+	mockDB.EXPECT().
+		CreateSaga(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, state *db.SagaState) error {
+			assert.Equal(t, "key-1", state.IdempotencyKey)
+			assert.NotEmpty(t, state.RequestHash)
+			return db.ErrIdempotencyKeyInUse
+		})
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: items, IdempotencyKey: "key-1"}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.Aborted, status.Code(err))
+}
+
+func TestCreateOrder_CurrencyMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		Return(nil)
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{2, 3}).
+		Return(map[int32]*proto.Product{
+			2: kettle(),
+			3: {ProductId: 3, ProductName: "Кастрюля", StockQuantity: 31, Price: money.New(40, 0, "USD")},
+		}, nil, nil)
+
+	req := &proto.CreateOrderRequest{
+		CustomerId: 1,
+		Items:      []*proto.OrderItem{{ProductId: 2, Quantity: 1}, {ProductId: 3, Quantity: 1}},
+	}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateOrder_ProductsNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		Return(nil)
+	// Все позиции запрашиваются одним вызовом, отсутствующие перечисляются в ошибке
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{2, 7, 9}).
+		Return(map[int32]*proto.Product{2: kettle()}, []int32{7, 9}, nil)
+
+	req := &proto.CreateOrderRequest{
+		CustomerId: 1,
+		Items:      []*proto.OrderItem{{ProductId: 2, Quantity: 1}, {ProductId: 7, Quantity: 1}, {ProductId: 9, Quantity: 2}},
+	}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "7, 9")
+}
+
+func TestCreateOrder_BySKU(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	red := &proto.Product{ProductId: 8, ProductName: "Чайник (красный)", ParentProductId: 2, Sku: "KT-RED", Price: money.New(5900, 0, "RUB")}
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, id *int32) error {
+			*id = 5
+			return nil
+		})
+	// Товары без вариантов запрашиваются по ID, варианты - по артикулам
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{4}).
+		Return(map[int32]*proto.Product{4: {ProductId: 4, ProductName: "Кружка", Price: money.New(600, 0, "RUB")}}, nil, nil)
+	mockClient.EXPECT().
+		GetProductsBySKUs([]string{"KT-RED"}).
+		Return(map[string]*proto.Product{"KT-RED": red}, nil, nil)
+	mockDB.EXPECT().
+		CreateSaga(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	// Резервируется и записывается в заказ сам вариант, с его артикулом
+	mockClient.EXPECT().
+		CreateReservation(int32(5), []*proto.OrderItem{{ProductId: 8, Quantity: 1}, {ProductId: 4, Quantity: 2}}, gomock.Nil(), gomock.Any()).
+		Return(int32(9), nil, nil)
+	mockDB.EXPECT().
+		CreateOrder(gomock.Any(), int32(5), int32(1), []db.OrderLine{
+			{ProductID: 8, SKU: "KT-RED", ProductName: "Чайник (красный)", Quantity: 1, PricePerUnit: red.Price},
+			{ProductID: 4, ProductName: "Кружка", Quantity: 2, PricePerUnit: money.New(600, 0, "RUB")},
+		}).
+		Return(nil)
+	mockClient.EXPECT().
+		CommitReservation(int32(9)).
+		Return(nil)
+	mockDB.EXPECT().
+		UpdateSaga(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(3)
+
+	req := &proto.CreateOrderRequest{
+		CustomerId: 1,
+		Items:      []*proto.OrderItem{{Sku: "KT-RED", Quantity: 1}, {ProductId: 4, Quantity: 2}},
+	}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), resp.OrderId)
+}
+
+func TestCreateOrder_ProductSoldByVariants(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	parent := kettle()
+	parent.Variants = []*proto.Product{{ProductId: 8, ParentProductId: 2, Sku: "KT-RED"}}
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		Return(nil)
+	mockClient.EXPECT().
+		GetProductsByIDs([]int32{2}).
+		Return(map[int32]*proto.Product{2: parent}, nil, nil)
+
+	// Сага не начинается: нужно указать конкретный вариант
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: []*proto.OrderItem{{ProductId: 2, Quantity: 1}}}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestCreateOrder_SKUNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	mockClient := clientmock.NewMockCatalogClient(ctrl)
+	handler := NewOrderHandler(mockDB, mockClient)
+
+	mockDB.EXPECT().
+		GetNextOrderID(gomock.Any(), gomock.Any()).
+		Return(nil)
+	mockClient.EXPECT().
+		GetProductsBySKUs([]string{"KT-BLUE"}).
+		Return(map[string]*proto.Product{}, []string{"KT-BLUE"}, nil)
+
+	req := &proto.CreateOrderRequest{CustomerId: 1, Items: []*proto.OrderItem{{Sku: "KT-BLUE", Quantity: 1}}}
+	resp, err := handler.CreateOrder(context.Background(), req)
+
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "KT-BLUE")
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"store/idempotency"
+	"store/order-service/internal/orderstatus"
+	db "store/order-service/internal/repository"
+	"store/proto"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultPageSize размер страницы GetAllOrders, если клиент его не указал
+	defaultPageSize = 50
+	// maxPageSize наибольший размер страницы GetAllOrders
+	maxPageSize = 500
+)
+
+// pageToken содержимое page_token. Вместе с ключом последнего заказа
+// хранится отпечаток фильтров, чтобы токен нельзя было применить к другой выборке
+type pageToken struct {
+	Filter    string `json:"f"`
+	OrderDate string `json:"date"`
+	OrderID   int32  `json:"id"`
+}
+
+// orderFilter проверяет параметры GetAllOrders и собирает фильтр для базы
+func orderFilter(req *proto.GetAllOrdersRequest) (db.OrderFilter, error) {
+	filter := db.OrderFilter{
+		CustomerID: req.CustomerId,
+		PageSize:   int(req.PageSize),
+	}
+
+	switch {
+	case req.PageSize < 0:
+		return filter, status.Errorf(codes.InvalidArgument, "Размер страницы не может быть отрицательным")
+	case req.PageSize == 0:
+		filter.PageSize = defaultPageSize
+	case req.PageSize > maxPageSize:
+		filter.PageSize = maxPageSize
+	}
+
+	if req.CustomerId < 0 {
+		return filter, status.Errorf(codes.InvalidArgument, "Некорректный customer_id")
+	}
+
+	for _, s := range req.Statuses {
+		code := orderstatus.Code(s)
+		if code == "" {
+			return filter, status.Errorf(codes.InvalidArgument, "Неизвестный статус заказа: %s", s)
+		}
+		filter.Statuses = append(filter.Statuses, code)
+	}
+
+	var err error
+	if filter.From, err = filterDate(req.FromDate); err != nil {
+		return filter, err
+	}
+	if filter.To, err = filterDate(req.ToDate); err != nil {
+		return filter, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, status.Errorf(codes.InvalidArgument, "from_date должна быть раньше to_date")
+	}
+
+	if req.PageToken != "" {
+		if filter.After, err = decodePageToken(req); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// filterDate разбирает границу периода в RFC 3339. Даты заказов хранятся в UTC
+func filterDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "Некорректная дата %q, ожидается RFC 3339", s)
+	}
+	return t.UTC(), nil
+}
+
+// encodePageToken кодирует курсор следующей страницы
+func encodePageToken(req *proto.GetAllOrdersRequest, cursor *db.OrderCursor) (string, error) {
+	fingerprint, err := filterFingerprint(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(pageToken{
+		Filter:    fingerprint,
+		OrderDate: cursor.OrderDate.UTC().Format(time.RFC3339Nano),
+		OrderID:   cursor.OrderID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken разбирает page_token и проверяет, что он выдан для тех же фильтров
+func decodePageToken(req *proto.GetAllOrdersRequest) (*db.OrderCursor, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "Некорректный page_token")
+
+	data, err := base64.RawURLEncoding.DecodeString(req.PageToken)
+	if err != nil {
+		return nil, invalid
+	}
+	var token pageToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, invalid
+	}
+
+	fingerprint, err := filterFingerprint(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Внутренняя ошибка сервера")
+	}
+	if token.Filter != fingerprint {
+		return nil, status.Errorf(codes.InvalidArgument, "page_token выдан для других фильтров")
+	}
+
+	orderDate, err := time.Parse(time.RFC3339Nano, token.OrderDate)
+	if err != nil {
+		return nil, invalid
+	}
+	return &db.OrderCursor{OrderDate: orderDate, OrderID: token.OrderID}, nil
+}
+
+// filterFingerprint отпечаток фильтров запроса без параметров страницы
+func filterFingerprint(req *proto.GetAllOrdersRequest) (string, error) {
+	filters := protobuf.Clone(req).(*proto.GetAllOrdersRequest)
+	filters.PageSize = 0
+	filters.PageToken = ""
+	return idempotency.RequestHash(filters)
+}
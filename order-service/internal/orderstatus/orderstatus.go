@@ -0,0 +1,84 @@
+package orderstatus
+
+import (
+	"store/proto"
+	"strings"
+)
+
+// Коды статусов, хранящиеся в базе данных
+const (
+	Pending   = "pending"
+	Paid      = "paid"
+	Shipped   = "shipped"
+	Delivered = "delivered"
+	Cancelled = "cancelled"
+)
+
+var codes = map[proto.OrderStatus]string{
+	proto.OrderStatus_ORDER_STATUS_PENDING:   Pending,
+	proto.OrderStatus_ORDER_STATUS_PAID:      Paid,
+	proto.OrderStatus_ORDER_STATUS_SHIPPED:   Shipped,
+	proto.OrderStatus_ORDER_STATUS_DELIVERED: Delivered,
+	proto.OrderStatus_ORDER_STATUS_CANCELLED: Cancelled,
+}
+
+// aliases старые строковые статусы, которые клиенты присылали до появления enum
+var aliases = map[string]proto.OrderStatus{
+	"в обработке": proto.OrderStatus_ORDER_STATUS_PENDING,
+	"оплачен":     proto.OrderStatus_ORDER_STATUS_PAID,
+	"отправлен":   proto.OrderStatus_ORDER_STATUS_SHIPPED,
+	"выполнен":    proto.OrderStatus_ORDER_STATUS_DELIVERED,
+	"доставлен":   proto.OrderStatus_ORDER_STATUS_DELIVERED,
+	"отменен":     proto.OrderStatus_ORDER_STATUS_CANCELLED,
+}
+
+// transitions допустимые переходы между статусами.
+// Доставленный и отмененный заказы больше не меняются
+var transitions = map[proto.OrderStatus][]proto.OrderStatus{
+	proto.OrderStatus_ORDER_STATUS_PENDING: {
+		proto.OrderStatus_ORDER_STATUS_PAID,
+		proto.OrderStatus_ORDER_STATUS_CANCELLED,
+	},
+	proto.OrderStatus_ORDER_STATUS_PAID: {
+		proto.OrderStatus_ORDER_STATUS_SHIPPED,
+		proto.OrderStatus_ORDER_STATUS_CANCELLED,
+	},
+	proto.OrderStatus_ORDER_STATUS_SHIPPED: {
+		proto.OrderStatus_ORDER_STATUS_DELIVERED,
+	},
+}
+
+// Code возвращает код статуса для хранения в базе данных
+func Code(status proto.OrderStatus) string {
+	return codes[status]
+}
+
+// Parse разбирает код статуса, имя значения enum или старый строковый статус
+func Parse(s string) (proto.OrderStatus, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for status, code := range codes {
+		name := strings.ToLower(status.String())
+		if s == code || s == name || s == strings.TrimPrefix(name, "order_status_") {
+			return status, true
+		}
+	}
+	status, ok := aliases[s]
+	return status, ok
+}
+
+// CanTransition сообщает, можно ли перевести заказ из статуса from в статус to
+func CanTransition(from, to proto.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal сообщает, что из статуса больше нет переходов
+func IsFinal(status proto.OrderStatus) bool {
+	_, known := codes[status]
+	_, next := transitions[status]
+	return known && !next
+}
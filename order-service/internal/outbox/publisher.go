@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	db "store/order-service/internal/repository"
+	"sync"
+)
+
+// Publisher доставляет события заказов внешним системам.
+// Доставка «хотя бы один раз»: одно событие может прийти повторно,
+// получатель должен различать дубликаты по Event.ID
+type Publisher interface {
+	Publish(ctx context.Context, event *db.Event) error
+}
+
+// ChannelPublisher передает события подписчикам внутри процесса
+type ChannelPublisher struct {
+	events chan *db.Event
+}
+
+// NewChannelPublisher создает публикатор с буфером на size событий
+func NewChannelPublisher(size int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan *db.Event, size)}
+}
+
+// Events возвращает канал опубликованных событий
+func (p *ChannelPublisher) Events() <-chan *db.Event {
+	return p.events
+}
+
+// Publish кладет событие в канал и ждет, пока в буфере появится место
+func (p *ChannelPublisher) Publish(ctx context.Context, event *db.Event) error {
+	select {
+	case p.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WriterPublisher пишет события построчно в формате JSON в файл или лог
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterPublisher создает публикатор, пишущий в w
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+// Publish записывает событие одной строкой
+func (p *WriterPublisher) Publish(ctx context.Context, event *db.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// LogPublisher пишет события в стандартный лог
+type LogPublisher struct{}
+
+// Publish выводит событие в лог
+func (LogPublisher) Publish(ctx context.Context, event *db.Event) error {
+	log.Printf("Событие %s #%d для заказа %d: %s", event.Type, event.ID, event.OrderID, event.Payload)
+	return nil
+}
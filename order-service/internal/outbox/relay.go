@@ -0,0 +1,68 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	db "store/order-service/internal/repository"
+	"time"
+)
+
+// Relay периодически забирает неопубликованные события из outbox,
+// публикует их и отмечает доставленными. Событие отмечается только
+// после успешной публикации, поэтому при падении оно будет отправлено повторно
+type Relay struct {
+	db        db.OrderDB
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+// NewRelay создает ретранслятор, опрашивающий outbox раз в interval
+func NewRelay(db db.OrderDB, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	return &Relay{
+		db:        db,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run публикует события до отмены ctx
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Flush(ctx); err != nil {
+				log.Printf("Ошибка при публикации событий заказов: %v", err)
+			}
+		}
+	}
+}
+
+// Flush публикует одну пачку событий и возвращает число доставленных.
+// На первой ошибке публикация останавливается, чтобы не нарушить порядок событий
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	events, err := r.db.GetPendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, event := range events {
+		if err := r.publisher.Publish(ctx, event); err != nil {
+			if markErr := r.db.MarkEventFailed(ctx, event.ID, err.Error()); markErr != nil {
+				log.Printf("Ошибка при сохранении попытки публикации события %d: %v", event.ID, markErr)
+			}
+			return i, err
+		}
+		if err := r.db.MarkEventDelivered(ctx, event.ID); err != nil {
+			// Событие уже опубликовано и будет отправлено повторно
+			return i, err
+		}
+	}
+	return len(events), nil
+}
@@ -0,0 +1,80 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+	db "store/order-service/internal/repository"
+	mock "store/order-service/internal/repository/mock"
+)
+
+func TestRelayFlush_DeliversInOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	publisher := NewChannelPublisher(10)
+	relay := NewRelay(mockDB, publisher, 0, 10)
+
+	events := []*db.Event{
+		{ID: 1, OrderID: 5, Type: db.EventOrderCreated, Payload: json.RawMessage(`{"order_id":5}`)},
+		{ID: 2, OrderID: 5, Type: db.EventOrderStatusChanged, Payload: json.RawMessage(`{"order_id":5,"status":"Выполнен"}`)},
+	}
+	mockDB.EXPECT().GetPendingEvents(gomock.Any(), 10).Return(events, nil)
+	gomock.InOrder(
+		mockDB.EXPECT().MarkEventDelivered(gomock.Any(), int64(1)).Return(nil),
+		mockDB.EXPECT().MarkEventDelivered(gomock.Any(), int64(2)).Return(nil),
+	)
+
+	delivered, err := relay.Flush(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, events[0], <-publisher.Events())
+	assert.Equal(t, events[1], <-publisher.Events())
+}
+
+// failingPublisher не принимает ни одного события
+type failingPublisher struct{}
+
+func (failingPublisher) Publish(ctx context.Context, event *db.Event) error {
+	return errors.New("broker unavailable")
+}
+
+func TestRelayFlush_StopsOnPublishError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mock.NewMockOrderDB(ctrl)
+	relay := NewRelay(mockDB, failingPublisher{}, 0, 10)
+
+	events := []*db.Event{
+		{ID: 1, OrderID: 5, Type: db.EventOrderCreated},
+		{ID: 2, OrderID: 5, Type: db.EventOrderDeleted},
+	}
+	mockDB.EXPECT().GetPendingEvents(gomock.Any(), 10).Return(events, nil)
+	// Событие остается неопубликованным, следующее не отправляется
+	mockDB.EXPECT().MarkEventFailed(gomock.Any(), int64(1), "broker unavailable").Return(nil)
+
+	delivered, err := relay.Flush(context.Background())
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, delivered)
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := NewWriterPublisher(&buf)
+
+	event := &db.Event{ID: 3, OrderID: 7, Type: db.EventOrderDeleted, Payload: json.RawMessage(`{"order_id":7}`)}
+	err := publisher.Publish(context.Background(), event)
+
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"event_type":"order.deleted"`)
+	assert.Contains(t, buf.String(), `"payload":{"order_id":7}`)
+}
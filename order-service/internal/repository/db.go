@@ -2,40 +2,104 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"store/order-service/internal/client"
+	"store/money"
+	"store/order-service/internal/orderstatus"
 	"store/proto"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var (
+	// ErrOrderNotFound возвращается, если заказа с указанным ID нет
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrStatusConflict возвращается, если статус заказа успели изменить параллельно
+	ErrStatusConflict = errors.New("order status was changed concurrently")
+	// ErrOrderNotCancelled возвращается при попытке удалить неотмененный заказ
+	ErrOrderNotCancelled = errors.New("order is not cancelled")
+	// ErrIdempotencyKeyNotFound возвращается, если ключа идемпотентности нет или он устарел
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	// ErrIdempotencyKeyInUse возвращается, если ключ уже занят другим запросом
+	ErrIdempotencyKeyInUse = errors.New("idempotency key is already in use")
 )
 
 // OrderDB интерфейс для работы с заказами
 type OrderDB interface {
 	GetNextOrderID(ctx context.Context, orderID *int32) error
-	CreateOrder(ctx context.Context, orderID int32, productID int32, customerID int32, quantity int32, pricePerUnit float64) error
+	// CreateOrder записывает все позиции заказа в одной транзакции
+	CreateOrder(ctx context.Context, orderID int32, customerID int32, lines []OrderLine) error
 	GetOrderByID(orderID int32) (*proto.Order, error)
-	GetAllOrders() ([]*proto.Order, error)
-	UpdateOrder(orderID int32, status string) error
+	// GetAllOrders возвращает страницу заказов по фильтру и курсор следующей страницы
+	// (nil, если страница последняя)
+	GetAllOrders(ctx context.Context, filter OrderFilter) ([]*proto.Order, *OrderCursor, error)
+	// UpdateOrder переводит заказ из статуса fromStatus в toStatus и записывает переход в историю
+	UpdateOrder(orderID int32, fromStatus string, toStatus string, actor string) error
+	// CancelOrder переводит заказ в статус cancelled с указанием причины
+	CancelOrder(orderID int32, fromStatus string, reason string, actor string) error
+	// DeleteOrder безвозвратно удаляет отмененный заказ
 	DeleteOrder(orderID int32) error
-	// GetProductByID(productID int32) (string, int, float64, error)
+	// DeleteOrderRows удаляет строки заказа, не трогая остатки в каталоге
+	DeleteOrderRows(ctx context.Context, orderID int32) error
+	// CreateSaga сохраняет новую сагу создания заказа и занимает ее ключ идемпотентности
+	CreateSaga(ctx context.Context, saga *SagaState) error
+	// UpdateSaga сохраняет шаг, статус, ошибку и строки саги
+	UpdateSaga(ctx context.Context, saga *SagaState) error
+	// ClaimStaleSagas забирает на восстановление незавершенные саги, не обновлявшиеся дольше idle
+	ClaimStaleSagas(ctx context.Context, idle time.Duration) ([]*SagaState, error)
+	// GetPendingEvents возвращает неопубликованные события outbox
+	GetPendingEvents(ctx context.Context, limit int) ([]*Event, error)
+	// MarkEventDelivered отмечает событие outbox опубликованным
+	MarkEventDelivered(ctx context.Context, eventID int64) error
+	// MarkEventFailed сохраняет ошибку публикации события outbox
+	MarkEventFailed(ctx context.Context, eventID int64, reason string) error
+	// GetIdempotencyKey возвращает действующий ключ идемпотентности CreateOrder
+	GetIdempotencyKey(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// PurgeIdempotencyKeys удаляет ключи идемпотентности старше IdempotencyRetention
+	PurgeIdempotencyKeys(ctx context.Context) (int, error)
+}
+
+//go:generate mockgen -source=db.go -destination=mock/mock.go -package mock
+
+// OrderLine позиция заказа с зафиксированной ценой
+type OrderLine struct {
+	ProductID    int32        `json:"product_id"`
+	SKU          string       `json:"sku,omitempty"`          // Артикул варианта, если заказан вариант
+	WarehouseID  int32        `json:"warehouse_id,omitempty"` // Склад, с которого зарезервирована позиция
+	ProductName  string       `json:"product_name"`
+	Quantity     int32        `json:"quantity"`
+	PricePerUnit *proto.Money `json:"price"`
 }
 
-//go:generate mockgen -source=db.go -destination=mock/mock.go
+// OrderFilter параметры выборки заказов
+type OrderFilter struct {
+	CustomerID int32     // 0 - все клиенты
+	Statuses   []string  // Коды статусов; пусто - любой статус
+	From       time.Time // Нулевое значение - без нижней границы
+	To         time.Time // Нулевое значение - без верхней границы
+	PageSize   int
+	After      *OrderCursor // nil - первая страница
+}
+
+// OrderCursor ключ последнего заказа страницы для keyset-пагинации
+type OrderCursor struct {
+	OrderDate time.Time
+	OrderID   int32
+}
 
 // orderDB реализует интерфейс OrderDB
 type orderDB struct {
-	conn          *pgx.Conn
-	catalogClient client.CatalogClient // Используем интерфейс
+	conn *pgxpool.Pool
 }
 
 // NewOrderDB создает новый экземпляр orderDB
-func NewOrderDB(conn *pgx.Conn, catalogClient client.CatalogClient) OrderDB {
-	return &orderDB{
-		conn:          conn,
-		catalogClient: catalogClient,
-	}
+func NewOrderDB(conn *pgxpool.Pool) OrderDB {
+	return &orderDB{conn: conn}
 }
 
 // CreateOrder добавляет новый заказ в базу данных
@@ -43,116 +107,317 @@ func (db *orderDB) GetNextOrderID(ctx context.Context, orderID *int32) error {
 	return db.conn.QueryRow(ctx, "SELECT nextval('orders_orderid_seq')").Scan(orderID)
 }
 
-func (db *orderDB) CreateOrder(ctx context.Context, orderID int32, productID int32, customerID int32, quantity int32, pricePerUnit float64) error {
-	_, err := db.conn.Exec(ctx, `
-        INSERT INTO Orders (OrderID, ProductID, CustomerID, Quantity, PricePerUnit)
-        VALUES ($1, $2, $3, $4, $5)
-    `, orderID, productID, customerID, quantity, pricePerUnit)
-	return err
-}
+func (db *orderDB) CreateOrder(ctx context.Context, orderID int32, customerID int32, lines []OrderLine) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-// GetOrderByID возвращает заказ по его ID
-func (db *orderDB) GetOrderByID(orderID int32) (*proto.Order, error) {
-	// Основная информация о заказе
-	var order proto.Order
-	order.OrderId = orderID
+	// Все позиции заказа в одной валюте, скидки и налоги пока не начисляются
+	currency := money.DefaultCurrency
+	if len(lines) > 0 {
+		currency = lines[0].PricePerUnit.CurrencyCode
+	}
+	_, err = tx.Exec(ctx, `
+        INSERT INTO Orders (OrderID, CustomerID, Status, Currency)
+        VALUES ($1, $2, $3, $4)
+    `, orderID, customerID, orderstatus.Pending, currency)
+	if err != nil {
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
 
-	// Получаем список продуктов в заказе
-	rows, err := db.conn.Query(context.Background(), `
-        SELECT productid, quantity 
-        FROM orders 
-        WHERE orderid = $1`, orderID)
+	err = insertStatusHistory(ctx, tx, orderID, "", orderstatus.Pending, fmt.Sprintf("customer:%d", customerID))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	// Чтение данных о продуктах
-	for rows.Next() {
-		var item proto.OrderItem
-		err := rows.Scan(&item.ProductId, &item.Quantity)
+	for _, line := range lines {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO OrderItems (OrderID, ProductID, SKU, ProductName, Quantity, PricePerUnit, Currency, WarehouseID)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0))
+        `, orderID, line.ProductID, line.SKU, line.ProductName, line.Quantity, money.String(line.PricePerUnit), line.PricePerUnit.CurrencyCode, line.WarehouseID)
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("failed to insert order item: %w", err)
 		}
+	}
+
+	err = insertEvent(ctx, tx, orderID, EventOrderCreated, OrderCreatedPayload{
+		OrderID:    orderID,
+		CustomerID: customerID,
+		Items:      lines,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
 
-		// Добавляем продукт в заказ
-		order.Items = append(order.Items, &item)
+// DeleteOrderRows удаляет строки заказа без возврата товара на склад
+func (db *orderDB) DeleteOrderRows(ctx context.Context, orderID int32) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	// Получаем общую информацию о заказе (дата, статус, клиент)
-	var orderDate time.Time
-	err = db.conn.QueryRow(context.Background(), `
-        SELECT orderdate, status, customerid 
-        FROM orders 
-        WHERE orderid = $1 
-        LIMIT 1`, orderID).Scan(&orderDate, &order.Status, &order.CustomerId)
+	// Позиции удаляются каскадно вместе с заголовком
+	_, err = tx.Exec(ctx, `DELETE FROM orders WHERE orderid = $1`, orderID)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to delete order: %w", err)
 	}
 
-	// Преобразуем время в строку
-	order.OrderDate = orderDate.Format(time.RFC3339)
+	// Подписчики уже получили order.created, поэтому сообщаем об откате
+	err = insertEvent(ctx, tx, orderID, EventOrderDeleted, OrderDeletedPayload{
+		OrderID: orderID,
+		Reason:  "compensated",
+	})
+	if err != nil {
+		return err
+	}
 
-	return &order, nil
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-func (db *orderDB) GetAllOrders() ([]*proto.Order, error) {
+// GetOrderByID возвращает заказ по его ID
+func (db *orderDB) GetOrderByID(orderID int32) (*proto.Order, error) {
+	// Заголовок и позиции заказа получаем одним запросом
 	rows, err := db.conn.Query(context.Background(), `
-        SELECT orderid, productid, quantity, orderdate, status, customerid
-        FROM orders`)
+        SELECT o.orderid, o.orderdate, o.status, COALESCE(o.cancellationreason, ''), o.customerid,
+               o.currency, o.discounttotal, o.taxtotal,
+               i.productid, i.sku, i.productname, i.quantity, i.priceperunit, i.currency,
+               COALESCE(i.warehouseid, 0)
+        FROM orders o
+        LEFT JOIN orderitems i ON i.orderid = o.orderid
+        WHERE o.orderid = $1
+        ORDER BY i.productid`, orderID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, ErrOrderNotFound
+	}
+
+	return orders[0], nil
+}
+
+// GetAllOrders сначала выбирает заголовки страницы (на один больше размера страницы,
+// чтобы понять, есть ли следующая), затем - сами заказы с позициями.
+// Оба запроса идут в одном снимке, поэтому страница согласована
+func (db *orderDB) GetAllOrders(ctx context.Context, filter OrderFilter) ([]*proto.Order, *OrderCursor, error) {
+	var where []string
+	var args queryArgs
+
+	if filter.CustomerID != 0 {
+		where = append(where, "customerid = "+args.add(filter.CustomerID))
+	}
+	if len(filter.Statuses) > 0 {
+		where = append(where, "status = ANY("+args.add(filter.Statuses)+")")
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "orderdate >= "+args.add(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "orderdate < "+args.add(filter.To))
+	}
+	if c := filter.After; c != nil {
+		where = append(where, "(orderdate, orderid) < ("+args.add(c.OrderDate)+", "+args.add(c.OrderID)+")")
+	}
+
+	query := "SELECT orderid, orderdate FROM orders"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY orderdate DESC, orderid DESC LIMIT " + args.add(filter.PageSize+1)
+
+	tx, err := db.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var page []OrderCursor
+	for rows.Next() {
+		var key OrderCursor
+		if err := rows.Scan(&key.OrderID, &key.OrderDate); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		page = append(page, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *OrderCursor
+	if len(page) > filter.PageSize {
+		page = page[:filter.PageSize]
+		next = &page[len(page)-1]
+	}
+	if len(page) == 0 {
+		return nil, nil, nil
+	}
+
+	orderIDs := make([]int32, len(page))
+	for i, key := range page {
+		orderIDs[i] = key.OrderID
+	}
+
+	rows, err = tx.Query(ctx, `
+        SELECT o.orderid, o.orderdate, o.status, COALESCE(o.cancellationreason, ''), o.customerid,
+               o.currency, o.discounttotal, o.taxtotal,
+               i.productid, i.sku, i.productname, i.quantity, i.priceperunit, i.currency,
+               COALESCE(i.warehouseid, 0)
+        FROM orders o
+        LEFT JOIN orderitems i ON i.orderid = o.orderid
+        WHERE o.orderid = ANY($1)
+        ORDER BY o.orderdate DESC, o.orderid DESC, i.productid`, orderIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	orders, err := scanOrders(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return orders, next, nil
+}
+
+// queryArgs параметры динамически собираемого запроса
+type queryArgs []interface{}
+
+// add добавляет значение в параметры и возвращает его плейсхолдер $N
+func (a *queryArgs) add(value interface{}) string {
+	*a = append(*a, value)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// scanOrders собирает заказы из строк заголовок+позиция,
+// отсортированных по orderid. Цены и итоги берутся из самого заказа
+// и считаются точно, без обращения к текущим ценам каталога
+func scanOrders(rows pgx.Rows) ([]*proto.Order, error) {
 	var orders []*proto.Order
-	orderMap := make(map[int32]*proto.Order) // Для группировки товаров по заказам
+	var order *proto.Order
 
 	for rows.Next() {
 		var orderID int32
-		var productID int32
-		var quantity int32
 		var orderDate time.Time
 		var status string
+		var cancellationReason string
 		var customerID int32
-
-		err := rows.Scan(&orderID, &productID, &quantity, &orderDate, &status, &customerID)
+		var currency string
+		var discountTotal pgtype.Numeric
+		var taxTotal pgtype.Numeric
+		var productID *int32
+		var sku *string
+		var productName *string
+		var quantity *int32
+		var unitPrice pgtype.Numeric
+		var itemCurrency *string
+		var warehouseID int32
+
+		err := rows.Scan(
+			&orderID, &orderDate, &status, &cancellationReason, &customerID,
+			&currency, &discountTotal, &taxTotal,
+			&productID, &sku, &productName, &quantity, &unitPrice, &itemCurrency,
+			&warehouseID,
+		)
 		if err != nil {
 			return nil, err
 		}
 
-		// Преобразование времени в строку
-		orderDateStr := orderDate.Format(time.RFC3339)
-
-		// Если заказ с таким ID уже есть в мапе, добавляем товар в его список
-		if order, exists := orderMap[orderID]; exists {
-			order.Items = append(order.Items, &proto.OrderItem{
-				ProductId: productID,
-				Quantity:  quantity,
-			})
-		} else {
-			// Создаем новый заказ и добавляем его в мапу
-			order := &proto.Order{
-				OrderId:    orderID,
-				OrderDate:  orderDateStr,
-				Status:     status,
-				CustomerId: customerID,
-				Items: []*proto.OrderItem{
-					{
-						ProductId: productID,
-						Quantity:  quantity,
-					},
-				},
+		// Строки одного заказа идут подряд, новый orderid - новый заказ
+		if order == nil || order.OrderId != orderID {
+			order = &proto.Order{
+				OrderId:            orderID,
+				OrderDate:          orderDate.Format(time.RFC3339),
+				Status:             status,
+				CustomerId:         customerID,
+				CancellationReason: cancellationReason,
+				Subtotal:           money.Zero(currency),
+			}
+			order.OrderStatus, _ = orderstatus.Parse(status)
+			if order.DiscountTotal, err = money.FromNumeric(discountTotal, currency); err != nil {
+				return nil, fmt.Errorf("order %d discount: %w", orderID, err)
+			}
+			if order.TaxTotal, err = money.FromNumeric(taxTotal, currency); err != nil {
+				return nil, fmt.Errorf("order %d tax: %w", orderID, err)
 			}
-			orderMap[orderID] = order
 			orders = append(orders, order)
 		}
+
+		// У заказа без позиций LEFT JOIN возвращает NULL
+		if productID != nil {
+			item, err := scanOrderItem(*productID, *sku, *productName, *quantity, unitPrice, *itemCurrency)
+			if err != nil {
+				return nil, fmt.Errorf("order %d: %w", orderID, err)
+			}
+			item.WarehouseId = warehouseID
+			order.Items = append(order.Items, item)
+			if order.Subtotal, err = money.Add(order.Subtotal, item.LineTotal); err != nil {
+				return nil, fmt.Errorf("order %d: %w", orderID, err)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		grandTotal, err := money.Sub(order.Subtotal, order.DiscountTotal)
+		if err == nil {
+			grandTotal, err = money.Add(grandTotal, order.TaxTotal)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("order %d total: %w", order.OrderId, err)
+		}
+		order.GrandTotal = grandTotal
+		order.Total = grandTotal
 	}
 
 	return orders, nil
 }
 
-func (db *orderDB) UpdateOrder(orderID int32, status string) error {
+// scanOrderItem собирает позицию заказа с зафиксированной ценой и суммой строки
+func scanOrderItem(productID int32, sku string, productName string, quantity int32, unitPrice pgtype.Numeric, currency string) (*proto.OrderItem, error) {
+	price, err := money.FromNumeric(unitPrice, currency)
+	if err != nil {
+		return nil, fmt.Errorf("item %d price: %w", productID, err)
+	}
+	lineTotal, err := money.Multiply(price, int64(quantity))
+	if err != nil {
+		return nil, fmt.Errorf("item %d total: %w", productID, err)
+	}
+	return &proto.OrderItem{
+		ProductId:   productID,
+		Sku:         sku,
+		Quantity:    quantity,
+		UnitPrice:   price,
+		ProductName: productName,
+		LineTotal:   lineTotal,
+	}, nil
+}
+
+func (db *orderDB) UpdateOrder(orderID int32, fromStatus string, toStatus string, actor string) error {
 	// Начинаем транзакцию
 	tx, err := db.conn.Begin(context.Background())
 	if err != nil {
@@ -160,14 +425,32 @@ func (db *orderDB) UpdateOrder(orderID int32, status string) error {
 	}
 	defer tx.Rollback(context.Background())
 
-	// Обновляем статус заказа
-	_, err = tx.Exec(context.Background(), `
+	// Обновляем статус, только если его не изменили с момента проверки перехода
+	tag, err := tx.Exec(context.Background(), `
         UPDATE Orders 
         SET status = $1 
-        WHERE orderid = $2`, status, orderID)
+        WHERE orderid = $2 AND status = $3`, toStatus, orderID, fromStatus)
 	if err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return db.orderStatusError(context.Background(), tx, orderID, ErrStatusConflict)
+	}
+
+	err = insertStatusHistory(context.Background(), tx, orderID, fromStatus, toStatus, actor)
+	if err != nil {
+		return err
+	}
+
+	err = insertEvent(context.Background(), tx, orderID, EventOrderStatusChanged, OrderStatusChangedPayload{
+		OrderID:    orderID,
+		FromStatus: fromStatus,
+		Status:     toStatus,
+		Actor:      actor,
+	})
+	if err != nil {
+		return err
+	}
 
 	// Завершаем транзакцию
 	if err := tx.Commit(context.Background()); err != nil {
@@ -177,50 +460,103 @@ func (db *orderDB) UpdateOrder(orderID int32, status string) error {
 	return nil
 }
 
-// DeleteOrder удаляет заказ из базы данных и восстанавливает количество товаров в каталоге
-func (db *orderDB) DeleteOrder(orderID int32) error {
-	// Начинаем транзакцию
-	tx, err := db.conn.Begin(context.Background())
+// StatusChangedChannel канал Postgres NOTIFY, в который при смене статуса
+// отправляется ID заказа. Уведомление доставляется только после коммита
+const StatusChangedChannel = "order_status_changed"
+
+// insertStatusHistory записывает переход статуса; пустой fromStatus - создание заказа.
+// Вместе с записью в историю отправляется уведомление для подписчиков WatchOrder
+func insertStatusHistory(ctx context.Context, tx pgx.Tx, orderID int32, fromStatus string, toStatus string, actor string) error {
+	_, err := tx.Exec(ctx, `
+        INSERT INTO OrderStatusHistory (OrderID, FromStatus, ToStatus, Actor)
+        VALUES ($1, NULLIF($2, ''), $3, $4)`,
+		orderID, fromStatus, toStatus, actor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write status history: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, StatusChangedChannel, strconv.Itoa(int(orderID)))
+	if err != nil {
+		return fmt.Errorf("failed to notify status change: %w", err)
+	}
+	return nil
+}
+
+// CancelOrder переводит заказ из статуса fromStatus в cancelled и сохраняет причину отмены.
+// Строки заказа остаются для отчетности
+func (db *orderDB) CancelOrder(orderID int32, fromStatus string, reason string, actor string) error {
+	ctx := context.Background()
+
+	tx, err := db.conn.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer tx.Rollback(context.Background())
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE Orders
+        SET status = $1, cancellationreason = $2, cancelledat = CURRENT_TIMESTAMP
+        WHERE orderid = $3 AND status = $4`,
+		orderstatus.Cancelled, reason, orderID, fromStatus,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel order: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return db.orderStatusError(ctx, tx, orderID, ErrStatusConflict)
+	}
 
-	// Получаем информацию о заказе
-	order, err := db.GetOrderByID(orderID)
+	err = insertStatusHistory(ctx, tx, orderID, fromStatus, orderstatus.Cancelled, actor)
 	if err != nil {
-		return fmt.Errorf("failed to get order details: %w", err)
+		return err
 	}
 
-	// Создаем gRPC-клиент для catalog-service
-	catalogClient, err := client.NewCatalogClient("localhost:50051") // Укажите адрес catalog-service
+	err = insertEvent(ctx, tx, orderID, EventOrderCancelled, OrderCancelledPayload{
+		OrderID:    orderID,
+		FromStatus: fromStatus,
+		Reason:     reason,
+		Actor:      actor,
+	})
 	if err != nil {
-		log.Printf("Ошибка при создании gRPC-клиента для catalog-service: %v", err)
 		return err
 	}
-	defer catalogClient.Close()
 
-	// Восстанавливаем количество товаров в каталоге
-	for _, item := range order.Items {
-		// Получаем текущее количество товара на складе из каталога
-		_, stockQuantity, _, err := catalogClient.GetProductByID(item.ProductId)
-		if err != nil {
-			return fmt.Errorf("failed to get product stock quantity: %w", err)
-		}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
 
-		// Восстанавливаем количество товара на складе
-		newStockQuantity := stockQuantity + int(item.Quantity)
-		err = db.catalogClient.UpdateProductStock(item.ProductId, int32(newStockQuantity))
-		if err != nil {
-			return fmt.Errorf("failed to update catalog stock via gRPC: %w", err)
-		}
+// DeleteOrder безвозвратно удаляет отмененный заказ.
+// Товар на склад не возвращается: это уже сделано при отмене
+func (db *orderDB) DeleteOrder(orderID int32) error {
+	// Начинаем транзакцию
+	tx, err := db.conn.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(context.Background())
 
-	// Удаляем заказ из базы данных
-	_, err = tx.Exec(context.Background(), `DELETE FROM orders WHERE orderid = $1`, orderID)
+	// Удаляем заказ из базы данных, только если он отменен
+	tag, err := tx.Exec(context.Background(),
+		`DELETE FROM orders WHERE orderid = $1 AND status = $2`,
+		orderID, orderstatus.Cancelled,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to delete order: %w", err)
 	}
+	if tag.RowsAffected() == 0 {
+		return db.orderStatusError(context.Background(), tx, orderID, ErrOrderNotCancelled)
+	}
+
+	err = insertEvent(context.Background(), tx, orderID, EventOrderDeleted, OrderDeletedPayload{
+		OrderID: orderID,
+		Reason:  "deleted",
+	})
+	if err != nil {
+		return err
+	}
 
 	// Завершаем транзакцию
 	if err := tx.Commit(context.Background()); err != nil {
@@ -230,13 +566,29 @@ func (db *orderDB) DeleteOrder(orderID int32) error {
 	return nil
 }
 
+// orderStatusError объясняет, почему условное изменение заказа не затронуло строк:
+// заказа нет (ErrOrderNotFound) или он в другом статусе (statusErr)
+func (db *orderDB) orderStatusError(ctx context.Context, tx pgx.Tx, orderID int32, statusErr error) error {
+	var exists bool
+	err := tx.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM Orders WHERE orderid = $1)", orderID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrOrderNotFound
+	}
+	return statusErr
+}
+
 // // GetProductByID возвращает информацию о товаре по его ID
 // func (db *orderDB) GetProductByID(productID int32) (string, int, float64, error) {
 // 	var productName string
 // 	var stockQuantity int
 // 	var pricePerUnit float64
 // 	err := db.conn.QueryRow(context.Background(), `
-//         SELECT ProductName, StockQuantity, PricePerUnit FROM Catalog 
+//         SELECT ProductName, StockQuantity, PricePerUnit FROM Catalog
 //         WHERE ProductID = $1`, productID).Scan(&productName, &stockQuantity, &pricePerUnit)
 // 	if err != nil {
 // 		return "", 0, 0, err
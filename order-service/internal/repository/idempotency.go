@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// IdempotencyRetention сколько хранится ключ идемпотентности.
+// После этого срока ключ можно использовать для нового запроса
+const IdempotencyRetention = 24 * time.Hour
+
+// IdempotencyRecord сохраненный ключ идемпотентности CreateOrder
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+	OrderID     int32
+	SagaStatus  string // Статус саги заказа OrderID
+}
+
+// GetIdempotencyKey возвращает действующий ключ вместе со статусом саги
+func (db *orderDB) GetIdempotencyKey(ctx context.Context, key string) (*IdempotencyRecord, error) {
+	record := IdempotencyRecord{Key: key}
+	err := db.conn.QueryRow(ctx, `
+        SELECT k.RequestHash, k.OrderID, COALESCE(s.Status, '')
+        FROM IdempotencyKeys k
+        LEFT JOIN OrderSagas s ON s.OrderID = k.OrderID
+        WHERE k.IdempotencyKey = $1
+          AND k.CreatedAt >= CURRENT_TIMESTAMP - make_interval(secs => $2)`,
+		key, IdempotencyRetention.Seconds(),
+	).Scan(&record.RequestHash, &record.OrderID, &record.SagaStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// claimIdempotencyKey привязывает ключ к заказу orderID. Занятый ключ можно
+// перезаписать, только если он устарел или сага по нему откатилась
+// (исходный запрос завершился ошибкой без последствий)
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, key, requestHash string, orderID int32) error {
+	tag, err := tx.Exec(ctx, `
+        INSERT INTO IdempotencyKeys (IdempotencyKey, RequestHash, OrderID)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (IdempotencyKey) DO UPDATE
+        SET RequestHash = EXCLUDED.RequestHash,
+            OrderID = EXCLUDED.OrderID,
+            CreatedAt = CURRENT_TIMESTAMP
+        WHERE IdempotencyKeys.CreatedAt < CURRENT_TIMESTAMP - make_interval(secs => $4)
+           OR (IdempotencyKeys.RequestHash = EXCLUDED.RequestHash
+               AND EXISTS (
+                   SELECT 1 FROM OrderSagas s
+                   WHERE s.OrderID = IdempotencyKeys.OrderID AND s.Status = $5
+               ))`,
+		key, requestHash, orderID, IdempotencyRetention.Seconds(), SagaCompensated,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIdempotencyKeyInUse
+	}
+	return nil
+}
+
+// PurgeIdempotencyKeys удаляет ключи идемпотентности старше IdempotencyRetention
+func (db *orderDB) PurgeIdempotencyKeys(ctx context.Context) (int, error) {
+	tag, err := db.conn.Exec(ctx,
+		"DELETE FROM IdempotencyKeys WHERE CreatedAt < CURRENT_TIMESTAMP - make_interval(secs => $1)",
+		IdempotencyRetention.Seconds(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
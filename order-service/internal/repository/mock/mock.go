@@ -1,12 +1,20 @@
 // Code generated by MockGen. DO NOT EDIT.
 // Source: db.go
+//
+// Generated by this command:
+//
+//	mockgen -source=db.go -destination=mock/mock.go -package mock
+//
 
+// Package mock is a generated GoMock package.
 package mock
 
 import (
 	context "context"
 	reflect "reflect"
+	db "store/order-service/internal/repository"
 	proto "store/proto"
+	time "time"
 
 	gomock "go.uber.org/mock/gomock"
 )
@@ -15,6 +23,7 @@ import (
 type MockOrderDB struct {
 	ctrl     *gomock.Controller
 	recorder *MockOrderDBMockRecorder
+	isgomock struct{}
 }
 
 // MockOrderDBMockRecorder is the mock recorder for MockOrderDB.
@@ -34,18 +43,61 @@ func (m *MockOrderDB) EXPECT() *MockOrderDBMockRecorder {
 	return m.recorder
 }
 
+// CancelOrder mocks base method.
+func (m *MockOrderDB) CancelOrder(orderID int32, fromStatus, reason, actor string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelOrder", orderID, fromStatus, reason, actor)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelOrder indicates an expected call of CancelOrder.
+func (mr *MockOrderDBMockRecorder) CancelOrder(orderID, fromStatus, reason, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelOrder", reflect.TypeOf((*MockOrderDB)(nil).CancelOrder), orderID, fromStatus, reason, actor)
+}
+
+// ClaimStaleSagas mocks base method.
+func (m *MockOrderDB) ClaimStaleSagas(ctx context.Context, idle time.Duration) ([]*db.SagaState, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimStaleSagas", ctx, idle)
+	ret0, _ := ret[0].([]*db.SagaState)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimStaleSagas indicates an expected call of ClaimStaleSagas.
+func (mr *MockOrderDBMockRecorder) ClaimStaleSagas(ctx, idle any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimStaleSagas", reflect.TypeOf((*MockOrderDB)(nil).ClaimStaleSagas), ctx, idle)
+}
+
 // CreateOrder mocks base method.
-func (m *MockOrderDB) CreateOrder(ctx context.Context, orderID, productID, customerID, quantity int32, pricePerUnit float64) error {
+func (m *MockOrderDB) CreateOrder(ctx context.Context, orderID, customerID int32, lines []db.OrderLine) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateOrder", ctx, orderID, productID, customerID, quantity, pricePerUnit)
+	ret := m.ctrl.Call(m, "CreateOrder", ctx, orderID, customerID, lines)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateOrder indicates an expected call of CreateOrder.
-func (mr *MockOrderDBMockRecorder) CreateOrder(ctx, orderID, productID, customerID, quantity, pricePerUnit any) *gomock.Call {
+func (mr *MockOrderDBMockRecorder) CreateOrder(ctx, orderID, customerID, lines any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockOrderDB)(nil).CreateOrder), ctx, orderID, productID, customerID, quantity, pricePerUnit)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockOrderDB)(nil).CreateOrder), ctx, orderID, customerID, lines)
+}
+
+// CreateSaga mocks base method.
+func (m *MockOrderDB) CreateSaga(ctx context.Context, saga *db.SagaState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSaga", ctx, saga)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSaga indicates an expected call of CreateSaga.
+func (mr *MockOrderDBMockRecorder) CreateSaga(ctx, saga any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSaga", reflect.TypeOf((*MockOrderDB)(nil).CreateSaga), ctx, saga)
 }
 
 // DeleteOrder mocks base method.
@@ -62,19 +114,49 @@ func (mr *MockOrderDBMockRecorder) DeleteOrder(orderID any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOrder", reflect.TypeOf((*MockOrderDB)(nil).DeleteOrder), orderID)
 }
 
+// DeleteOrderRows mocks base method.
+func (m *MockOrderDB) DeleteOrderRows(ctx context.Context, orderID int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOrderRows", ctx, orderID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOrderRows indicates an expected call of DeleteOrderRows.
+func (mr *MockOrderDBMockRecorder) DeleteOrderRows(ctx, orderID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOrderRows", reflect.TypeOf((*MockOrderDB)(nil).DeleteOrderRows), ctx, orderID)
+}
+
 // GetAllOrders mocks base method.
-func (m *MockOrderDB) GetAllOrders() ([]*proto.Order, error) {
+func (m *MockOrderDB) GetAllOrders(ctx context.Context, filter db.OrderFilter) ([]*proto.Order, *db.OrderCursor, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllOrders")
+	ret := m.ctrl.Call(m, "GetAllOrders", ctx, filter)
 	ret0, _ := ret[0].([]*proto.Order)
+	ret1, _ := ret[1].(*db.OrderCursor)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetAllOrders indicates an expected call of GetAllOrders.
+func (mr *MockOrderDBMockRecorder) GetAllOrders(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllOrders", reflect.TypeOf((*MockOrderDB)(nil).GetAllOrders), ctx, filter)
+}
+
+// GetIdempotencyKey mocks base method.
+func (m *MockOrderDB) GetIdempotencyKey(ctx context.Context, key string) (*db.IdempotencyRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotencyKey", ctx, key)
+	ret0, _ := ret[0].(*db.IdempotencyRecord)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllOrders indicates an expected call of GetAllOrders.
-func (mr *MockOrderDBMockRecorder) GetAllOrders() *gomock.Call {
+// GetIdempotencyKey indicates an expected call of GetIdempotencyKey.
+func (mr *MockOrderDBMockRecorder) GetIdempotencyKey(ctx, key any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllOrders", reflect.TypeOf((*MockOrderDB)(nil).GetAllOrders))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotencyKey", reflect.TypeOf((*MockOrderDB)(nil).GetIdempotencyKey), ctx, key)
 }
 
 // GetNextOrderID mocks base method.
@@ -106,33 +188,88 @@ func (mr *MockOrderDBMockRecorder) GetOrderByID(orderID any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderByID", reflect.TypeOf((*MockOrderDB)(nil).GetOrderByID), orderID)
 }
 
-// GetProductByID mocks base method.
-func (m *MockOrderDB) GetProductByID(productID int32) (string, int, float64, error) {
+// GetPendingEvents mocks base method.
+func (m *MockOrderDB) GetPendingEvents(ctx context.Context, limit int) ([]*db.Event, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetProductByID", productID)
-	ret0, _ := ret[0].(string)
-	ret1, _ := ret[1].(int)
-	ret2, _ := ret[2].(float64)
-	ret3, _ := ret[3].(error)
-	return ret0, ret1, ret2, ret3
+	ret := m.ctrl.Call(m, "GetPendingEvents", ctx, limit)
+	ret0, _ := ret[0].([]*db.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// GetProductByID indicates an expected call of GetProductByID.
-func (mr *MockOrderDBMockRecorder) GetProductByID(productID any) *gomock.Call {
+// GetPendingEvents indicates an expected call of GetPendingEvents.
+func (mr *MockOrderDBMockRecorder) GetPendingEvents(ctx, limit any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductByID", reflect.TypeOf((*MockOrderDB)(nil).GetProductByID), productID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingEvents", reflect.TypeOf((*MockOrderDB)(nil).GetPendingEvents), ctx, limit)
+}
+
+// MarkEventDelivered mocks base method.
+func (m *MockOrderDB) MarkEventDelivered(ctx context.Context, eventID int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEventDelivered", ctx, eventID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEventDelivered indicates an expected call of MarkEventDelivered.
+func (mr *MockOrderDBMockRecorder) MarkEventDelivered(ctx, eventID any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEventDelivered", reflect.TypeOf((*MockOrderDB)(nil).MarkEventDelivered), ctx, eventID)
+}
+
+// MarkEventFailed mocks base method.
+func (m *MockOrderDB) MarkEventFailed(ctx context.Context, eventID int64, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkEventFailed", ctx, eventID, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkEventFailed indicates an expected call of MarkEventFailed.
+func (mr *MockOrderDBMockRecorder) MarkEventFailed(ctx, eventID, reason any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkEventFailed", reflect.TypeOf((*MockOrderDB)(nil).MarkEventFailed), ctx, eventID, reason)
+}
+
+// PurgeIdempotencyKeys mocks base method.
+func (m *MockOrderDB) PurgeIdempotencyKeys(ctx context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeIdempotencyKeys", ctx)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeIdempotencyKeys indicates an expected call of PurgeIdempotencyKeys.
+func (mr *MockOrderDBMockRecorder) PurgeIdempotencyKeys(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeIdempotencyKeys", reflect.TypeOf((*MockOrderDB)(nil).PurgeIdempotencyKeys), ctx)
 }
 
 // UpdateOrder mocks base method.
-func (m *MockOrderDB) UpdateOrder(orderID int32, status string) error {
+func (m *MockOrderDB) UpdateOrder(orderID int32, fromStatus, toStatus, actor string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrder", orderID, status)
+	ret := m.ctrl.Call(m, "UpdateOrder", orderID, fromStatus, toStatus, actor)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateOrder indicates an expected call of UpdateOrder.
-func (mr *MockOrderDBMockRecorder) UpdateOrder(orderID, status any) *gomock.Call {
+func (mr *MockOrderDBMockRecorder) UpdateOrder(orderID, fromStatus, toStatus, actor any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockOrderDB)(nil).UpdateOrder), orderID, fromStatus, toStatus, actor)
+}
+
+// UpdateSaga mocks base method.
+func (m *MockOrderDB) UpdateSaga(ctx context.Context, saga *db.SagaState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateSaga", ctx, saga)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSaga indicates an expected call of UpdateSaga.
+func (mr *MockOrderDBMockRecorder) UpdateSaga(ctx, saga any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockOrderDB)(nil).UpdateOrder), orderID, status)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateSaga", reflect.TypeOf((*MockOrderDB)(nil).UpdateSaga), ctx, saga)
 }
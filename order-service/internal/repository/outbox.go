@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Типы событий заказа
+const (
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventOrderCancelled     = "order.cancelled"
+	EventOrderDeleted       = "order.deleted"
+)
+
+// Event событие из таблицы OrderOutbox
+type Event struct {
+	ID        int64           `json:"event_id"`
+	OrderID   int32           `json:"order_id"`
+	Type      string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// OrderCreatedPayload данные события order.created
+type OrderCreatedPayload struct {
+	OrderID    int32       `json:"order_id"`
+	CustomerID int32       `json:"customer_id"`
+	Items      []OrderLine `json:"items"`
+}
+
+// OrderStatusChangedPayload данные события order.status_changed
+type OrderStatusChangedPayload struct {
+	OrderID    int32  `json:"order_id"`
+	FromStatus string `json:"from_status"`
+	Status     string `json:"status"`
+	Actor      string `json:"actor"`
+}
+
+// OrderCancelledPayload данные события order.cancelled
+type OrderCancelledPayload struct {
+	OrderID    int32  `json:"order_id"`
+	FromStatus string `json:"from_status"`
+	Reason     string `json:"reason"`
+	Actor      string `json:"actor"`
+}
+
+// OrderDeletedPayload данные события order.deleted
+type OrderDeletedPayload struct {
+	OrderID int32  `json:"order_id"`
+	Reason  string `json:"reason"`
+}
+
+// insertEvent записывает событие в outbox в рамках транзакции изменения заказа
+func insertEvent(ctx context.Context, tx pgx.Tx, orderID int32, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO OrderOutbox (OrderID, EventType, Payload)
+        VALUES ($1, $2, $3)`,
+		orderID, eventType, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", eventType, err)
+	}
+	return nil
+}
+
+// GetPendingEvents возвращает до limit неопубликованных событий в порядке записи
+func (db *orderDB) GetPendingEvents(ctx context.Context, limit int) ([]*Event, error) {
+	rows, err := db.conn.Query(ctx, `
+        SELECT EventID, OrderID, EventType, Payload, CreatedAt
+        FROM OrderOutbox
+        WHERE DeliveredAt IS NULL
+        ORDER BY EventID
+        LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*Event
+	for rows.Next() {
+		var event Event
+		var payload []byte
+		err := rows.Scan(&event.ID, &event.OrderID, &event.Type, &payload, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.Payload = payload
+		events = append(events, &event)
+	}
+
+	return events, rows.Err()
+}
+
+// MarkEventDelivered отмечает событие опубликованным
+func (db *orderDB) MarkEventDelivered(ctx context.Context, eventID int64) error {
+	_, err := db.conn.Exec(ctx, `
+        UPDATE OrderOutbox
+        SET DeliveredAt = CURRENT_TIMESTAMP, Attempts = Attempts + 1, LastError = NULL
+        WHERE EventID = $1`,
+		eventID,
+	)
+	return err
+}
+
+// MarkEventFailed сохраняет неудачную попытку публикации
+func (db *orderDB) MarkEventFailed(ctx context.Context, eventID int64, reason string) error {
+	_, err := db.conn.Exec(ctx, `
+        UPDATE OrderOutbox
+        SET Attempts = Attempts + 1, LastError = $2
+        WHERE EventID = $1`,
+		eventID, reason,
+	)
+	return err
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"store/proto"
+	"time"
+)
+
+// Статусы саги
+const (
+	SagaRunning      = "running"
+	SagaCompensating = "compensating"
+	SagaCompleted    = "completed"
+	SagaCompensated  = "compensated"
+)
+
+// SagaState сохраненное состояние саги создания заказа
+type SagaState struct {
+	OrderID       int32
+	CustomerID    int32
+	Lines         []OrderLine
+	ReservationID int32 // 0, пока резерв не создан
+	Step          string
+	Status        string
+	Error         string
+	// IdempotencyKey и RequestHash сохраняются вместе с сагой, если клиент передал ключ
+	IdempotencyKey string
+	RequestHash    string
+	// Allocation - как выбирать склады при резерве. Не сохраняется: после рестарта
+	// сага с шага started не продолжается, а откатывается
+	Allocation *proto.Allocation
+}
+
+// CreateSaga сохраняет новую сагу. Ключ идемпотентности записывается в той же
+// транзакции, поэтому по ключу всегда можно найти сагу и ее результат
+func (db *orderDB) CreateSaga(ctx context.Context, saga *SagaState) error {
+	lines, err := json.Marshal(saga.Lines)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga items: %w", err)
+	}
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO OrderSagas (OrderID, CustomerID, Items, ReservationID, Step, Status, Error)
+        VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, NULLIF($7, ''))`,
+		saga.OrderID, saga.CustomerID, lines, saga.ReservationID, saga.Step, saga.Status, saga.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create saga: %w", err)
+	}
+
+	if saga.IdempotencyKey != "" {
+		if err := claimIdempotencyKey(ctx, tx, saga.IdempotencyKey, saga.RequestHash, saga.OrderID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UpdateSaga сохраняет текущий шаг и статус саги. Строки заказа перезаписываются:
+// после резерва в них появляются склады, по ним откат вернет товар
+func (db *orderDB) UpdateSaga(ctx context.Context, saga *SagaState) error {
+	lines, err := json.Marshal(saga.Lines)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga items: %w", err)
+	}
+
+	_, err = db.conn.Exec(ctx, `
+        UPDATE OrderSagas
+        SET ReservationID = NULLIF($2, 0),
+            Step = $3,
+            Status = $4,
+            Error = NULLIF($5, ''),
+            Items = $6,
+            UpdatedAt = CURRENT_TIMESTAMP
+        WHERE OrderID = $1`,
+		saga.OrderID, saga.ReservationID, saga.Step, saga.Status, saga.Error, lines,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update saga: %w", err)
+	}
+	return nil
+}
+
+// ClaimStaleSagas забирает на восстановление саги в статусах running и compensating,
+// которые не обновлялись дольше idle. UpdatedAt служит пульсом саги: он обновляется
+// на каждом шаге, а при захвате сдвигается на текущий момент, поэтому другая реплика
+// не заберет сагу повторно, пока она восстанавливается. Строки, заблокированные
+// другой транзакцией, пропускаются
+func (db *orderDB) ClaimStaleSagas(ctx context.Context, idle time.Duration) ([]*SagaState, error) {
+	rows, err := db.conn.Query(ctx, `
+        UPDATE OrderSagas s
+        SET UpdatedAt = CURRENT_TIMESTAMP
+        FROM (
+            SELECT OrderID
+            FROM OrderSagas
+            WHERE Status IN ($1, $2)
+              AND UpdatedAt < CURRENT_TIMESTAMP - make_interval(secs => $3)
+            ORDER BY OrderID
+            FOR UPDATE SKIP LOCKED
+        ) stale
+        WHERE s.OrderID = stale.OrderID
+        RETURNING s.OrderID, s.CustomerID, s.Items, COALESCE(s.ReservationID, 0), s.Step, s.Status, COALESCE(s.Error, '')`,
+		SagaRunning, SagaCompensating, idle.Seconds(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sagas []*SagaState
+	for rows.Next() {
+		var saga SagaState
+		var lines []byte
+		err := rows.Scan(
+			&saga.OrderID,
+			&saga.CustomerID,
+			&lines,
+			&saga.ReservationID,
+			&saga.Step,
+			&saga.Status,
+			&saga.Error,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(lines, &saga.Lines); err != nil {
+			return nil, fmt.Errorf("failed to decode saga %d items: %w", saga.OrderID, err)
+		}
+		sagas = append(sagas, &saga)
+	}
+
+	return sagas, rows.Err()
+}
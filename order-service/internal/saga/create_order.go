@@ -0,0 +1,317 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"store/order-service/internal/client"
+	db "store/order-service/internal/repository"
+	"store/proto"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Шаги саги создания заказа. Шаг сохраняется после успешного выполнения,
+// поэтому по нему видно, какие действия нужно компенсировать
+const (
+	StepStarted       = "started"        // Сага сохранена, товар еще не зарезервирован
+	StepStockReserved = "stock_reserved" // Товар зарезервирован в catalog-service
+	StepOrderInserted = "order_inserted" // Строки заказа записаны в Orders
+	StepCompleted     = "completed"      // Резерв подтвержден, заказ создан
+)
+
+// reservationTTL сколько catalog-service держит резерв неподтвержденным.
+// Если order-service упадет до подтверждения, товар вернется на склад сам
+const reservationTTL = 5 * time.Minute
+
+// staleSagaAfter через сколько без движения сага считается брошенной упавшей репликой.
+// Живая сага обновляется на каждом шаге, а порог заметно меньше reservationTTL,
+// чтобы у восстановленной саги резерв еще не истек и его можно было подтвердить
+const staleSagaAfter = reservationTTL / 3
+
+// CreateOrderSaga оркестрирует создание заказа:
+// резерв товара -> запись строк заказа -> подтверждение резерва.
+// При ошибке на любом шаге выполненные шаги компенсируются в обратном порядке
+type CreateOrderSaga struct {
+	db      db.OrderDB
+	catalog client.CatalogClient
+}
+
+// NewCreateOrderSaga создает оркестратор саги
+func NewCreateOrderSaga(db db.OrderDB, catalog client.CatalogClient) *CreateOrderSaga {
+	return &CreateOrderSaga{db: db, catalog: catalog}
+}
+
+// Execute создает заказ и возвращает его ID. allocation задает, как catalog-service
+// выбирает склады (nil - по приоритету). Если idempotencyKey не пустой,
+// ключ сохраняется вместе с сагой; занятый ключ возвращает db.ErrIdempotencyKeyInUse
+func (s *CreateOrderSaga) Execute(ctx context.Context, customerID int32, items []*proto.OrderItem, allocation *proto.Allocation, idempotencyKey, requestHash string) (int32, error) {
+	// Генерируем новый OrderID
+	var orderID int32
+	if err := s.db.GetNextOrderID(ctx, &orderID); err != nil {
+		return 0, fmt.Errorf("failed to generate order id: %w", err)
+	}
+
+	// Фиксируем цены до начала саги: этот шаг ничего не меняет и не требует компенсации.
+	// Товары заказа запрашиваются у каталога одним вызовом, варианты по артикулам - еще одним
+	products, bySKU, err := s.lookupProducts(items)
+	if err != nil {
+		return 0, err
+	}
+
+	lines := make([]db.OrderLine, 0, len(items))
+	ordered := make(map[int32]bool, len(items))
+	for _, item := range items {
+		product := products[item.ProductId]
+		if item.Sku != "" {
+			product = bySKU[item.Sku]
+			if item.ProductId != 0 && item.ProductId != product.ProductId {
+				return 0, status.Errorf(codes.InvalidArgument, "Артикул %s не относится к товару %d", item.Sku, item.ProductId)
+			}
+		}
+		if len(product.Variants) > 0 {
+			return 0, status.Errorf(codes.InvalidArgument, "Товар %d продается вариантами, укажите sku", product.ProductId)
+		}
+		// Одна позиция на товар: вариант мог быть указан и по ID, и по артикулу
+		if ordered[product.ProductId] {
+			return 0, status.Errorf(codes.InvalidArgument, "Товар %d указан в заказе несколько раз", product.ProductId)
+		}
+		ordered[product.ProductId] = true
+		// Сумма заказа считается в одной валюте
+		if len(lines) > 0 && lines[0].PricePerUnit.CurrencyCode != product.Price.CurrencyCode {
+			return 0, status.Errorf(codes.InvalidArgument, "Товары в заказе должны продаваться в одной валюте")
+		}
+		lines = append(lines, db.OrderLine{
+			ProductID:    product.ProductId,
+			SKU:          product.Sku,
+			ProductName:  product.ProductName,
+			Quantity:     item.Quantity,
+			PricePerUnit: product.Price,
+		})
+	}
+
+	state := &db.SagaState{
+		OrderID:    orderID,
+		CustomerID: customerID,
+		Lines:      lines,
+		Step:       StepStarted,
+		Status:     db.SagaRunning,
+
+		IdempotencyKey: idempotencyKey,
+		RequestHash:    requestHash,
+		Allocation:     allocation,
+	}
+	if err := s.db.CreateSaga(ctx, state); err != nil {
+		return 0, err
+	}
+
+	if err := s.run(ctx, state); err != nil {
+		return 0, err
+	}
+	return orderID, nil
+}
+
+// lookupProducts получает из каталога товары заказа: по ID и, если в заказе
+// есть артикулы, по артикулам. Отсутствующие товары - ошибка NotFound
+func (s *CreateOrderSaga) lookupProducts(items []*proto.OrderItem) (map[int32]*proto.Product, map[string]*proto.Product, error) {
+	var productIDs []int32
+	var skus []string
+	for _, item := range items {
+		if item.Sku != "" {
+			skus = append(skus, item.Sku)
+		} else {
+			productIDs = append(productIDs, item.ProductId)
+		}
+	}
+
+	var products map[int32]*proto.Product
+	var missing []string
+	if len(productIDs) > 0 {
+		var missingIDs []int32
+		var err error
+		products, missingIDs, err = s.catalog.GetProductsByIDs(productIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(missingIDs) > 0 {
+			missing = append(missing, joinIDs(missingIDs))
+		}
+	}
+
+	var bySKU map[string]*proto.Product
+	if len(skus) > 0 {
+		var missingSKUs []string
+		var err error
+		bySKU, missingSKUs, err = s.catalog.GetProductsBySKUs(skus)
+		if err != nil {
+			return nil, nil, err
+		}
+		missing = append(missing, missingSKUs...)
+	}
+
+	if len(missing) > 0 {
+		return nil, nil, status.Errorf(codes.NotFound, "Товары не найдены в каталоге: %s", strings.Join(missing, ", "))
+	}
+	return products, bySKU, nil
+}
+
+// joinIDs перечисляет ID через запятую для сообщений об ошибках
+func joinIDs(ids []int32) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(int(id))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Recover доводит до конца саги, прерванные падением order-service.
+// Сага, успевшая записать заказ, продолжается; остальные откатываются.
+// Забираются только саги, которые не двигались дольше staleSagaAfter: саги,
+// которые сейчас выполняет живая реплика, не трогаются, а резерв брошенной саги
+// еще действует, и заказ, который она успела записать, подтверждается
+func (s *CreateOrderSaga) Recover(ctx context.Context) error {
+	sagas, err := s.db.ClaimStaleSagas(ctx, staleSagaAfter)
+	if err != nil {
+		return fmt.Errorf("failed to load unfinished sagas: %w", err)
+	}
+
+	for _, state := range sagas {
+		log.Printf("Восстановление саги заказа %d: шаг %s, статус %s", state.OrderID, state.Step, state.Status)
+
+		if state.Status == db.SagaRunning && state.Step == StepOrderInserted {
+			err = s.run(ctx, state)
+		} else {
+			err = s.compensate(ctx, state, fmt.Errorf("saga interrupted at step %s", state.Step))
+		}
+		if err != nil {
+			log.Printf("Сага заказа %d не завершена: %v", state.OrderID, err)
+		}
+	}
+	return nil
+}
+
+// run выполняет шаги, начиная со следующего после сохраненного
+func (s *CreateOrderSaga) run(ctx context.Context, state *db.SagaState) error {
+	for {
+		switch state.Step {
+		case StepStarted:
+			items := make([]*proto.OrderItem, 0, len(state.Lines))
+			for _, line := range state.Lines {
+				items = append(items, &proto.OrderItem{ProductId: line.ProductID, Quantity: line.Quantity})
+			}
+			reservationID, warehouses, err := s.catalog.CreateReservation(state.OrderID, items, state.Allocation, reservationTTL)
+			if err != nil {
+				return s.compensate(ctx, state, err)
+			}
+			state.ReservationID = reservationID
+			// Склад позиции попадает в заказ и в сагу: по нему товар вернется при отмене
+			for i := range state.Lines {
+				state.Lines[i].WarehouseID = warehouses[state.Lines[i].ProductID]
+			}
+			if err := s.advance(ctx, state, StepStockReserved); err != nil {
+				return s.compensate(ctx, state, err)
+			}
+
+		case StepStockReserved:
+			if err := s.db.CreateOrder(ctx, state.OrderID, state.CustomerID, state.Lines); err != nil {
+				return s.compensate(ctx, state, err)
+			}
+			if err := s.advance(ctx, state, StepOrderInserted); err != nil {
+				// Строки уже записаны: отмечаем шаг в памяти, чтобы компенсация их удалила
+				state.Step = StepOrderInserted
+				return s.compensate(ctx, state, err)
+			}
+
+		case StepOrderInserted:
+			if err := s.catalog.CommitReservation(state.ReservationID); err != nil {
+				return s.compensate(ctx, state, err)
+			}
+			state.Step = StepCompleted
+			state.Status = db.SagaCompleted
+			if err := s.db.UpdateSaga(ctx, state); err != nil {
+				// Заказ уже создан, сага будет просто перепроверена при следующем старте
+				log.Printf("Ошибка при сохранении завершения саги заказа %d: %v", state.OrderID, err)
+			}
+			log.Printf("Сага заказа %d завершена", state.OrderID)
+			return nil
+
+		default:
+			return fmt.Errorf("unknown saga step %q", state.Step)
+		}
+	}
+}
+
+// advance сохраняет переход к следующему шагу
+func (s *CreateOrderSaga) advance(ctx context.Context, state *db.SagaState, step string) error {
+	state.Step = step
+	return s.db.UpdateSaga(ctx, state)
+}
+
+// compensate откатывает выполненные шаги в обратном порядке и возвращает
+// исходную ошибку. Если компенсация не удалась, сага остается в статусе
+// compensating и будет повторена при следующем старте
+func (s *CreateOrderSaga) compensate(ctx context.Context, state *db.SagaState, cause error) error {
+	log.Printf("Откат саги заказа %d с шага %s: %v", state.OrderID, state.Step, cause)
+
+	state.Status = db.SagaCompensating
+	state.Error = cause.Error()
+	if err := s.db.UpdateSaga(ctx, state); err != nil {
+		log.Printf("Ошибка при сохранении статуса саги заказа %d: %v", state.OrderID, err)
+	}
+
+	if err := s.undo(ctx, state); err != nil {
+		log.Printf("Ошибка при откате саги заказа %d: %v", state.OrderID, err)
+		return cause
+	}
+
+	state.Status = db.SagaCompensated
+	if err := s.db.UpdateSaga(ctx, state); err != nil {
+		log.Printf("Ошибка при сохранении статуса саги заказа %d: %v", state.OrderID, err)
+	}
+	return cause
+}
+
+// undo выполняет компенсирующие действия для всех пройденных шагов
+func (s *CreateOrderSaga) undo(ctx context.Context, state *db.SagaState) error {
+	switch state.Step {
+	case StepOrderInserted, StepCompleted:
+		// Удаляем записанные строки заказа
+		if err := s.db.DeleteOrderRows(ctx, state.OrderID); err != nil {
+			return fmt.Errorf("failed to delete order rows: %w", err)
+		}
+		fallthrough
+
+	case StepStockReserved:
+		// Возвращаем товар на склад
+		if err := s.restoreStock(state); err != nil {
+			return err
+		}
+
+	case StepStarted:
+		// Резерв мог быть создан, но его ID не успели сохранить:
+		// такой резерв снимется в catalog-service по TTL
+	}
+	return nil
+}
+
+// restoreStock отменяет резерв. Если резерв уже подтвержден
+// (ответ на подтверждение потерялся), товар возвращается поштучно
+// с ключом операции, поэтому повторный откат не вернет товар дважды
+func (s *CreateOrderSaga) restoreStock(state *db.SagaState) error {
+	err := s.catalog.CancelReservation(state.ReservationID)
+	if status.Code(err) != codes.FailedPrecondition {
+		return err
+	}
+
+	for _, line := range state.Lines {
+		operationID := fmt.Sprintf("order-%d-compensate-%d", state.OrderID, line.ProductID)
+		if err := s.catalog.ReleaseStock(state.OrderID, line.ProductID, line.WarehouseID, line.Quantity, operationID); err != nil {
+			return fmt.Errorf("failed to release stock for product %d: %w", line.ProductID, err)
+		}
+	}
+	return nil
+}
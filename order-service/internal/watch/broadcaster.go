@@ -0,0 +1,83 @@
+package watch
+
+import (
+	"store/proto"
+	"sync"
+)
+
+// Broadcaster рассылает новые состояния заказов подписчикам внутри процесса.
+// Публикация не блокируется: если подписчик не успевает читать,
+// из его буфера вытесняется самое старое состояние - последнее всегда доходит
+type Broadcaster struct {
+	mu          sync.Mutex
+	buffer      int
+	subscribers map[int32]map[chan *proto.Order]struct{}
+}
+
+// NewBroadcaster создает рассыльщик с буфером на buffer состояний для каждого подписчика
+func NewBroadcaster(buffer int) *Broadcaster {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Broadcaster{
+		buffer:      buffer,
+		subscribers: make(map[int32]map[chan *proto.Order]struct{}),
+	}
+}
+
+// Subscribe подписывает на изменения заказа orderID. Возвращенную функцию
+// нужно вызвать, когда подписка больше не нужна: она закрывает канал
+func (b *Broadcaster) Subscribe(orderID int32) (<-chan *proto.Order, func()) {
+	ch := make(chan *proto.Order, b.buffer)
+
+	b.mu.Lock()
+	if b.subscribers[orderID] == nil {
+		b.subscribers[orderID] = make(map[chan *proto.Order]struct{})
+	}
+	b.subscribers[orderID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[orderID], ch)
+			if len(b.subscribers[orderID]) == 0 {
+				delete(b.subscribers, orderID)
+			}
+			close(ch)
+		})
+	}
+}
+
+// HasSubscribers сообщает, следит ли кто-нибудь за заказом orderID
+func (b *Broadcaster) HasSubscribers(orderID int32) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers[orderID]) > 0
+}
+
+// Publish отправляет состояние заказа всем его подписчикам.
+// Подписчики получают один и тот же объект и не должны его изменять
+func (b *Broadcaster) Publish(order *proto.Order) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[order.OrderId] {
+		select {
+		case ch <- order:
+			continue
+		default:
+		}
+		// Буфер полон: вытесняем самое старое состояние
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- order:
+		default:
+		}
+	}
+}
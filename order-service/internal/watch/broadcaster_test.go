@@ -0,0 +1,56 @@
+package watch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"store/proto"
+)
+
+func TestBroadcaster_DeliversToOrderSubscribers(t *testing.T) {
+	b := NewBroadcaster(4)
+
+	first, unsubscribeFirst := b.Subscribe(1)
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := b.Subscribe(1)
+	defer unsubscribeSecond()
+	other, unsubscribeOther := b.Subscribe(2)
+	defer unsubscribeOther()
+
+	order := &proto.Order{OrderId: 1, Status: "paid"}
+	b.Publish(order)
+
+	assert.Equal(t, order, <-first)
+	assert.Equal(t, order, <-second)
+	assert.Empty(t, other)
+}
+
+func TestBroadcaster_SlowSubscriberGetsLatest(t *testing.T) {
+	b := NewBroadcaster(2)
+
+	updates, unsubscribe := b.Subscribe(1)
+	defer unsubscribe()
+
+	// Публикация не блокируется, даже если подписчик ничего не читает
+	for _, status := range []string{"pending", "paid", "shipped"} {
+		b.Publish(&proto.Order{OrderId: 1, Status: status})
+	}
+
+	assert.Equal(t, "paid", (<-updates).Status)
+	assert.Equal(t, "shipped", (<-updates).Status)
+}
+
+func TestBroadcaster_Unsubscribe(t *testing.T) {
+	b := NewBroadcaster(1)
+
+	updates, unsubscribe := b.Subscribe(1)
+	assert.True(t, b.HasSubscribers(1))
+
+	unsubscribe()
+	unsubscribe()
+	b.Publish(&proto.Order{OrderId: 1})
+
+	_, open := <-updates
+	assert.False(t, open)
+	assert.False(t, b.HasSubscribers(1))
+}
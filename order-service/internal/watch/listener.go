@@ -0,0 +1,89 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"log"
+	db "store/order-service/internal/repository"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Listener получает из Postgres (LISTEN/NOTIFY) уведомления об изменении статуса,
+// сделанные любой репликой order-service, и передает новые состояния в Broadcaster
+type Listener struct {
+	pool        *pgxpool.Pool
+	db          db.OrderDB
+	broadcaster *Broadcaster
+	retry       time.Duration
+}
+
+// NewListener создает слушателя; после обрыва соединения он переподключается через retry
+func NewListener(pool *pgxpool.Pool, orderDB db.OrderDB, broadcaster *Broadcaster, retry time.Duration) *Listener {
+	return &Listener{
+		pool:        pool,
+		db:          orderDB,
+		broadcaster: broadcaster,
+		retry:       retry,
+	}
+}
+
+// Run слушает уведомления до отмены ctx
+func (l *Listener) Run(ctx context.Context) {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Ошибка при получении уведомлений об изменении заказов: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(l.retry):
+		}
+	}
+}
+
+// listen держит отдельное соединение с подпиской на канал уведомлений.
+// Соединение забирается из пула насовсем, чтобы LISTEN не достался другим запросам
+func (l *Listener) listen(ctx context.Context) error {
+	pooled, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+db.StatusChangedChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		orderID, err := strconv.ParseInt(notification.Payload, 10, 32)
+		if err != nil {
+			log.Printf("Некорректное уведомление об изменении заказа: %q", notification.Payload)
+			continue
+		}
+		if !l.broadcaster.HasSubscribers(int32(orderID)) {
+			continue
+		}
+
+		order, err := l.db.GetOrderByID(int32(orderID))
+		if errors.Is(err, db.ErrOrderNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Ошибка при получении заказа %d: %v", orderID, err)
+			continue
+		}
+		l.broadcaster.Publish(order)
+	}
+}
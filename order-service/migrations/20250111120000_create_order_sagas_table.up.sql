@@ -0,0 +1,15 @@
+-- Состояние саги создания заказа: по нему прерванная сага
+-- продолжается или откатывается при старте order-service
+CREATE TABLE OrderSagas (
+    OrderID         INT             PRIMARY KEY,
+    CustomerID      INT             NOT NULL,
+    Items           JSONB           NOT NULL,
+    ReservationID   INT,
+    Step            VARCHAR(50)     NOT NULL,
+    Status          VARCHAR(20)     NOT NULL,
+    Error           TEXT,
+    CreatedAt       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    UpdatedAt       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_sagas_status_idx ON OrderSagas (Status);
@@ -0,0 +1,14 @@
+-- События заказов, записываемые в одной транзакции с изменением заказа.
+-- Ретранслятор публикует их и проставляет DeliveredAt
+CREATE TABLE OrderOutbox (
+    EventID         BIGSERIAL       PRIMARY KEY,
+    OrderID         INT             NOT NULL,
+    EventType       VARCHAR(50)     NOT NULL,
+    Payload         JSONB           NOT NULL,
+    CreatedAt       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    DeliveredAt     TIMESTAMP,
+    Attempts        INT             NOT NULL    DEFAULT 0,
+    LastError       TEXT
+);
+
+CREATE INDEX order_outbox_pending_idx ON OrderOutbox (EventID) WHERE DeliveredAt IS NULL;
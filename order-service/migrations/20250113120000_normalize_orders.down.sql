@@ -0,0 +1,23 @@
+-- Возвращаем одну таблицу Orders со строкой на каждый товар заказа.
+-- Заказы без позиций в старой схеме представить нельзя, они теряются
+CREATE TABLE Orders_Flat (
+    OrderID         INT             NOT NULL    DEFAULT nextval('orders_orderid_seq'),
+    ProductID       INT             NOT NULL,
+    CustomerID      INT             NOT NULL,
+    Quantity        INT             NOT NULL,
+    PricePerUnit    NUMERIC(10, 2)  NOT NULL,
+    OrderDate       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    Status          VARCHAR(50)                 DEFAULT 'в обработке',
+    CONSTRAINT orders_flat_pkey PRIMARY KEY (OrderID, ProductID)
+);
+
+INSERT INTO Orders_Flat (OrderID, ProductID, CustomerID, Quantity, PricePerUnit, OrderDate, Status)
+SELECT i.OrderID, i.ProductID, o.CustomerID, i.Quantity, i.PricePerUnit, o.OrderDate, o.Status
+FROM OrderItems i
+JOIN Orders o ON o.OrderID = i.OrderID;
+
+DROP TABLE OrderItems;
+DROP TABLE Orders;
+
+ALTER TABLE Orders_Flat RENAME TO Orders;
+ALTER TABLE Orders RENAME CONSTRAINT orders_flat_pkey TO orders_pkey;
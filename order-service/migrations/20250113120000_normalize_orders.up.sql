@@ -0,0 +1,31 @@
+-- Разделяем Orders на заголовок заказа и позиции заказа.
+-- Старая таблица переименовывается, данные переносятся, затем она удаляется
+ALTER TABLE Orders RENAME TO Orders_Flat;
+ALTER TABLE Orders_Flat RENAME CONSTRAINT orders_pkey TO orders_flat_pkey;
+
+CREATE TABLE Orders (
+    OrderID         INT             PRIMARY KEY DEFAULT nextval('orders_orderid_seq'),
+    CustomerID      INT             NOT NULL,
+    OrderDate       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP,
+    Status          VARCHAR(50)     NOT NULL    DEFAULT 'в обработке'
+);
+
+CREATE TABLE OrderItems (
+    OrderID         INT             NOT NULL    REFERENCES Orders (OrderID) ON DELETE CASCADE,
+    ProductID       INT             NOT NULL,
+    Quantity        INT             NOT NULL,
+    PricePerUnit    NUMERIC(10, 2)  NOT NULL,
+    PRIMARY KEY (OrderID, ProductID)
+);
+
+-- Заголовок берется из самой ранней строки заказа
+INSERT INTO Orders (OrderID, CustomerID, OrderDate, Status)
+SELECT DISTINCT ON (OrderID) OrderID, CustomerID, OrderDate, COALESCE(Status, 'в обработке')
+FROM Orders_Flat
+ORDER BY OrderID, OrderDate;
+
+INSERT INTO OrderItems (OrderID, ProductID, Quantity, PricePerUnit)
+SELECT OrderID, ProductID, Quantity, PricePerUnit
+FROM Orders_Flat;
+
+DROP TABLE Orders_Flat;
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS OrderStatusHistory;
+
+ALTER TABLE Orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE Orders ALTER COLUMN Status SET DEFAULT 'в обработке';
+
+-- Возвращаем строковые статусы в нижнем регистре, как 'в обработке' до миграции
+UPDATE Orders
+SET Status = CASE Status
+    WHEN 'paid'      THEN 'оплачен'
+    WHEN 'shipped'   THEN 'отправлен'
+    WHEN 'delivered' THEN 'выполнен'
+    WHEN 'cancelled' THEN 'отменен'
+    ELSE 'в обработке'
+END;
@@ -0,0 +1,27 @@
+-- Переводим свободные строковые статусы в коды машины состояний
+UPDATE Orders
+SET Status = CASE lower(Status)
+    WHEN 'оплачен'   THEN 'paid'
+    WHEN 'отправлен' THEN 'shipped'
+    WHEN 'выполнен'  THEN 'delivered'
+    WHEN 'доставлен' THEN 'delivered'
+    WHEN 'отменен'   THEN 'cancelled'
+    ELSE 'pending'
+END
+WHERE Status NOT IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled');
+
+ALTER TABLE Orders ALTER COLUMN Status SET DEFAULT 'pending';
+ALTER TABLE Orders ADD CONSTRAINT orders_status_check
+    CHECK (Status IN ('pending', 'paid', 'shipped', 'delivered', 'cancelled'));
+
+-- История переходов статуса заказа
+CREATE TABLE OrderStatusHistory (
+    HistoryID       BIGSERIAL       PRIMARY KEY,
+    OrderID         INT             NOT NULL    REFERENCES Orders (OrderID) ON DELETE CASCADE,
+    FromStatus      VARCHAR(50),
+    ToStatus        VARCHAR(50)     NOT NULL,
+    Actor           VARCHAR(255)    NOT NULL,
+    ChangedAt       TIMESTAMP       NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX order_status_history_order_idx ON OrderStatusHistory (OrderID, ChangedAt);
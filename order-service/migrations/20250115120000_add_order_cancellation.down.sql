@@ -0,0 +1,2 @@
+ALTER TABLE Orders DROP COLUMN IF EXISTS CancelledAt;
+ALTER TABLE Orders DROP COLUMN IF EXISTS CancellationReason;
@@ -0,0 +1,2 @@
+ALTER TABLE Orders ADD COLUMN CancellationReason TEXT;
+ALTER TABLE Orders ADD COLUMN CancelledAt TIMESTAMP;
@@ -0,0 +1,9 @@
+-- Ключи идемпотентности CreateOrder. Результат запроса берется из саги заказа OrderID
+CREATE TABLE IdempotencyKeys (
+    IdempotencyKey  VARCHAR(255)          PRIMARY KEY,
+    RequestHash     VARCHAR(64)           NOT NULL,
+    OrderID         INT                   NOT NULL,
+    CreatedAt       TIMESTAMP             NOT NULL    DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_idempotencykeys_createdat ON IdempotencyKeys (CreatedAt);
@@ -0,0 +1,2 @@
+-- Валюта зафиксированной цены позиции заказа
+ALTER TABLE OrderItems ADD COLUMN Currency CHAR(3) NOT NULL DEFAULT 'RUB';
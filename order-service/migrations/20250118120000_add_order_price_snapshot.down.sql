@@ -0,0 +1,6 @@
+ALTER TABLE Orders
+    DROP COLUMN IF EXISTS TaxTotal,
+    DROP COLUMN IF EXISTS DiscountTotal,
+    DROP COLUMN IF EXISTS Currency;
+
+ALTER TABLE OrderItems DROP COLUMN IF EXISTS ProductName;
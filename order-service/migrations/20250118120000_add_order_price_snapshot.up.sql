@@ -0,0 +1,14 @@
+-- Снимок товара в позиции заказа и итоги заказа.
+-- Итоги читаются из заказа, а не из текущих цен каталога
+ALTER TABLE OrderItems ADD COLUMN ProductName VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE Orders
+    ADD COLUMN Currency         CHAR(3)         NOT NULL    DEFAULT 'RUB',
+    ADD COLUMN DiscountTotal    NUMERIC(10, 2)  NOT NULL    DEFAULT 0,
+    ADD COLUMN TaxTotal         NUMERIC(10, 2)  NOT NULL    DEFAULT 0;
+
+-- Валюта существующих заказов берется из их позиций
+UPDATE Orders o
+SET Currency = i.Currency
+FROM (SELECT DISTINCT ON (OrderID) OrderID, Currency FROM OrderItems ORDER BY OrderID, ProductID) i
+WHERE i.OrderID = o.OrderID;
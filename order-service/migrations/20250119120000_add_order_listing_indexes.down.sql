@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS orders_status_date_idx;
+DROP INDEX IF EXISTS orders_customer_date_idx;
+DROP INDEX IF EXISTS orders_date_idx;
@@ -0,0 +1,5 @@
+-- Индексы под keyset-пагинацию GetAllOrders: от новых заказов к старым,
+-- отдельно для выборки по клиенту и по статусу
+CREATE INDEX orders_date_idx ON Orders (OrderDate DESC, OrderID DESC);
+CREATE INDEX orders_customer_date_idx ON Orders (CustomerID, OrderDate DESC, OrderID DESC);
+CREATE INDEX orders_status_date_idx ON Orders (Status, OrderDate DESC, OrderID DESC);
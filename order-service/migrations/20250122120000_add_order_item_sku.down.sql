@@ -0,0 +1 @@
+ALTER TABLE OrderItems DROP COLUMN IF EXISTS SKU;
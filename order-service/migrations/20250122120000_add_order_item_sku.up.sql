@@ -0,0 +1,2 @@
+-- Артикул заказанного варианта товара; пусто - заказан товар без вариантов
+ALTER TABLE OrderItems ADD COLUMN SKU VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Склад, с которого catalog-service зарезервировал позицию; NULL - заказ создан до появления складов
+ALTER TABLE OrderItems ADD COLUMN WarehouseID INT;